@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+)
+
+// bulkOpType maps the task types that can be sent through /Bulk to the
+// membership operation they perform. Only group membership qualifies: those
+// tasks change nothing in the local store, so their outcome can be recorded
+// after the whole bulk request returns.
+var bulkOpType = map[string]string{
+	"add-to-group":      "add",
+	"remove-from-group": "remove",
+}
+
+// negotiateBulkSize checks the requested bulk size against what SmartSuite
+// advertises in its ServiceProviderConfig. It returns 0, meaning every task is
+// sent as its own PATCH, when bulk is unsupported or support cannot be
+// confirmed, and caps the size at the server's maxOperations.
+func negotiateBulkSize(ctx context.Context, client *smartsuite.Client, requested int) int {
+	config, err := client.GetServiceProviderConfig(ctx)
+	if err != nil {
+		slog.Warn("Could not read ServiceProviderConfig. Sending membership tasks individually.", "error", err)
+		return 0
+	}
+	if !config.Bulk.Supported {
+		slog.Warn("SmartSuite does not advertise bulk support. Sending membership tasks individually.")
+		return 0
+	}
+	if max := config.Bulk.MaxOperations; max > 0 && requested > max {
+		slog.Warn("Requested bulk size exceeds the server's limit. Using the limit instead.", "bulk_size", requested, "max_operations", max)
+		return max
+	}
+	return requested
+}
+
+// runBulk sends the tasks at the given queue indexes as one SCIM bulk request
+// and returns each task's outcome keyed by queue index. Tasks that cannot be
+// resolved against the local store fail on their own without being sent. If
+// the request as a whole fails, every sent task gets that error.
+func runBulk(ctx context.Context, client *smartsuite.Client, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord, queue []models.JobTask, indexes []int) map[int]error {
+	results := make(map[int]error, len(indexes))
+	var ops []models.BulkOperation
+	sent := make(map[string]int)
+	befores := make(map[int]*models.TaskBefore, len(indexes))
+	for _, i := range indexes {
+		task := &queue[i]
+		befores[i] = captureBefore(task, userStore, groupStore)
+		groupID, op, err := groupMembershipOp(userStore, groupStore, task, bulkOpType[task.Type])
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		bulkID := fmt.Sprintf("task-%d", i)
+		sent[bulkID] = i
+		ops = append(ops, models.BulkOperation{
+			Method: "PATCH",
+			Path:   "/Groups/" + groupID,
+			BulkID: bulkID,
+			Data: map[string]interface{}{
+				"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+				"Operations": []models.SCIMPatchOp{op},
+			},
+		})
+	}
+	if len(ops) == 0 {
+		return results
+	}
+
+	resp, err := client.Bulk(ctx, ops)
+	if err != nil {
+		for _, i := range sent {
+			results[i] = err
+		}
+		return results
+	}
+
+	for _, result := range resp.Operations {
+		i, ok := sent[result.BulkID]
+		if !ok {
+			continue
+		}
+		results[i] = bulkResultError(result)
+		if results[i] == nil {
+			queue[i].Before = befores[i]
+		}
+		delete(sent, result.BulkID)
+	}
+	// The server stops early when it hits its failOnErrors threshold, leaving
+	// later operations unanswered; those were not applied.
+	for _, i := range sent {
+		results[i] = fmt.Errorf("bulk response did not include a result for this task")
+	}
+	return results
+}
+
+// bulkResultError converts a failed bulk result into an error, including the
+// SCIM error body when the server sent one. It returns nil on success.
+func bulkResultError(result models.BulkOperationResult) error {
+	if result.Succeeded() {
+		return nil
+	}
+	if result.Response == nil {
+		return fmt.Errorf("bulk operation failed with status %s", result.Status)
+	}
+	detail, _ := json.Marshal(result.Response)
+	return fmt.Errorf("bulk operation failed with status %s: %s", result.Status, detail)
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"hash/fnv"
+	"slices"
+	"sync"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// taskRunner runs a single task against the given users and groups, which
+// hold only the records the task needs.
+type taskRunner func(ctx context.Context, users map[string]models.UserRecord, groups map[string]models.GroupRecord, task *models.JobTask) error
+
+// runPool runs the pending tasks in order through concurrency workers. Tasks
+// are sharded by target so those touching the same user run one after
+// another, in order, on the same worker. An update that renames its target
+// waits for every in-flight task and finishes before anything else is
+// dispatched, since later tasks may address the user by the new name.
+//
+// Each task runs in its own audit transaction, on private copies of the
+// records it needs, which are merged back into userStore and groupStore
+// afterwards; finish is then called with the task's context and the shared
+// state locked. When a task hits a maintenance window, dispatching
+// stops, in-flight tasks are allowed to finish, and the maintenance error is
+// returned with the task left pending. Cancelling ctx stops dispatching the
+// same way.
+func runPool(ctx context.Context, concurrency int, jobQueue []models.JobTask, order []int, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord, run taskRunner, finish func(ctx context.Context, task *models.JobTask, err error)) error {
+	var (
+		mu      sync.Mutex
+		haltErr error
+		workers sync.WaitGroup
+		pending sync.WaitGroup
+	)
+	halted := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return haltErr != nil
+	}
+
+	queues := make([]chan int, concurrency)
+	for w := range queues {
+		queues[w] = make(chan int)
+		workers.Add(1)
+		go func(queue <-chan int) {
+			defer workers.Done()
+			for i := range queue {
+				task := &jobQueue[i]
+				if ctx.Err() != nil || halted() {
+					pending.Done()
+					continue
+				}
+
+				mu.Lock()
+				users, groups := taskView(task, userStore, groupStore)
+				mu.Unlock()
+				before := keys(users)
+				members := make(map[string][]string, len(groups))
+				for name, record := range groups {
+					members[name] = record.Members
+				}
+
+				// The task runs on a copy so saves of the queue never see it half-written.
+				work := *task
+				taskCtx := withTransaction(ctx)
+				err := run(taskCtx, users, groups, &work)
+
+				mu.Lock()
+				if exitCode(err) == exitMaintenance {
+					if haltErr == nil {
+						haltErr = err
+					}
+				} else {
+					for key := range before {
+						if _, ok := users[key]; !ok {
+							delete(userStore, key)
+						}
+					}
+					for key, record := range users {
+						userStore[key] = record
+					}
+					// Other workers may have changed the same group meanwhile,
+					// so only this task's membership changes are merged back.
+					for name, record := range groups {
+						if shared, ok := groupStore[name]; ok {
+							mergeMembers(&shared, members[name], record.Members)
+							groupStore[name] = shared
+						}
+					}
+					*task = work
+					finish(taskCtx, task, err)
+				}
+				mu.Unlock()
+				pending.Done()
+			}
+		}(queues[w])
+	}
+
+	for _, i := range order {
+		if ctx.Err() != nil || halted() {
+			break
+		}
+		task := &jobQueue[i]
+		if task.Status != "pending" {
+			continue
+		}
+		barrier := isRename(task)
+		if barrier {
+			pending.Wait()
+		}
+		pending.Add(1)
+		queues[shard(task.Target, concurrency)] <- i
+		if barrier {
+			pending.Wait()
+		}
+	}
+	for _, queue := range queues {
+		close(queue)
+	}
+	workers.Wait()
+	return haltErr
+}
+
+// mergeMembers applies the difference between two versions of a group's
+// member list to record.
+func mergeMembers(record *models.GroupRecord, before, after []string) {
+	for _, id := range after {
+		if !slices.Contains(before, id) {
+			record.SetMember(id, true)
+		}
+	}
+	for _, id := range before {
+		if !slices.Contains(after, id) {
+			record.SetMember(id, false)
+		}
+	}
+}
+
+// taskView copies the user and group records task refers to out of the
+// shared maps.
+func taskView(task *models.JobTask, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord) (map[string]models.UserRecord, map[string]models.GroupRecord) {
+	users := make(map[string]models.UserRecord, 1)
+	if record, ok := userStore[task.Target]; ok {
+		users[task.Target] = record
+	}
+	groups := make(map[string]models.GroupRecord, 1)
+	if name, ok := task.Data.(string); ok {
+		if record, ok := groupStore[name]; ok {
+			groups[name] = record
+		}
+	}
+	return users, groups
+}
+
+// isRename reports whether task is an update that changes the user's userName.
+func isRename(task *models.JobTask) bool {
+	if task.Type != "update" {
+		return false
+	}
+	dataMap, ok := task.Data.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	newName := newUserName(dataMap)
+	return newName != "" && newName != task.Target
+}
+
+// shard maps a task target to one of n workers.
+func shard(target string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(target))
+	return int(h.Sum32() % uint32(n))
+}
+
+func keys(users map[string]models.UserRecord) map[string]bool {
+	set := make(map[string]bool, len(users))
+	for key := range users {
+		set[key] = true
+	}
+	return set
+}
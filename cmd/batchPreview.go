@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// attributeChange describes the effect a task would have on one attribute.
+type attributeChange struct {
+	Path  string
+	Old   interface{}
+	New   interface{}
+	Known bool // false when the local store does not track this attribute
+}
+
+// Changed reports whether applying the change would alter the attribute.
+func (c attributeChange) Changed() bool {
+	return !c.Known || fmt.Sprint(c.Old) != fmt.Sprint(c.New)
+}
+
+func (c attributeChange) String() string {
+	if !c.Known {
+		return fmt.Sprintf("%s: ? → %#v", c.Path, c.New)
+	}
+	if !c.Changed() {
+		return fmt.Sprintf("%s: %#v (no change)", c.Path, c.Old)
+	}
+	return fmt.Sprintf("%s: %#v → %#v", c.Path, c.Old, c.New)
+}
+
+// taskStatusWouldRun marks, in a dry run only, a pending task whose request
+// could be built. It is never written to the job queue file.
+const taskStatusWouldRun = "would-run"
+
+// previewBatch writes a human-readable preview of every pending task to out,
+// in execution order, using the local store as the source of current values.
+// The PATCH each task would send is logged, and tasks it could be built for
+// are marked would-run in jobQueue. It returns how many were marked.
+func previewBatch(out io.Writer, jobQueue []models.JobTask, order []int, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord) int {
+	wouldRun := 0
+	for _, i := range order {
+		task := &jobQueue[i]
+		if task.Status != "pending" {
+			continue
+		}
+		fmt.Fprintf(out, "[%d] %s %s\n", i, task.Type, task.Target)
+
+		if path, operations, err := plannedPatch(task, userStore, groupStore); err == nil {
+			payload, _ := json.Marshal(operations)
+			slog.Info("Dry run: would send request", "task_index", i, "method", "PATCH", "path", path, "operations", string(payload))
+			task.Status = taskStatusWouldRun
+			wouldRun++
+		}
+
+		record, ok := userStore[task.Target]
+		if !ok {
+			fmt.Fprintf(out, "    would fail: user '%s' not found in local store\n", task.Target)
+			continue
+		}
+
+		switch task.Type {
+		case "update":
+			dataMap, ok := task.Data.(map[string]interface{})
+			if !ok {
+				fmt.Fprintln(out, "    would fail: task data for update must be a map of attributes")
+				continue
+			}
+			for _, change := range diffUpdate(task.Target, record, dataMap) {
+				fmt.Fprintf(out, "    %s\n", change)
+			}
+		case "deactivate":
+			change := attributeChange{Path: "active", Old: record.Status == "active", New: false, Known: true}
+			fmt.Fprintf(out, "    %s\n", change)
+		case "add-to-group", "remove-from-group":
+			groupName, _ := task.Data.(string)
+			if _, ok := groupStore[groupName]; !ok {
+				fmt.Fprintf(out, "    would fail: group '%s' not found in local store\n", groupName)
+				continue
+			}
+			verb := "add"
+			if task.Type == "remove-from-group" {
+				verb = "remove"
+			}
+			fmt.Fprintf(out, "    members of '%s': would %s %s\n", groupName, verb, record.SCIMID)
+		default:
+			fmt.Fprintf(out, "    would fail: unknown task type: '%s'\n", task.Type)
+		}
+	}
+	return wouldRun
+}
+
+// plannedPatch returns the endpoint path and operations of the PATCH request
+// runTask would send for task, or the error it would fail with before
+// reaching the API.
+func plannedPatch(task *models.JobTask, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord) (string, []models.SCIMPatchOp, error) {
+	if opType, ok := bulkOpType[task.Type]; ok {
+		groupID, op, err := groupMembershipOp(userStore, groupStore, task, opType)
+		if err != nil {
+			return "", nil, err
+		}
+		return "/Groups/" + groupID, []models.SCIMPatchOp{op}, nil
+	}
+
+	record, ok := userStore[task.Target]
+	if !ok {
+		return "", nil, fmt.Errorf("user '%s' not found in local store", task.Target)
+	}
+	switch task.Type {
+	case "update":
+		dataMap, ok := task.Data.(map[string]interface{})
+		if !ok {
+			return "", nil, fmt.Errorf("task data for update must be a map of attributes")
+		}
+		operations, err := updateOperations(dataMap)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid update for user '%s': %w", task.Target, err)
+		}
+		if len(operations) == 0 {
+			return "", nil, fmt.Errorf("no update operations provided for user '%s'", task.Target)
+		}
+		return "/Users/" + record.SCIMID, operations, nil
+	case "deactivate":
+		return "/Users/" + record.SCIMID, deactivateOperations, nil
+	default:
+		return "", nil, fmt.Errorf("unknown task type: '%s'", task.Type)
+	}
+}
+
+// enterpriseUserSchema is the URN that qualifies enterprise extension
+// attribute paths.
+const enterpriseUserSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+
+// enterpriseUpdateKeys are the update-map keys that name enterprise extension
+// attributes. SCIM only resolves core attributes unqualified, so these are
+// sent with the schema URN prefixed (e.g. department becomes
+// urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department).
+var enterpriseUpdateKeys = map[string]bool{
+	"organization":   true,
+	"department":     true,
+	"costCenter":     true,
+	"division":       true,
+	"employeeNumber": true,
+}
+
+// updatePath returns the PATCH path for an update-map key. Keys that are
+// already fully qualified are sent unchanged.
+func updatePath(key string) string {
+	if enterpriseUpdateKeys[key] {
+		return enterpriseUserSchema + ":" + key
+	}
+	return key
+}
+
+// updateKey is the inverse of updatePath: it strips the enterprise schema URN
+// from a qualified path, so both spellings refer to the same attribute.
+func updateKey(path string) string {
+	if key, ok := strings.CutPrefix(path, enterpriseUserSchema+":"); ok && enterpriseUpdateKeys[key] {
+		return key
+	}
+	return path
+}
+
+// newUserName returns the userName an update task's attribute map renames the
+// user to, or "" if it does not set one. Keys are resolved with updateKey, so
+// every caller agrees with handleUpdateTask on what counts as a rename.
+func newUserName(dataMap map[string]interface{}) string {
+	for key, value := range dataMap {
+		if str, ok := value.(string); ok && updateKey(key) == "userName" {
+			return str
+		}
+	}
+	return ""
+}
+
+// coreUpdateKeys are the core User attributes an update task may replace.
+// Together with enterpriseUpdateKeys and extra_patch_paths they are the only
+// keys sent, so a misspelt attribute fails the task instead of reaching
+// SmartSuite, which may reject it or silently ignore it.
+var coreUpdateKeys = map[string]bool{
+	"userName":          true,
+	"displayName":       true,
+	"nickName":          true,
+	"title":             true,
+	"userType":          true,
+	"preferredLanguage": true,
+	"locale":            true,
+	"timezone":          true,
+	"active":            true,
+	"externalId":        true,
+	"name":              true,
+	"name.formatted":    true,
+	"name.givenName":    true,
+	"name.familyName":   true,
+	"name.middleName":   true,
+	"emails":            true,
+	"phoneNumbers":      true,
+}
+
+// checkUpdateKey fails for an update-map key that is not a known patchable
+// attribute. Attributes of custom schemas are allowed through
+// extra_patch_paths, whose entries are either exact paths or schema URNs
+// (starting with "urn:") that allow every attribute under them.
+func checkUpdateKey(key string) error {
+	if coreUpdateKeys[key] || enterpriseUpdateKeys[updateKey(key)] {
+		return nil
+	}
+	for _, extra := range configList("extra_patch_paths") {
+		if key == extra || (strings.HasPrefix(extra, "urn:") && strings.HasPrefix(key, strings.TrimSuffix(extra, ":")+":")) {
+			return nil
+		}
+	}
+	known := make([]string, 0, len(coreUpdateKeys)+len(enterpriseUpdateKeys))
+	for k := range coreUpdateKeys {
+		known = append(known, k)
+	}
+	for k := range enterpriseUpdateKeys {
+		known = append(known, k)
+	}
+	sort.Strings(known)
+	return fmt.Errorf("unknown attribute '%s'; patchable attributes are %s, plus any listed in extra_patch_paths", key, strings.Join(known, ", "))
+}
+
+// updateOperations turns an update task's attribute map into replace
+// operations, sorted by key so the request is the same on every run. Keys
+// are checked by checkUpdateKey, and values for complex attributes are
+// checked and reshaped by complexValue.
+func updateOperations(dataMap map[string]interface{}) ([]models.SCIMPatchOp, error) {
+	paths := make([]string, 0, len(dataMap))
+	for path := range dataMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	operations := make([]models.SCIMPatchOp, 0, len(paths))
+	for _, path := range paths {
+		if err := checkUpdateKey(path); err != nil {
+			return nil, err
+		}
+		value, _, err := complexValue(path, dataMap[path])
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, models.SCIMPatchOp{Op: "replace", Path: updatePath(path), Value: value})
+	}
+	return operations, nil
+}
+
+// diffUpdate compares an update task's attribute map with the stored record,
+// returning one change per attribute in a stable order.
+func diffUpdate(eppn string, record models.UserRecord, dataMap map[string]interface{}) []attributeChange {
+	paths := make([]string, 0, len(dataMap))
+	for path := range dataMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	changes := make([]attributeChange, 0, len(paths))
+	for _, path := range paths {
+		old, known := currentAttributeValue(eppn, record, path)
+		changes = append(changes, attributeChange{Path: path, Old: old, New: dataMap[path], Known: known})
+	}
+	return changes
+}
+
+// currentAttributeValue returns the stored value for a SCIM attribute path,
+// or false if the local store does not track that attribute.
+func currentAttributeValue(eppn string, record models.UserRecord, path string) (interface{}, bool) {
+	switch updateKey(path) {
+	case "userName":
+		return eppn, true
+	case "title":
+		return record.Title, true
+	case "active":
+		return record.Status == "active", true
+	case "name.formatted":
+		return record.Name.Formatted, true
+	case "name.givenName":
+		return record.Name.GivenName, true
+	case "name.familyName":
+		return record.Name.FamilyName, true
+	case "name":
+		return record.Name, true
+	case "emails":
+		return record.Emails, true
+	case "organization":
+		return record.Organization, true
+	case "department":
+		return record.Department, true
+	case "costCenter":
+		return record.CostCenter, true
+	case "division":
+		return record.Division, true
+	case "employeeNumber":
+		return record.EmployeeNumber, true
+	}
+	return nil, false
+}
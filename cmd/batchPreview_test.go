@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/viper"
+)
+
+func TestDiffUpdateSeparatesChangedFromUnchanged(t *testing.T) {
+	record := models.UserRecord{
+		Status: "active",
+		Title:  "Lecturer",
+		Name:   models.SCIMName{GivenName: "Alice", FamilyName: "Smith"},
+	}
+	data := map[string]interface{}{
+		"title":           "Professor",
+		"name.givenName":  "Alice",
+		"name.familyName": "Jones",
+		"active":          true,
+		"nickName":        "Al",
+	}
+
+	changes := diffUpdate("alice@example.edu", record, data)
+
+	want := map[string]bool{
+		"active":          false,
+		"name.familyName": true,
+		"name.givenName":  false,
+		"nickName":        true, // not tracked locally, so it may change
+		"title":           true,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("diffUpdate returned %d changes, want %d", len(changes), len(want))
+	}
+	for _, c := range changes {
+		if c.Changed() != want[c.Path] {
+			t.Errorf("%s: Changed() = %v, want %v", c.Path, c.Changed(), want[c.Path])
+		}
+	}
+
+	// Changes are listed in path order, so the preview is stable.
+	for i := 1; i < len(changes); i++ {
+		if changes[i-1].Path > changes[i].Path {
+			t.Errorf("changes out of order: %s before %s", changes[i-1].Path, changes[i].Path)
+		}
+	}
+}
+
+func TestPreviewBatchShowsBeforeAndAfter(t *testing.T) {
+	userStore := map[string]models.UserRecord{
+		"alice@example.edu": {SCIMID: "a1", Status: "active", Title: "Lecturer"},
+	}
+	jobQueue := []models.JobTask{
+		{Type: "update", Target: "alice@example.edu", Status: "pending", Data: map[string]interface{}{"title": "Professor", "active": true}},
+		{Type: "deactivate", Target: "alice@example.edu", Status: "pending"},
+		{Type: "update", Target: "bob@example.edu", Status: "pending", Data: map[string]interface{}{"title": "Dean"}},
+	}
+
+	var out bytes.Buffer
+	previewBatch(&out, jobQueue, executionOrder(jobQueue, false), userStore, nil)
+
+	for _, line := range []string{
+		`title: "Lecturer" → "Professor"`,
+		`active: true (no change)`,
+		`active: true → false`,
+		`would fail: user 'bob@example.edu' not found in local store`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("preview does not contain %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestCheckUpdateKey(t *testing.T) {
+	viper.Set("extra_patch_paths", "urn:example:params:scim:schemas:extension:campus:1.0:User, nickName.custom")
+	t.Cleanup(func() { viper.Set("extra_patch_paths", nil) })
+
+	for _, key := range []string{
+		"title",
+		"name.givenName",
+		"emails",
+		"department",
+		enterpriseUserSchema + ":department",
+		"urn:example:params:scim:schemas:extension:campus:1.0:User:building",
+		"nickName.custom",
+	} {
+		if err := checkUpdateKey(key); err != nil {
+			t.Errorf("checkUpdateKey(%q) = %v, want it allowed", key, err)
+		}
+	}
+
+	for _, key := range []string{
+		"titel",
+		"Title",
+		enterpriseUserSchema + ":manager",
+		"urn:example:params:scim:schemas:extension:campus:1.0:UserX:building",
+		"nickName.other",
+	} {
+		err := checkUpdateKey(key)
+		if err == nil {
+			t.Errorf("checkUpdateKey(%q) succeeded, want it rejected", key)
+			continue
+		}
+		if !strings.Contains(err.Error(), "unknown attribute '"+key+"'") {
+			t.Errorf("checkUpdateKey(%q) = %v, want it to name the attribute", key, err)
+		}
+	}
+}
+
+func TestCheckUpdateKeyWithoutExtraPaths(t *testing.T) {
+	viper.Set("extra_patch_paths", nil)
+	if err := checkUpdateKey("urn:example:params:scim:schemas:extension:campus:1.0:User:building"); err == nil {
+		t.Error("checkUpdateKey allowed a custom schema attribute without extra_patch_paths")
+	}
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/cobra"
+)
+
+var batchReportCmd = &cobra.Command{
+	Use:     "batch-report",
+	Aliases: []string{"batch-status"},
+	Short:   "Summarizes a job queue file produced by process-batch.",
+	Long: `Reads a job queue file, either the active job_queue.json or an archived
+job_queue.json.completed_* file, and reports the number of tasks in each status
+along with every failed task and its recorded error. This command makes no API
+calls and does not touch the store.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		queueFile, _ := cmd.Flags().GetString("queue")
+		if queueFile == "" {
+			queueFile, _ = cmd.Flags().GetString("file")
+		}
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		data, err := os.ReadFile(queueFile)
+		if err != nil {
+			slog.Error("Failed to read job queue file", "file", queueFile, "error", err)
+			os.Exit(1)
+		}
+		var jobQueue []models.JobTask
+		if err := json.Unmarshal(data, &jobQueue); err != nil {
+			slog.Error("Failed to unmarshal job queue data", "file", queueFile, "error", err)
+			os.Exit(1)
+		}
+
+		report := buildBatchReport(queueFile, jobQueue)
+		if asJSON {
+			if err := writeResource("-", report); err != nil {
+				slog.Error("Failed to write report", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+		printBatchReport(cmd.OutOrStdout(), report)
+	},
+}
+
+// batchReport is the summary produced by batch-report.
+type batchReport struct {
+	Queue    string         `json:"queue"`
+	Total    int            `json:"total"`
+	Counts   map[string]int `json:"counts"`
+	Failures []batchFailure `json:"failures"`
+}
+
+// batchFailure describes one failed task, identified by its queue position.
+type batchFailure struct {
+	Index    int        `json:"index"`
+	Type     string     `json:"type"`
+	Target   string     `json:"target"`
+	Error    string     `json:"error,omitempty"`
+	FailedAt *time.Time `json:"failed_at,omitempty"`
+}
+
+func buildBatchReport(queueFile string, jobQueue []models.JobTask) batchReport {
+	report := batchReport{
+		Queue:    queueFile,
+		Total:    len(jobQueue),
+		Counts:   make(map[string]int),
+		Failures: []batchFailure{},
+	}
+	for i, task := range jobQueue {
+		report.Counts[task.Status]++
+		if task.Status == "failed" {
+			report.Failures = append(report.Failures, batchFailure{Index: i, Type: task.Type, Target: task.Target, Error: task.LastError, FailedAt: task.FailedAt})
+		}
+	}
+	return report
+}
+
+func printBatchReport(out io.Writer, report batchReport) {
+	fmt.Fprintf(out, "Queue: %s\n", report.Queue)
+	fmt.Fprintf(out, "Total tasks: %d\n", report.Total)
+
+	statuses := make([]string, 0, len(report.Counts))
+	for status := range report.Counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(out, "  %-10s %d\n", status, report.Counts[status])
+	}
+
+	if len(report.Failures) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "Failures:")
+	for _, f := range report.Failures {
+		reason := f.Error
+		if reason == "" {
+			reason = "(no error recorded)"
+		}
+		if f.FailedAt != nil {
+			reason += fmt.Sprintf(" (at %s)", f.FailedAt.Format(time.RFC3339))
+		}
+		fmt.Fprintf(out, "  [%d] %s %s: %s\n", f.Index, f.Type, f.Target, reason)
+	}
+}
+
+// logFailedTasks logs a summary of the failed tasks at the end of a batch
+// run, so the reasons are visible without reading the queue file.
+func logFailedTasks(failures []batchFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	slog.Warn("Some tasks failed.", "failed", len(failures))
+	for _, f := range failures {
+		slog.Warn("Failed task", "index", f.Index, "type", f.Type, "target", f.Target, "error", f.Error)
+	}
+}
+
+func init() {
+	batchReportCmd.Flags().String("queue", "", "Path to the job queue file to report on.")
+	batchReportCmd.Flags().String("file", "", "Same as --queue.")
+	batchReportCmd.MarkFlagsOneRequired("queue", "file")
+	batchReportCmd.MarkFlagsMutuallyExclusive("queue", "file")
+	batchReportCmd.Flags().Bool("json", false, "Print the report as JSON.")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+func TestBatchReportMixedQueue(t *testing.T) {
+	jobQueue := []models.JobTask{
+		{Type: "update", Target: "alice@example.edu", Status: "completed"},
+		{Type: "deactivate", Target: "bob@example.edu", Status: "failed", LastError: "user 'bob@example.edu' not found in local store"},
+		{Type: "add-to-group", Target: "carol@example.edu", Status: "pending"},
+		{Type: "update", Target: "dave@example.edu", Status: "completed"},
+		{Type: "remove-from-group", Target: "erin@example.edu", Status: "failed"},
+	}
+
+	report := buildBatchReport("job_queue.json", jobQueue)
+
+	if report.Total != 5 {
+		t.Errorf("Total = %d, want 5", report.Total)
+	}
+	for status, want := range map[string]int{"completed": 2, "failed": 2, "pending": 1} {
+		if got := report.Counts[status]; got != want {
+			t.Errorf("Counts[%q] = %d, want %d", status, got, want)
+		}
+	}
+	if len(report.Failures) != 2 || report.Failures[0].Index != 1 || report.Failures[1].Index != 4 {
+		t.Fatalf("Failures = %+v, want tasks 1 and 4", report.Failures)
+	}
+
+	var out bytes.Buffer
+	printBatchReport(&out, report)
+	for _, line := range []string{
+		"Total tasks: 5",
+		"  completed  2",
+		"  failed     2",
+		"  pending    1",
+		"  [1] deactivate bob@example.edu: user 'bob@example.edu' not found in local store",
+		"  [4] remove-from-group erin@example.edu: (no error recorded)",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("report does not contain %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestBatchReportWithoutFailures(t *testing.T) {
+	report := buildBatchReport("job_queue.json", []models.JobTask{{Type: "update", Target: "alice@example.edu", Status: "completed"}})
+
+	var out bytes.Buffer
+	printBatchReport(&out, report)
+	if strings.Contains(out.String(), "Failures:") {
+		t.Errorf("report of a clean queue lists failures:\n%s", out.String())
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+)
+
+// taskRetry is the in-run retry policy for batch tasks that fail transiently.
+// The zero value runs every task once.
+type taskRetry struct {
+	retries int           // extra attempts after the first
+	backoff time.Duration // wait before the first retry, doubling after each
+}
+
+// run calls fn for task until it succeeds, fails permanently, or the retries
+// are used up, and returns the last error. Only transient API failures are
+// retried: a task rejected by SmartSuite or by local validation would fail
+// the same way again, and a maintenance window is left to a later run.
+func (r taskRetry) run(ctx context.Context, task *models.JobTask, fn func() error) error {
+	err := fn()
+	wait := r.backoff
+	for attempt := 1; attempt <= r.retries && isTransientTaskError(err); attempt++ {
+		slog.Warn("Task failed transiently, retrying...", "type", task.Type, "target", task.Target, "retry", attempt, "max_retries", r.retries, "sleep_duration", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		err = fn()
+		wait *= 2
+	}
+	return err
+}
+
+// isTransientTaskError reports whether a task that failed with err may
+// succeed if run again in the same batch.
+func isTransientTaskError(err error) bool {
+	if err == nil || exitCode(err) == exitMaintenance {
+		return false
+	}
+	return errors.Is(err, smartsuite.ErrTransient)
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+// journalEntry is one line of the append-only streaming journal. The first
+// line of every journal is a header naming the source file; every following
+// line records the outcome of the task at Index in that file. A completed
+// task's entry carries the task itself and its prior state, so undo-batch
+// can reverse it; undo-batch then appends an entry with only Index and the
+// undone status.
+type journalEntry struct {
+	Source string             `json:"source,omitempty"`
+	Index  int                `json:"index"`
+	Type   string             `json:"type,omitempty"`
+	Target string             `json:"target,omitempty"`
+	Data   interface{}        `json:"data,omitempty"`
+	Status string             `json:"status,omitempty"`
+	Error  string             `json:"error,omitempty"` // why a failed task failed
+	Before *models.TaskBefore `json:"before,omitempty"`
+}
+
+// streamBatch processes a batch file without holding it in memory. Tasks are
+// decoded from the source JSON array one at a time and, instead of rewriting a
+// queue file at each checkpoint, every outcome is appended to journalFile. On
+// resume the journal is replayed and tasks it already records are skipped, so
+// memory use is bounded by the number of finished tasks rather than the file size.
+func streamBatch(ctx context.Context, client *smartsuite.Client, s *store.Store, fromFile, journalFile string, retry taskRetry) error {
+	done, err := readJournal(journalFile, fromFile)
+	if err != nil {
+		return err
+	}
+	if len(done) > 0 {
+		slog.Info("Existing journal found. Resuming streamed batch.", "journal", journalFile, "finished_tasks", len(done))
+	}
+
+	source, err := os.Open(fromFile)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer source.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(source))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return fmt.Errorf("source file must contain a JSON array of tasks")
+	}
+
+	journal, err := os.OpenFile(journalFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open batch journal: %w", err)
+	}
+	defer journal.Close()
+	enc := json.NewEncoder(journal)
+	if len(done) == 0 {
+		if err := enc.Encode(journalEntry{Source: fromFile, Index: -1}); err != nil {
+			return fmt.Errorf("failed to write batch journal: %w", err)
+		}
+	}
+
+	userStore, err := s.LoadUsers()
+	if err != nil {
+		return fmt.Errorf("failed to load user store: %w", err)
+	}
+	groupStore, err := s.LoadGroups()
+	if err != nil {
+		return fmt.Errorf("failed to load group store: %w", err)
+	}
+
+	// failures lists the tasks that failed in this run; those failed in an
+	// earlier run are in the journal.
+	var failures []batchFailure
+	allCompleted := true
+	for _, status := range done {
+		if status != "completed" {
+			allCompleted = false
+		}
+	}
+
+	for index := 0; dec.More(); index++ {
+		if ctx.Err() != nil {
+			slog.Warn("Shutdown signal received. Progress is journaled; exiting.", "reason", ctx.Err())
+			return nil
+		}
+
+		var task models.JobTask
+		if err := dec.Decode(&task); err != nil {
+			return fmt.Errorf("failed to decode task %d from source file: %w", index, err)
+		}
+		if _, ok := done[index]; ok {
+			continue
+		}
+
+		slog.Debug("Processing task", "index", index, "type", task.Type, "target", task.Target)
+		taskCtx := withTransaction(ctx)
+		taskErr := retry.run(taskCtx, &task, func() error {
+			return runTask(taskCtx, client, s, userStore, groupStore, &task)
+		})
+		if exitCode(taskErr) == exitMaintenance {
+			// Leave the task unjournaled so a later run picks it up once the tenant is back.
+			slog.Error("Tenant is in maintenance. Progress is journaled; exiting.", "error", taskErr)
+			return taskErr
+		}
+
+		entry := journalEntry{Index: index, Type: task.Type, Target: task.Target, Data: task.Data, Before: task.Before}
+		if taskErr != nil {
+			entry.Status, entry.Error = "failed", taskErr.Error()
+			allCompleted = false
+			failures = append(failures, batchFailure{Index: index, Type: task.Type, Target: task.Target, Error: entry.Error})
+			logAndAudit(taskCtx, s, "ProcessBatch", task.Target, "error", "Task failed", "error", taskErr)
+		} else {
+			entry.Status = "completed"
+			logAndAudit(taskCtx, s, "ProcessBatch", task.Target, "info", fmt.Sprintf("Task '%s' completed successfully.", task.Type))
+		}
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write batch journal: %w", err)
+		}
+	}
+
+	slog.Info("Streamed batch process finished.")
+	logFailedTasks(failures)
+	if !allCompleted {
+		slog.Warn("Not all tasks were completed successfully. Journal will not be archived.", "journal", journalFile)
+		return nil
+	}
+
+	journal.Close()
+	completedFileName := fmt.Sprintf("%s.completed_%s", journalFile, time.Now().Format("20060102-150405"))
+	slog.Info("All tasks completed successfully. Archiving journal.", "new_name", completedFileName)
+	if err := os.Rename(journalFile, completedFileName); err != nil {
+		slog.Error("Failed to archive completed journal.", "error", err)
+	}
+	return nil
+}
+
+// readJournal returns the recorded status of every finished task, keyed by its
+// index in the source file. A missing journal means nothing has run yet.
+func readJournal(path, fromFile string) (map[int]string, error) {
+	done := make(map[int]string)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return done, nil
+	}
+	err := readJournalEntries(path, func(entry journalEntry) error {
+		if entry.Index < 0 {
+			if entry.Source != fromFile {
+				return fmt.Errorf("journal %s belongs to source file '%s', not '%s'", path, entry.Source, fromFile)
+			}
+			return nil
+		}
+		done[entry.Index] = entry.Status
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// readJournalTasks rebuilds the tasks recorded in a journal, at their index
+// in the source file, for undo-batch. Indexes the journal does not record
+// are left as empty tasks, which undo-batch skips.
+func readJournalTasks(path string) ([]models.JobTask, error) {
+	var tasks []models.JobTask
+	err := readJournalEntries(path, func(entry journalEntry) error {
+		if entry.Index < 0 {
+			return nil
+		}
+		for len(tasks) <= entry.Index {
+			tasks = append(tasks, models.JobTask{})
+		}
+		if entry.Type == "" {
+			// A status-only entry, such as undo-batch's undone marker.
+			tasks[entry.Index].Status = entry.Status
+			return nil
+		}
+		tasks[entry.Index] = models.JobTask{Type: entry.Type, Target: entry.Target, Data: entry.Data, Status: entry.Status, LastError: entry.Error, Before: entry.Before}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// readJournalEntries calls fn with each entry of the journal at path, in
+// order. A last line cut short by a crash is dropped from the file, so
+// entries appended afterwards start on a line of their own.
+func readJournalEntries(path string, fn func(entry journalEntry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open batch journal: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var good int64
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(data) > 0 {
+				// Every entry is written with its newline, so a line without
+				// one is torn: the process was killed mid-write.
+				slog.Warn("Discarding incomplete last line of the batch journal.", "journal", path, "line", line)
+				if err := os.Truncate(path, good); err != nil {
+					return fmt.Errorf("failed to truncate batch journal: %w", err)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read batch journal: %w", err)
+		}
+		good += int64(len(data))
+
+		var entry journalEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			slog.Warn("Skipping unreadable batch journal line", "line", line, "error", err)
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// appendJournal appends entry to the journal at path.
+func appendJournal(path string, entry journalEntry) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open batch journal: %w", err)
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		return fmt.Errorf("failed to write batch journal: %w", err)
+	}
+	return nil
+}
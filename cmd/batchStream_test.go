@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadJournalDropsTornLastLine(t *testing.T) {
+	complete := `{"source":"batch.json","index":-1}
+{"index":0,"target":"alice@example.edu","status":"completed"}
+`
+	path := filepath.Join(t.TempDir(), "job_queue.journal")
+	if err := os.WriteFile(path, []byte(complete+`{"index":1,"target":"bo`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := readJournal(path, "batch.json")
+	if err != nil {
+		t.Fatalf("readJournal: %v", err)
+	}
+	if len(done) != 1 || done[0] != "completed" {
+		t.Errorf("readJournal = %v, want only task 0 completed", done)
+	}
+
+	// The torn line is cut off, so the next entry appended starts on its own line.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != complete {
+		t.Errorf("journal after read = %q, want %q", data, complete)
+	}
+}
+
+func TestReadJournalRejectsOtherSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job_queue.journal")
+	if err := os.WriteFile(path, []byte(`{"source":"other.json","index":-1}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readJournal(path, "batch.json"); err == nil {
+		t.Error("readJournal accepted a journal for another source file")
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/cobra"
+)
+
+var cleanupPreviewCmd = &cobra.Command{
+	Use:   "cleanup-preview",
+	Short: "Lists deactivated users who will become eligible for deletion soon.",
+	Long: `Projects the cleanup-users grace period forward and lists every deactivated
+user whose permanent deletion falls within the next --within window, soonest
+first, so they can be reactivated before cleanup-users removes them. Users who
+are already eligible are counted but not listed; cleanup-users will delete them
+on its next run. This command is read-only and makes no API calls.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		within, _ := cmd.Flags().GetDuration("within")
+
+		dataDir := resolveDataDir()
+
+		s, err := newReadOnlyStore(dataDir)
+		if err != nil {
+			slog.Error("Failed to open store", "error", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+		userStore, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load local user store", "error", err)
+			os.Exit(1)
+		}
+
+		now := time.Now()
+		upcoming, overdue := upcomingDeletions(userStore, now, within)
+		if overdue > 0 {
+			slog.Info("Some users are already past their grace period and will be deleted on the next cleanup run.", "count", overdue)
+		}
+		if len(upcoming) == 0 {
+			slog.Info("No users become eligible for deletion within the window.", "within", within.String())
+			return
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "EPPN\tSCIM ID\tDEACTIVATED\tDELETION")
+		for _, d := range upcoming {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.EPPN, d.Record.SCIMID, formatTime(d.Record.DeactivationTimestamp, now), formatTime(&d.DeleteAt, now))
+		}
+		w.Flush()
+	},
+}
+
+// pendingDeletion is a deactivated user together with the time cleanup-users
+// will delete them.
+type pendingDeletion struct {
+	EPPN     string
+	Record   models.UserRecord
+	DeleteAt time.Time
+}
+
+// upcomingDeletions returns the users whose deletion time falls in (now, now+within],
+// ordered by deletion time and then ePPN, along with the number already eligible.
+func upcomingDeletions(users map[string]models.UserRecord, now time.Time, within time.Duration) ([]pendingDeletion, int) {
+	var upcoming []pendingDeletion
+	overdue := 0
+	horizon := now.Add(within)
+	for eppn, record := range users {
+		deleteAt, ok := cleanupDeletionTime(record)
+		if !ok {
+			continue
+		}
+		if !deleteAt.After(now) {
+			overdue++
+			continue
+		}
+		if !deleteAt.After(horizon) {
+			upcoming = append(upcoming, pendingDeletion{EPPN: eppn, Record: record, DeleteAt: deleteAt})
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		if !upcoming[i].DeleteAt.Equal(upcoming[j].DeleteAt) {
+			return upcoming[i].DeleteAt.Before(upcoming[j].DeleteAt)
+		}
+		return upcoming[i].EPPN < upcoming[j].EPPN
+	})
+	return upcoming, overdue
+}
+
+func init() {
+	cleanupPreviewCmd.Flags().Duration("within", 72*time.Hour, "How far ahead to look for upcoming deletions (e.g. 48h).")
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+func TestUpcomingDeletions(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	deactivatedAgo := func(d time.Duration) models.UserRecord {
+		ts := now.Add(-d)
+		return models.UserRecord{SCIMID: "id", Status: "inactive", DeactivationTimestamp: &ts}
+	}
+	users := map[string]models.UserRecord{
+		"active@example.edu":   {SCIMID: "id", Status: "active"},
+		"overdue@example.edu":  deactivatedAgo(8 * day),
+		"due-now@example.edu":  deactivatedAgo(7 * day),
+		"bob@example.edu":      deactivatedAgo(6 * day),
+		"anne@example.edu":     deactivatedAgo(6 * day),
+		"two-days@example.edu": deactivatedAgo(5 * day),
+		"edge@example.edu":     deactivatedAgo(4 * day),
+		"later@example.edu":    deactivatedAgo(4*day - time.Minute),
+		"recent@example.edu":   deactivatedAgo(time.Hour),
+	}
+
+	upcoming, overdue := upcomingDeletions(users, now, 72*time.Hour)
+
+	if overdue != 2 {
+		t.Errorf("overdue = %d, want 2", overdue)
+	}
+	var got []string
+	for _, d := range upcoming {
+		got = append(got, d.EPPN)
+	}
+	want := []string{"anne@example.edu", "bob@example.edu", "two-days@example.edu", "edge@example.edu"}
+	if !slices.Equal(got, want) {
+		t.Errorf("upcoming = %v, want %v", got, want)
+	}
+	if len(upcoming) > 0 && !upcoming[0].DeleteAt.Equal(now.Add(day)) {
+		t.Errorf("first DeleteAt = %s, want %s", upcoming[0].DeleteAt, now.Add(day))
+	}
+}
+
+func TestCleanupPreviewRunsAlongsideAnotherReader(t *testing.T) {
+	deactivated := time.Now().Add(-6 * 24 * time.Hour)
+	dataDir := seedDataDir(t, map[string]models.UserRecord{
+		"bob@example.edu": {SCIMID: "b2", Status: "inactive", DeactivationTimestamp: &deactivated},
+	})
+	// cleanup-preview only reads the store, so a reader already holding it
+	// must not lock it out.
+	reader, err := store.NewStore(dataDir, store.WithReadOnly())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer reader.Close()
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	t.Cleanup(func() { rootCmd.SetOut(nil) })
+
+	runCommand(t, newFakeSCIM(t), dataDir, "cleanup-preview")
+
+	if !strings.Contains(out.String(), "bob@example.edu") {
+		t.Errorf("preview = %q, want it to list bob@example.edu", out.String())
+	}
+}
@@ -1,45 +1,49 @@
 package cmd
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// cleanupGracePeriod is how long a deactivated user is kept before cleanup-users
+// permanently deletes them.
+const cleanupGracePeriod = 7 * 24 * time.Hour
+
 var cleanupUsersCmd = &cobra.Command{
 	Use:   "cleanup-users",
 	Short: "Deletes users who are past their deactivation grace period.",
 	Long: `Scans the local user store for any user who was deactivated more than 7 days ago.
 For each user found, it issues a permanent DELETE request to the SmartSuite API
-and removes them from the local store. This is intended to be run as a nightly scheduled task.`,
+and removes them from the local store. This is intended to be run as a nightly scheduled task,
+with --yes since there is no one to answer the confirmation prompt.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := cmd.Context()
-		slog.Info("Starting cleanup process for deactivated users")
-
-		apiURL := viper.GetString("api_url")
-		apiKey := viper.GetString("api_key")
-		dataDir := viper.GetString("data_dir")
-		if dataDir == "" {
-			dataDir = "./data"
-		}
-
-		client, err := smartsuite.NewClient(apiURL, apiKey)
-		if err != nil {
-			slog.Error("Failed to create API client", "error", err)
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		since, _ := cmd.Flags().GetDuration("since")
+		limit, _ := cmd.Flags().GetInt("limit")
+		slog.Info("Starting cleanup process for deactivated users", "dry_run", dryRun)
+
+		// A shorter cutoff would delete users still inside their grace period.
+		if since < cleanupGracePeriod && !dryRun {
+			slog.Error("--since shorter than the grace period is only allowed with --dry-run", "since", since.String(), "grace_period", cleanupGracePeriod.String())
 			os.Exit(1)
 		}
 
-		s, err := store.NewStore(dataDir)
+		client, s, err := setup(cmd)
 		if err != nil {
-			slog.Error("Failed to create store", "error", err)
+			slog.Error("Failed to set up command", "error", err)
 			os.Exit(1)
 		}
+		defer s.Close()
 
 		userStore, err := s.LoadUsers()
 		if err != nil {
@@ -47,12 +51,11 @@ and removes them from the local store. This is intended to be run as a nightly s
 			os.Exit(1)
 		}
 
-		gracePeriod := -7 * 24 * time.Hour
-		cutoffTime := time.Now().Add(gracePeriod)
+		cutoff := time.Now().Add(-since)
 		usersToDelete := make(map[string]string)
 
 		for eppn, record := range userStore {
-			if record.DeactivationTimestamp != nil && record.DeactivationTimestamp.Before(cutoffTime) {
+			if record.DeactivationTimestamp != nil && record.DeactivationTimestamp.Before(cutoff) {
 				usersToDelete[eppn] = record.SCIMID
 			}
 		}
@@ -64,23 +67,64 @@ and removes them from the local store. This is intended to be run as a nightly s
 
 		slog.Info("Found users to be permanently deleted.", "count", len(usersToDelete))
 
+		eppns := make([]string, 0, len(usersToDelete))
+		for eppn := range usersToDelete {
+			eppns = append(eppns, eppn)
+		}
+		sortByDeactivation(eppns, userStore)
+		if limit > 0 && len(eppns) > limit {
+			slog.Info("Deleting only the oldest deactivations this run; the rest are left for the next run.", "limit", limit, "remaining", len(eppns)-limit)
+			eppns = eppns[:limit]
+		}
+
+		if dryRun {
+			for _, eppn := range eppns {
+				slog.Info("Would delete user.", "eppn", eppn, "scim_id", usersToDelete[eppn], "deactivated_at", userStore[eppn].DeactivationTimestamp)
+			}
+			slog.Info("Dry run complete. No users were deleted.", "count", len(eppns), "eppns", eppns)
+			return
+		}
+
+		ok, err := confirm(cmd, fmt.Sprintf("This will permanently delete %d users: %s.", len(eppns), strings.Join(eppns, ", ")))
+		if err != nil {
+			slog.Error("Refusing to delete users without confirmation", "error", err)
+			os.Exit(1)
+		}
+		if !ok {
+			slog.Info("Cleanup cancelled. No users were deleted.")
+			return
+		}
+		logAndAudit(ctx, s, "CleanupUser", "", "info", "Deletion confirmed.", "count", len(eppns))
+
 		var failedDeletions []string
-		for eppn, scimID := range usersToDelete {
+		var deleted []deletionNotice
+		var haltErr error
+		for _, eppn := range eppns {
+			scimID := usersToDelete[eppn]
 			if ctx.Err() != nil {
 				slog.Warn("Shutdown signal received during cleanup. Halting.", "reason", ctx.Err())
 				break
 			}
-			logAndAudit(s, "CleanupUser", eppn, "info", "Attempting to delete user.", "scim_id", scimID)
+			logAndAudit(ctx, s, "CleanupUser", eppn, "info", "Attempting to delete user.", "scim_id", scimID)
 
+			// A user already deleted in SmartSuite (by hand or by a concurrent
+			// run) counts as deleted, so it leaves the store rather than being
+			// retried on every run.
 			err := client.DeleteUser(ctx, scimID)
+			if exitCode(err) == exitMaintenance {
+				slog.Error("Tenant is in maintenance. Halting cleanup.", "error", err)
+				haltErr = err
+				break
+			}
 			if err != nil {
-				logAndAudit(s, "CleanupUser", eppn, "error", "Failed to delete user via API", "error", err)
+				logAndAudit(ctx, s, "CleanupUser", eppn, "error", "Failed to delete user via API", "error", err)
 				failedDeletions = append(failedDeletions, eppn)
 				continue
 			}
 
+			deleted = append(deleted, deletionNotice{EPPN: eppn, SCIMID: scimID, DeactivatedAt: userStore[eppn].DeactivationTimestamp, DeletedAt: time.Now().UTC()})
 			delete(userStore, eppn)
-			logAndAudit(s, "CleanupUser", eppn, "info", "Successfully deleted user.")
+			logAndAudit(ctx, s, "CleanupUser", eppn, "info", "Successfully deleted user.")
 		}
 
 		if err := s.SaveUsers(userStore); err != nil {
@@ -88,9 +132,52 @@ and removes them from the local store. This is intended to be run as a nightly s
 			os.Exit(1)
 		}
 
+		// Notifications are best effort: the users are gone either way.
+		if notifyURL := viper.GetString("notify_url"); notifyURL != "" && len(deleted) > 0 {
+			if err := newWebhookNotifier(notifyURL).notifyDeleted(ctx, deleted); err != nil {
+				slog.Warn("Some deletion notifications were not delivered", "error", err)
+			}
+		}
+
+		if haltErr != nil {
+			os.Exit(exitCode(haltErr))
+		}
+
 		slog.Info("Cleanup process finished.")
 		if len(failedDeletions) > 0 {
 			slog.Warn("Some users failed to be deleted and will be retried on the next run.", "count", len(failedDeletions), "failed_eppns", failedDeletions)
 		}
 	},
 }
+
+// sortByDeactivation orders deactivated users oldest deactivation first, then
+// by ePPN, so the listing, the deletions and their audit events come out in
+// the same order on every run and a --limit leaves the most recent
+// deactivations for the next one.
+func sortByDeactivation(eppns []string, userStore map[string]models.UserRecord) {
+	sort.Slice(eppns, func(i, j int) bool {
+		a, b := userStore[eppns[i]].DeactivationTimestamp, userStore[eppns[j]].DeactivationTimestamp
+		if !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return eppns[i] < eppns[j]
+	})
+}
+
+// cleanupDeletionTime returns when a user becomes eligible for permanent
+// deletion, or false if the user has not been deactivated.
+func cleanupDeletionTime(record models.UserRecord) (time.Time, bool) {
+	if record.DeactivationTimestamp == nil {
+		return time.Time{}, false
+	}
+	return record.DeactivationTimestamp.Add(cleanupGracePeriod), true
+}
+
+func init() {
+	cleanupUsersCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation. Required when stdin is not a terminal.")
+	cleanupUsersCmd.Flags().Bool("dry-run", false, "List the users that would be deleted without deleting them or changing the store.")
+	cleanupUsersCmd.Flags().String("notify-url", "", "POST a JSON notice to this URL for each deleted user. Failed notifications are logged and do not fail the run.")
+	viper.BindPFlag("notify_url", cleanupUsersCmd.Flags().Lookup("notify-url"))
+	cleanupUsersCmd.Flags().Int("limit", 0, "Delete at most this many users per run, oldest deactivations first. Zero deletes every eligible user.")
+	cleanupUsersCmd.Flags().Duration("since", cleanupGracePeriod, "Treat users deactivated longer ago than this as past their grace period. Values below the 168h grace period require --dry-run.")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+func TestCleanupUsersRemovesUsersAlreadyDeleted(t *testing.T) {
+	// alice was already deleted in SmartSuite, so her DELETE answers 404;
+	// bob is still there; carol is inside her grace period.
+	old := time.Now().Add(-10 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	dataDir := seedDataDir(t, map[string]models.UserRecord{
+		"alice@example.edu": {SCIMID: "a1", Status: "inactive", DeactivationTimestamp: &old},
+		"bob@example.edu":   {SCIMID: "b2", Status: "inactive", DeactivationTimestamp: &old},
+		"carol@example.edu": {SCIMID: "c3", Status: "inactive", DeactivationTimestamp: &recent},
+	})
+	fake := newFakeSCIM(t,
+		models.SCIMUser{ID: "b2", UserName: "bob@example.edu"},
+		models.SCIMUser{ID: "c3", UserName: "carol@example.edu"},
+	)
+
+	runCommand(t, fake, dataDir, "cleanup-users", "--yes")
+
+	calls := fake.calls()
+	slices.Sort(calls)
+	if want := []string{"DELETE /Users/a1", "DELETE /Users/b2"}; !slices.Equal(calls, want) {
+		t.Errorf("requests = %v, want %v", calls, want)
+	}
+	s, err := store.NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer s.Close()
+	users, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	if _, ok := users["alice@example.edu"]; ok {
+		t.Error("alice is still in the store after her DELETE returned 404")
+	}
+	if _, ok := users["bob@example.edu"]; ok {
+		t.Error("bob is still in the store after being deleted")
+	}
+	if _, ok := users["carol@example.edu"]; !ok {
+		t.Error("carol was removed inside her grace period")
+	}
+}
+
+func TestSortByDeactivationIsStable(t *testing.T) {
+	early := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	userStore := map[string]models.UserRecord{
+		"dave@example.edu":  {DeactivationTimestamp: &late},
+		"bob@example.edu":   {DeactivationTimestamp: &early},
+		"carol@example.edu": {DeactivationTimestamp: &late},
+		"alice@example.edu": {DeactivationTimestamp: &early},
+		"erin@example.edu":  {DeactivationTimestamp: &early},
+	}
+	want := []string{"alice@example.edu", "bob@example.edu", "erin@example.edu", "carol@example.edu", "dave@example.edu"}
+
+	// Map iteration order differs between runs, which is what the cleanup
+	// listing starts from.
+	for range 20 {
+		var eppns []string
+		for eppn := range userStore {
+			eppns = append(eppns, eppn)
+		}
+		sortByDeactivation(eppns, userStore)
+		if !slices.Equal(eppns, want) {
+			t.Fatalf("sortByDeactivation = %v, want %v", eppns, want)
+		}
+	}
+}
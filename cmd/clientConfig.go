@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+
+	"github.com/spf13/viper"
+)
+
+// newClient builds a SmartSuite API client from the api_url and api_key
+// settings, or OAuth2 client credentials when oauth_token_url is set, applying any optional client tuning found in the configuration.
+func newClient() (*smartsuite.Client, error) {
+	var opts []smartsuite.ClientOption
+
+	if prefix := viper.GetString("api_path_prefix"); prefix != "" {
+		opts = append(opts, smartsuite.WithPathPrefix(prefix))
+	}
+	if v := viper.GetString("tls_min_version"); v != "" {
+		version, err := smartsuite.ParseTLSVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, smartsuite.WithMinTLSVersion(version))
+	}
+	if names := configList("tls_cipher_suites"); len(names) > 0 {
+		ids, err := smartsuite.ParseCipherSuites(names)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, smartsuite.WithCipherSuites(ids))
+	}
+	if path := viper.GetString("tls_ca_file"); path != "" {
+		pool, err := smartsuite.LoadCABundle(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, smartsuite.WithRootCAs(pool))
+	}
+	if viper.GetBool("tls_insecure_skip_verify") {
+		slog.Warn("TLS certificate verification is DISABLED (SMARTSUITE_TLS_INSECURE_SKIP_VERIFY). API traffic, including the API key, can be intercepted. Do not use this in production.")
+		opts = append(opts, smartsuite.WithInsecureSkipVerify())
+	}
+	if raw := viper.GetString("proxy_url"); raw != "" {
+		proxy, err := smartsuite.ParseProxyURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, smartsuite.WithProxyURL(proxy))
+	}
+
+	if viper.IsSet("max_retries") {
+		opts = append(opts, smartsuite.WithMaxRetries(viper.GetInt("max_retries")))
+	}
+	if backoff := viper.GetDuration("base_backoff"); backoff > 0 {
+		opts = append(opts, smartsuite.WithBaseBackoff(backoff))
+	}
+	if backoff := viper.GetDuration("max_backoff"); backoff > 0 {
+		opts = append(opts, smartsuite.WithMaxBackoff(backoff))
+	}
+	if budget := viper.GetDuration("max_elapsed"); budget > 0 {
+		opts = append(opts, smartsuite.WithMaxElapsed(budget))
+	}
+	if timeout := viper.GetDuration("request_timeout"); timeout > 0 {
+		opts = append(opts, smartsuite.WithRequestTimeout(timeout))
+	}
+	if rps := viper.GetFloat64("rate_limit"); rps > 0 {
+		opts = append(opts, smartsuite.WithRateLimit(rps, viper.GetInt("rate_burst")))
+	}
+	if wait := viper.GetDuration("maintenance_wait"); wait > 0 {
+		opts = append(opts, smartsuite.WithMaintenanceWait(wait))
+	}
+	if viper.IsSet("page_workers") {
+		opts = append(opts, smartsuite.WithPageWorkers(viper.GetInt("page_workers")))
+	}
+	if size := viper.GetInt("page_size"); size > 0 {
+		opts = append(opts, smartsuite.WithPageSize(size))
+	}
+	if viper.GetBool("log_bodies") {
+		if logLevel <= slog.LevelDebug {
+			opts = append(opts, smartsuite.WithBodyLogging(viper.GetInt("log_body_max_bytes"), configList("log_redact_fields")))
+		} else {
+			slog.Warn("--log-bodies has no effect without debug logging (--debug or --log-level debug); request and response bodies will not be logged.")
+		}
+	}
+	if viper.GetBool("idempotent_membership") {
+		var match *regexp.Regexp
+		if pattern := viper.GetString("membership_noop_pattern"); pattern != "" {
+			var err error
+			if match, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid membership_noop_pattern '%s': %w", pattern, err)
+			}
+		}
+		opts = append(opts, smartsuite.WithIdempotentMembership(match))
+	}
+	if tokenURL := viper.GetString("oauth_token_url"); tokenURL != "" {
+		opts = append(opts, smartsuite.WithClientCredentials(tokenURL, viper.GetString("oauth_client_id"), viper.GetString("oauth_client_secret"), configList("oauth_scopes")))
+	}
+
+	return smartsuite.NewClient(viper.GetString("api_url"), viper.GetString("api_key"), opts...)
+}
+
+// configList reads a list-valued setting. It accepts either a YAML list or a
+// comma-separated string, which is the only form an environment variable can take.
+func configList(key string) []string {
+	var values []string
+	for _, item := range viper.GetStringSlice(key) {
+		for _, v := range strings.Split(item, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// complexValue checks the value given for an update-map key that names a
+// complex SCIM attribute (emails, phoneNumbers or name) and returns it in the
+// shape SCIM expects, ready to be sent as the value of a replace operation.
+// ok is false for any other key, whose value is sent as written.
+func complexValue(key string, value interface{}) (v interface{}, ok bool, err error) {
+	switch key {
+	case "emails":
+		var emails []models.EmailRecord
+		if err := decodeStrict(value, &emails); err != nil {
+			return nil, true, fmt.Errorf("emails must be a list of {value, type, primary} objects: %w", err)
+		}
+		if err := checkMultiValued("emails", len(emails), func(i int) (string, bool) { return emails[i].Value, emails[i].Primary }); err != nil {
+			return nil, true, err
+		}
+		return emails, true, nil
+	case "phoneNumbers":
+		var phones []models.SCIMPhoneNumber
+		if err := decodeStrict(value, &phones); err != nil {
+			return nil, true, fmt.Errorf("phoneNumbers must be a list of {value, type, primary} objects: %w", err)
+		}
+		if err := checkMultiValued("phoneNumbers", len(phones), func(i int) (string, bool) { return phones[i].Value, phones[i].Primary }); err != nil {
+			return nil, true, err
+		}
+		return phones, true, nil
+	case "name":
+		var name models.SCIMName
+		if err := decodeStrict(value, &name); err != nil {
+			return nil, true, fmt.Errorf("name must be an object with formatted, givenName and/or familyName: %w", err)
+		}
+		return name, true, nil
+	}
+	return value, false, nil
+}
+
+// checkMultiValued rejects entries without a value and more than one entry
+// marked primary, which SCIM forbids.
+func checkMultiValued(attr string, n int, entry func(i int) (value string, primary bool)) error {
+	primaries := 0
+	for i := range n {
+		value, primary := entry(i)
+		if value == "" {
+			return fmt.Errorf("%s[%d] has no value", attr, i)
+		}
+		if primary {
+			primaries++
+		}
+	}
+	if primaries > 1 {
+		return fmt.Errorf("%s has %d entries marked primary; at most one may be", attr, primaries)
+	}
+	return nil
+}
+
+// decodeStrict converts a value decoded from JSON into out, rejecting
+// attributes out does not have.
+func decodeStrict(value interface{}, out interface{}) error {
+	if value == nil {
+		return errors.New("value is null")
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(out)
+}
+
+// primaryEmail returns the address marked primary, falling back to the first
+// one listed, as SCIMUser.PrimaryEmail does.
+func primaryEmail(emails []models.EmailRecord) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+// primaryPhone is primaryEmail for phone numbers.
+func primaryPhone(phones []models.SCIMPhoneNumber) string {
+	for _, p := range phones {
+		if p.Primary {
+			return p.Value
+		}
+	}
+	if len(phones) > 0 {
+		return phones[0].Value
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// decodeJSON decodes raw the way a batch file's task data is decoded.
+func decodeJSON(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("decoding %s: %v", raw, err)
+	}
+	return v
+}
+
+func TestComplexValueReplacesPrimaryEmail(t *testing.T) {
+	value := decodeJSON(t, `[{"value":"alice@old.example.edu","type":"other"},{"value":"alice@example.edu","type":"work","primary":true}]`)
+
+	v, ok, err := complexValue("emails", value)
+	if err != nil || !ok {
+		t.Fatalf("complexValue(emails) = %v, %v, %v", v, ok, err)
+	}
+	want := []models.EmailRecord{
+		{Value: "alice@old.example.edu", Type: "other"},
+		{Value: "alice@example.edu", Type: "work", Primary: true},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("complexValue(emails) = %#v, want %#v", v, want)
+	}
+	if got := primaryEmail(want); got != "alice@example.edu" {
+		t.Errorf("primaryEmail = %q, want the entry marked primary", got)
+	}
+
+	ops, err := updateOperations(map[string]interface{}{"emails": value})
+	if err != nil {
+		t.Fatalf("updateOperations: %v", err)
+	}
+	if len(ops) != 1 || ops[0].Op != "replace" || ops[0].Path != "emails" || !reflect.DeepEqual(ops[0].Value, want) {
+		t.Errorf("updateOperations = %#v, want one replace of emails with %#v", ops, want)
+	}
+}
+
+func TestComplexValueRejectsInvalidValues(t *testing.T) {
+	tests := map[string]struct {
+		key, raw string
+	}{
+		"two primaries":      {"emails", `[{"value":"a@example.edu","primary":true},{"value":"b@example.edu","primary":true}]`},
+		"unknown field":      {"emails", `[{"value":"a@example.edu","display":"A"}]`},
+		"missing value":      {"phoneNumbers", `[{"type":"work"}]`},
+		"not a list":         {"emails", `"a@example.edu"`},
+		"null":               {"emails", `null`},
+		"unknown name field": {"name", `{"first":"Alice"}`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v, ok, err := complexValue(tt.key, decodeJSON(t, tt.raw))
+			if err == nil || !ok {
+				t.Errorf("complexValue(%s, %s) = %v, %v, %v, want an error", tt.key, tt.raw, v, ok, err)
+			}
+		})
+	}
+}
+
+func TestComplexValuePassesOtherKeysThrough(t *testing.T) {
+	v, ok, err := complexValue("title", "Professor")
+	if ok || err != nil || v != "Professor" {
+		t.Errorf("complexValue(title) = %v, %v, %v, want the value unchanged", v, ok, err)
+	}
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// confirm asks the operator to approve a destructive action described by
+// prompt, unless --yes was passed. It refuses rather than waiting for an
+// answer when stdin is not a terminal, so unattended runs must opt in with
+// --yes.
+func confirm(cmd *cobra.Command, prompt string) (bool, error) {
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		return true, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("stdin is not a terminal; pass --yes to confirm")
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s Continue? (y/N) ", prompt)
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -6,11 +6,8 @@ import (
 	"os"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var createGroupCmd = &cobra.Command{
@@ -20,26 +17,20 @@ var createGroupCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := cmd.Context()
 		fromFile, _ := cmd.Flags().GetString("from-file")
+		outFile, _ := cmd.Flags().GetString("out")
 		slog.Info("Starting create-group process", "from_file", fromFile)
-
-		apiURL := viper.GetString("api_url")
-		apiKey := viper.GetString("api_key")
-		dataDir := viper.GetString("data_dir")
-		if dataDir == "" {
-			dataDir = "./data"
-		}
-
-		client, err := smartsuite.NewClient(apiURL, apiKey)
+		format, err := outputFormat(cmd)
 		if err != nil {
-			slog.Error("Failed to create API client", "error", err)
+			slog.Error("Invalid output format", "error", err)
 			os.Exit(1)
 		}
 
-		s, err := store.NewStore(dataDir)
+		client, s, err := setup(cmd)
 		if err != nil {
-			slog.Error("Failed to create store", "error", err)
+			slog.Error("Failed to set up command", "error", err)
 			os.Exit(1)
 		}
+		defer s.Close()
 
 		inputData, err := os.ReadFile(fromFile)
 		if err != nil {
@@ -60,6 +51,21 @@ var createGroupCmd = &cobra.Command{
 
 		targetGroupName := newGroup.DisplayName
 
+		// --- Validation ---
+		slog.Info("Validating group existence before creation...", "group_name", targetGroupName)
+
+		// 1. Check the API first for the most up-to-date information.
+		existingGroup, err := client.GetGroupByDisplayName(ctx, targetGroupName)
+		if err != nil {
+			slog.Error("Failed to search for group via API", "group_name", targetGroupName, "error", err)
+			os.Exit(exitCode(err))
+		}
+		if existingGroup != nil {
+			slog.Error("Group already exists in SmartSuite. Cannot create a duplicate.", "group_name", targetGroupName, "scim_id", existingGroup.ID)
+			os.Exit(1)
+		}
+
+		// 2. As a secondary check, ensure it isn't in our local store either.
 		groupStore, err := s.LoadGroups()
 		if err != nil {
 			slog.Error("Failed to load local group store", "error", err)
@@ -67,26 +73,45 @@ var createGroupCmd = &cobra.Command{
 		}
 
 		if _, exists := groupStore[targetGroupName]; exists {
-			slog.Error("Group with this name already exists in the local store.", "group_name", targetGroupName)
+			slog.Error("Group with this name already exists in the local store. Run 'refresh' to sync state.", "group_name", targetGroupName)
 			os.Exit(1)
 		}
 
-		logAndAudit(s, "CreateGroup", targetGroupName, "info", "Attempting to create group...")
+		logAndAudit(ctx, s, "CreateGroup", targetGroupName, "info", "Attempting to create group...")
 
 		createdGroup, err := client.CreateGroup(ctx, newGroup)
 		if err != nil {
-			logAndAudit(s, "CreateGroup", targetGroupName, "fatal", "Failed to create group via API", "error", err)
+			logAndAudit(ctx, s, "CreateGroup", targetGroupName, "fatal", "Failed to create group via API", "error", err)
+			os.Exit(exitCode(err))
 		}
 
-		groupStore[createdGroup.DisplayName] = models.GroupRecord{
-			SCIMID: createdGroup.ID,
-		}
+		record := newGroupRecord(*createdGroup)
+		groupStore[createdGroup.DisplayName] = record
 
 		if err := s.SaveGroups(groupStore); err != nil {
-			logAndAudit(s, "CreateGroup", targetGroupName, "fatal", "API group creation succeeded, but failed to save to local store. MANUAL INTERVENTION REQUIRED.", "error", err)
+			logAndAudit(ctx, s, "CreateGroup", targetGroupName, "fatal", "API group creation succeeded, but failed to save to local store. MANUAL INTERVENTION REQUIRED.", "scim_id", createdGroup.ID, "error", err)
+			os.Exit(1)
 		}
 
-		logAndAudit(s, "CreateGroup", targetGroupName, "info", "Successfully created group.", "scim_id", createdGroup.ID)
+		logAndAudit(ctx, s, "CreateGroup", targetGroupName, "info", "Successfully created group.", "scim_id", createdGroup.ID)
+
+		if outFile != "" {
+			if err := writeResource(outFile, createdGroup); err != nil {
+				slog.Error("Group was created, but writing the created resource failed", "scim_id", createdGroup.ID, "error", err)
+				os.Exit(1)
+			}
+		}
+		if err := printResult(cmd, format, operationResult{Status: "created", Target: createdGroup.DisplayName, SCIMID: createdGroup.ID, Record: record}); err != nil {
+			slog.Error("Group was created, but printing the result failed", "error", err)
+			os.Exit(1)
+		}
 		slog.Info("Create group process completed successfully.")
 	},
 }
+
+func init() {
+	createGroupCmd.Flags().String("from-file", "", "Path to the JSON file containing the new group's name.")
+	createGroupCmd.MarkFlagRequired("from-file")
+	createGroupCmd.Flags().String("out", "", "Write the created group, as returned by the API, to this file ('-' for stdout).")
+	addOutputFlag(createGroupCmd)
+}
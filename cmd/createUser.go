@@ -1,16 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"os"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var createUserCmd = &cobra.Command{
@@ -21,26 +20,20 @@ user does not already exist in SmartSuite, then creates the user and updates the
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := cmd.Context()
 		fromFile, _ := cmd.Flags().GetString("from-file")
+		outFile, _ := cmd.Flags().GetString("out")
 		slog.Info("Starting create-user process", "from_file", fromFile)
-
-		apiURL := viper.GetString("api_url")
-		apiKey := viper.GetString("api_key")
-		dataDir := viper.GetString("data_dir")
-		if dataDir == "" {
-			dataDir = "./data"
-		}
-
-		client, err := smartsuite.NewClient(apiURL, apiKey)
+		format, err := outputFormat(cmd)
 		if err != nil {
-			slog.Error("Failed to create API client", "error", err)
+			slog.Error("Invalid output format", "error", err)
 			os.Exit(1)
 		}
 
-		s, err := store.NewStore(dataDir)
+		client, s, err := setup(cmd)
 		if err != nil {
-			slog.Error("Failed to create store", "error", err)
+			slog.Error("Failed to set up command", "error", err)
 			os.Exit(1)
 		}
+		defer s.Close()
 
 		inputData, err := os.ReadFile(fromFile)
 		if err != nil {
@@ -64,52 +57,89 @@ user does not already exist in SmartSuite, then creates the user and updates the
 		// --- Validation ---
 		slog.Info("Validating user existence before creation...", "eppn", targetEPPN)
 
-		// 1. Check the API first for the most up-to-date information.
-		existingUser, err := client.GetUserByUsername(ctx, targetEPPN)
+		userStore, err := s.LoadUsers()
 		if err != nil {
-			slog.Error("Failed to search for user via API", "eppn", targetEPPN, "error", err)
-			os.Exit(1)
-		}
-		if existingUser != nil {
-			slog.Error("User already exists in SmartSuite. Cannot create a duplicate.", "eppn", targetEPPN, "scim_id", existingUser.ID)
+			slog.Error("Failed to load local user store", "error", err)
 			os.Exit(1)
 		}
 
-		// 2. As a secondary check, ensure they aren't in our local store either.
-		userStore, err := s.LoadUsers()
+		existingUser, inStore, err := lookupUser(ctx, client, userStore, targetEPPN)
 		if err != nil {
-			slog.Error("Failed to load local user store", "error", err)
+			slog.Error("Failed to search for user via API", "eppn", targetEPPN, "error", err)
+			os.Exit(exitCode(err))
+		}
+		if existingUser != nil {
+			slog.Error("User already exists in SmartSuite. Cannot create a duplicate.", "eppn", targetEPPN, "scim_id", existingUser.ID)
 			os.Exit(1)
 		}
-
-		if _, exists := userStore[targetEPPN]; exists {
+		if inStore {
 			slog.Error("User already exists in the local store. Run 'refresh' to sync state.", "eppn", targetEPPN)
 			os.Exit(1)
 		}
 
 		// --- Execution ---
-		logAndAudit(s, "CreateUser", targetEPPN, "info", "Attempting to create user...")
+		logAndAudit(ctx, s, "CreateUser", targetEPPN, "info", "Attempting to create user...")
 
 		createdUser, err := client.CreateUser(ctx, newUser)
 		if err != nil {
-			logAndAudit(s, "CreateUser", targetEPPN, "fatal", "Failed to create user via API", "error", err)
+			logAndAudit(ctx, s, "CreateUser", targetEPPN, "fatal", "Failed to create user via API", "error", err)
+			os.Exit(exitCode(err))
+		}
+		if createdUser.ID == "" {
+			logAndAudit(ctx, s, "CreateUser", targetEPPN, "fatal", "API accepted the new user but returned no SCIM id. Run 'refresh' to pick it up. MANUAL INTERVENTION REQUIRED.")
+			os.Exit(1)
 		}
 
 		// --- Success Path ---
-		userStore[createdUser.UserName] = models.UserRecord{
-			SCIMID:       createdUser.ID,
-			Email:        createdUser.Emails[0].Value,
-			Status:       "active",
-			Name:         createdUser.Name,
-			Title:        createdUser.Title,
-			Organization: createdUser.EnterpriseData.Organization,
+		// Servers may answer with a partial representation; fall back to what was sent.
+		eppn := createdUser.UserName
+		if eppn == "" {
+			eppn = targetEPPN
 		}
+		if len(createdUser.Emails) == 0 {
+			slog.Warn("Created user has no email address; storing it without one.", "eppn", eppn, "scim_id", createdUser.ID)
+		}
+		record := newCreatedUserRecord(*createdUser)
+		resolveManager(s, &record)
+		userStore[eppn] = record
 
 		if err := s.SaveUsers(userStore); err != nil {
-			logAndAudit(s, "CreateUser", targetEPPN, "fatal", "API user creation succeeded, but failed to save to local store. MANUAL INTERVENTION REQUIRED.", "error", err)
+			logAndAudit(ctx, s, "CreateUser", targetEPPN, "fatal", "API user creation succeeded, but failed to save to local store. MANUAL INTERVENTION REQUIRED.", "scim_id", createdUser.ID, "error", err)
+			os.Exit(1)
 		}
 
-		logAndAudit(s, "CreateUser", targetEPPN, "info", "Successfully created user.", "scim_id", createdUser.ID)
+		logAndAudit(ctx, s, "CreateUser", targetEPPN, "info", "Successfully created user.", "scim_id", createdUser.ID)
+
+		if outFile != "" {
+			if err := writeResource(outFile, createdUser); err != nil {
+				slog.Error("User was created, but writing the created resource failed", "scim_id", createdUser.ID, "error", err)
+				os.Exit(1)
+			}
+		}
+		if err := printResult(cmd, format, operationResult{Status: "created", Target: eppn, SCIMID: createdUser.ID, Record: record}); err != nil {
+			slog.Error("User was created, but printing the result failed", "error", err)
+			os.Exit(1)
+		}
 		slog.Info("Create user process completed successfully.")
 	},
 }
+
+// lookupUser is the duplicate detection run before a user is created. It
+// checks the API first, for the most up-to-date information, and returns the
+// user if eppn already exists in SmartSuite; as a secondary check it reports
+// whether eppn is in the local store.
+func lookupUser(ctx context.Context, client *smartsuite.Client, userStore map[string]models.UserRecord, eppn string) (*models.SCIMUser, bool, error) {
+	existing, err := client.GetUserByUsername(ctx, eppn)
+	if err != nil {
+		return nil, false, err
+	}
+	_, inStore := userStore[eppn]
+	return existing, inStore, nil
+}
+
+func init() {
+	createUserCmd.Flags().String("from-file", "", "Path to the JSON file containing the new user's attributes.")
+	createUserCmd.MarkFlagRequired("from-file")
+	createUserCmd.Flags().String("out", "", "Write the created user, as returned by the API, to this file ('-' for stdout).")
+	addOutputFlag(createUserCmd)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+func TestCreateUserOutWritesCreatedUser(t *testing.T) {
+	fake := newFakeSCIM(t)
+	dataDir := seedDataDir(t, map[string]models.UserRecord{})
+	input := writeFile(t, "alice.json", `{"userName":"alice@example.edu","emails":[{"value":"alice@example.edu","primary":true}]}`)
+	outFile := filepath.Join(t.TempDir(), "created.json")
+
+	runCommand(t, fake, dataDir, "create-user", "--from-file", input, "--out", outFile)
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("reading --out file: %v", err)
+	}
+	var created models.SCIMUser
+	if err := json.Unmarshal(data, &created); err != nil {
+		t.Fatalf("--out file is not a user: %v\n%s", err, data)
+	}
+	if created.ID != "u1" {
+		t.Errorf("created id = %q, want %q", created.ID, "u1")
+	}
+	if created.UserName != "alice@example.edu" {
+		t.Errorf("created userName = %q, want %q", created.UserName, "alice@example.edu")
+	}
+}
+
+func TestCreateUserStoresCreatedUserAsActive(t *testing.T) {
+	fake := newFakeSCIM(t)
+	dataDir := seedDataDir(t, map[string]models.UserRecord{})
+	// The fake echoes the request, so the response leaves out active like a
+	// partial create response would.
+	input := writeFile(t, "alice.json", `{"userName":"alice@example.edu","emails":[{"value":"alice@example.edu","primary":true}]}`)
+
+	runCommand(t, fake, dataDir, "create-user", "--from-file", input)
+
+	reader, err := store.NewStore(dataDir, store.WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := reader.LoadUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := users["alice@example.edu"]
+	if record.Status != "active" {
+		t.Errorf("stored status = %q, want %q", record.Status, "active")
+	}
+}
+
+// createFailures are SmartSuite create responses that create-user must treat
+// as failures, keyed by the name TestCreateUserExitsOnFailedCreate runs them under.
+var createFailures = map[string]struct {
+	status int
+	body   string
+	want   string
+}{
+	"api error": {http.StatusBadRequest, `{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"400","detail":"invalid user"}`, "Failed to create user via API"},
+	"no id":     {http.StatusCreated, `{"userName":"alice@example.edu"}`, "returned no SCIM id"},
+}
+
+// TestCreateUserExitsOnFailedCreate runs create-user in a subprocess, since it
+// exits, and checks that a failed create ends it with a logged error and a
+// non-zero status rather than a panic.
+func TestCreateUserExitsOnFailedCreate(t *testing.T) {
+	if name := os.Getenv("CREATE_USER_FAILURE"); name != "" {
+		failure := createFailures[name]
+		fake := &fakeSCIM{Server: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				w.Write([]byte(`{"totalResults":0,"Resources":[]}`))
+				return
+			}
+			w.WriteHeader(failure.status)
+			w.Write([]byte(failure.body))
+		}))}
+		defer fake.Close()
+		dataDir := seedDataDir(t, map[string]models.UserRecord{})
+		input := writeFile(t, "alice.json", `{"userName":"alice@example.edu","emails":[{"value":"alice@example.edu","primary":true}]}`)
+		runCommand(t, fake, dataDir, "create-user", "--from-file", input)
+		return
+	}
+
+	for name, failure := range createFailures {
+		t.Run(name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestCreateUserExitsOnFailedCreate$")
+			cmd.Env = append(os.Environ(), "CREATE_USER_FAILURE="+name)
+			out, err := cmd.CombinedOutput()
+
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() == 0 {
+				t.Fatalf("create-user exited with %v, want a non-zero status\n%s", err, out)
+			}
+			if strings.Contains(string(out), "panic") {
+				t.Errorf("create-user panicked:\n%s", out)
+			}
+			if !strings.Contains(string(out), failure.want) {
+				t.Errorf("output does not mention %q:\n%s", failure.want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/cobra"
+)
+
+var deactivateStaleCmd = &cobra.Command{
+	Use:   "deactivate-stale",
+	Short: "Deactivates active users with no activity in the last N days.",
+	Long: `Fetches all users from SmartSuite and deactivates every active user whose last
+activity is older than --inactive-days. SmartSuite's SCIM API does not expose a
+last-login time, so the resource's meta.lastModified is used as the activity signal.
+Users with no recorded activity are skipped unless --no-activity=stale is given.
+Only users known to the local store are deactivated; run 'refresh' first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		inactiveDays, _ := cmd.Flags().GetInt("inactive-days")
+		noActivity, _ := cmd.Flags().GetString("no-activity")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		slog.Info("Starting stale user deactivation", "inactive_days", inactiveDays, "no_activity", noActivity, "dry_run", dryRun)
+
+		if inactiveDays <= 0 {
+			slog.Error("--inactive-days must be a positive number of days.")
+			os.Exit(1)
+		}
+		if noActivity != "skip" && noActivity != "stale" {
+			slog.Error("--no-activity must be 'skip' or 'stale'.", "value", noActivity)
+			os.Exit(1)
+		}
+
+		client, s, err := setup(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		userStore, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load local user store", "error", err)
+			os.Exit(1)
+		}
+
+		scimUsers, err := client.GetUsers(ctx, userListOrder)
+		if err != nil {
+			slog.Error("Failed to get users from API", "error", err)
+			os.Exit(exitCode(err))
+		}
+
+		now := time.Now()
+		cutoff := now.Add(-time.Duration(inactiveDays) * 24 * time.Hour)
+		stale := selectStaleUsers(scimUsers, cutoff, noActivity == "stale")
+		if len(stale) == 0 {
+			slog.Info("No stale users found. Nothing to do.")
+			return
+		}
+		slog.Info("Found stale users.", "count", len(stale))
+
+		var failed []string
+		for _, u := range stale {
+			if ctx.Err() != nil {
+				slog.Warn("Shutdown signal received during deactivation. Halting.", "reason", ctx.Err())
+				break
+			}
+			if _, ok := userStore[u.UserName]; !ok {
+				slog.Warn("Stale user is not in the local store. Skipping.", "eppn", u.UserName, "scim_id", u.ID)
+				continue
+			}
+			if dryRun {
+				fmt.Fprintf(cmd.OutOrStdout(), "would deactivate %s (scim_id %s), last active %s\n", u.UserName, u.ID, formatTime(u.LastActivity(), now))
+				continue
+			}
+
+			logAndAudit(ctx, s, "DeactivateStale", u.UserName, "info", "Attempting to deactivate stale user.", "last_activity", u.LastActivity())
+			if err := deactivateUser(ctx, client, s, userStore, u.UserName); err != nil {
+				if exitCode(err) == exitMaintenance {
+					slog.Error("Tenant is in maintenance. Halting deactivation.", "error", err)
+					os.Exit(exitMaintenance)
+				}
+				logAndAudit(ctx, s, "DeactivateStale", u.UserName, "error", "Failed to deactivate stale user", "error", err)
+				failed = append(failed, u.UserName)
+				continue
+			}
+			logAndAudit(ctx, s, "DeactivateStale", u.UserName, "info", "Successfully deactivated stale user.")
+		}
+
+		if len(failed) > 0 {
+			slog.Warn("Some stale users failed to be deactivated.", "count", len(failed), "failed_eppns", failed)
+			os.Exit(1)
+		}
+		slog.Info("Stale user deactivation completed successfully.")
+	},
+}
+
+// selectStaleUsers returns the active users whose last activity is before
+// cutoff, ordered by userName. Users with no recorded activity are included
+// only when treatUnknownAsStale is set.
+func selectStaleUsers(users []models.SCIMUser, cutoff time.Time, treatUnknownAsStale bool) []models.SCIMUser {
+	var stale []models.SCIMUser
+	for _, u := range users {
+		if !u.Active || u.UserName == "" {
+			continue
+		}
+		last := u.LastActivity()
+		if last == nil {
+			if treatUnknownAsStale {
+				stale = append(stale, u)
+			}
+			continue
+		}
+		if last.Before(cutoff) {
+			stale = append(stale, u)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].UserName < stale[j].UserName })
+	return stale
+}
+
+func init() {
+	deactivateStaleCmd.Flags().Int("inactive-days", 0, "Deactivate users whose last activity is older than this many days.")
+	deactivateStaleCmd.MarkFlagRequired("inactive-days")
+	deactivateStaleCmd.Flags().String("no-activity", "skip", "How to treat users with no recorded activity: 'skip' or 'stale'.")
+	deactivateStaleCmd.Flags().Bool("dry-run", false, "List the users that would be deactivated without changing anything.")
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// userActiveAt returns an active user whose last activity was age ago, or who
+// has no recorded activity when age is negative.
+func userActiveAt(userName string, now time.Time, age time.Duration) models.SCIMUser {
+	u := models.SCIMUser{ID: userName, UserName: userName, Active: true}
+	if age >= 0 {
+		last := now.Add(-age)
+		u.Meta = &models.SCIMMeta{LastModified: &last}
+	}
+	return u
+}
+
+func TestSelectStaleUsers(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	cutoff := now.Add(-90 * day)
+
+	inactive := userActiveAt("inactive@example.edu", now, 400*day)
+	inactive.Active = false
+	users := []models.SCIMUser{
+		userActiveAt("yesterday@example.edu", now, day),
+		userActiveAt("day89@example.edu", now, 89*day),
+		userActiveAt("day90@example.edu", now, 90*day),
+		userActiveAt("day91@example.edu", now, 91*day),
+		userActiveAt("year@example.edu", now, 365*day),
+		userActiveAt("never@example.edu", now, -1),
+		inactive,
+	}
+
+	tests := []struct {
+		name                string
+		treatUnknownAsStale bool
+		want                []string
+	}{
+		{
+			name: "unknown activity skipped",
+			want: []string{"day91@example.edu", "year@example.edu"},
+		},
+		{
+			name:                "unknown activity stale",
+			treatUnknownAsStale: true,
+			want:                []string{"day91@example.edu", "never@example.edu", "year@example.edu"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, u := range selectStaleUsers(users, cutoff, tt.treatUnknownAsStale) {
+				got = append(got, u.UserName)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectStaleUsers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var deactivateUserCmd = &cobra.Command{
+	Use:   "deactivate-user",
+	Short: "Deactivates a single user.",
+	Long: `Sets active=false on the given user in SmartSuite and records the deactivation
+in the local store, exactly as a 'deactivate' task in process-batch would. The
+user becomes eligible for cleanup-users once the 7-day grace period has passed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		eppn, _ := cmd.Flags().GetString("user")
+		slog.Info("Starting deactivate-user process", "eppn", eppn)
+		format, err := outputFormat(cmd)
+		if err != nil {
+			slog.Error("Invalid output format", "error", err)
+			os.Exit(1)
+		}
+
+		client, s, err := setup(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
+			os.Exit(1)
+		}
+
+		userStore, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load local user store", "error", err)
+			os.Exit(1)
+		}
+
+		record, ok := userStore[eppn]
+		if !ok {
+			slog.Error("User not found in local store. Run 'refresh' if they were created outside the mediator.", "eppn", eppn)
+			os.Exit(1)
+		}
+		// Deactivating again would reset the timestamp and restart the grace period.
+		if record.Status == "inactive" {
+			slog.Info("User is already deactivated. Nothing to do.", "eppn", eppn, "deactivated_at", record.DeactivationTimestamp)
+			if err := printResult(cmd, format, operationResult{Status: "unchanged", Target: eppn, SCIMID: record.SCIMID, Record: record}); err != nil {
+				slog.Error("Printing the result failed", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		logAndAudit(ctx, s, "DeactivateUser", eppn, "info", "Attempting to deactivate user.", "scim_id", record.SCIMID)
+		if err := deactivateUser(ctx, client, s, userStore, eppn); err != nil {
+			logAndAudit(ctx, s, "DeactivateUser", eppn, "error", "Failed to deactivate user", "error", err)
+			os.Exit(exitCode(err))
+		}
+		logAndAudit(ctx, s, "DeactivateUser", eppn, "info", "Successfully deactivated user.")
+		if err := printResult(cmd, format, operationResult{Status: "deactivated", Target: eppn, SCIMID: record.SCIMID, Record: userStore[eppn]}); err != nil {
+			slog.Error("User was deactivated, but printing the result failed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("User deactivation completed successfully.")
+	},
+}
+
+func init() {
+	deactivateUserCmd.Flags().String("user", "", "The ePPN (userName) of the user to deactivate.")
+	deactivateUserCmd.MarkFlagRequired("user")
+	addOutputFlag(deactivateUserCmd)
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Shows how the local store differs from SmartSuite without changing either.",
+	Long: `Runs the same comparison as refresh — users and groups created, deleted or
+changed in SmartSuite outside of the mediator — but only prints the result. The
+local store is opened read-only and nothing is written to it, not even the
+audit log. With --exit-code the command exits with status 1 when any drift is
+found, for use as a monitoring check.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		format, _ := cmd.Flags().GetString("format")
+		exitOnDrift, _ := cmd.Flags().GetBool("exit-code")
+		if format != "text" && format != "json" {
+			slog.Error("--format must be 'text' or 'json'.", "value", format)
+			os.Exit(1)
+		}
+
+		client, s, err := setupReadOnly(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		oldUsers, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load local user store", "error", err)
+			os.Exit(1)
+		}
+		oldGroups, err := s.LoadGroups()
+		if err != nil {
+			slog.Error("Failed to load group store", "error", err)
+			os.Exit(1)
+		}
+
+		users, err := detectUserDrift(ctx, client, oldUsers)
+		if err != nil {
+			slog.Error("Failed to compare users", "error", err)
+			os.Exit(exitCode(err))
+		}
+		groups, err := detectGroupDrift(ctx, client, oldGroups)
+		if err != nil {
+			slog.Error("Failed to compare groups", "error", err)
+			os.Exit(exitCode(err))
+		}
+
+		report := newDriftReport(s, oldUsers, users, oldGroups, groups)
+		if format == "json" {
+			if err := writeResource("-", report); err != nil {
+				slog.Error("Failed to write diff", "error", err)
+				os.Exit(1)
+			}
+		} else {
+			report.writeText(cmd.OutOrStdout())
+		}
+
+		if exitOnDrift && !report.empty() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	diffCmd.Flags().String("format", "text", "Output format: 'text' or 'json' (the same layout as refresh --report).")
+	diffCmd.Flags().Bool("exit-code", false, "Exit with status 1 when any drift is found.")
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+// Full reads of SmartSuite page through users and groups in a fixed order,
+// so that consecutive reads see the same pages even if nothing else does.
+var (
+	userListOrder  = smartsuite.ListOptions{SortBy: "userName"}
+	groupListOrder = smartsuite.ListOptions{SortBy: "displayName"}
+)
+
+// userDrift is what differs between the users in the local store and in
+// SmartSuite. Every list is sorted by ePPN.
+type userDrift struct {
+	Live    map[string]models.UserRecord // SmartSuite's users, keyed like the store
+	Created []string
+	Deleted []string
+	Renamed []userRename
+	Changed []userChange
+	// Duplicates maps each userName shared by several SmartSuite users to
+	// their SCIM ids, the one kept in Live first.
+	Duplicates map[string][]string
+}
+
+// userRename is a stored user whose userName was changed in SmartSuite.
+type userRename struct {
+	From, To string
+}
+
+// userChange is a user whose tracked attributes differ.
+type userChange struct {
+	EPPN   string
+	Deltas []userDelta
+}
+
+// groupDrift is what differs between the groups in the local store and in
+// SmartSuite. Every list is sorted by display name.
+type groupDrift struct {
+	Live    map[string]models.GroupRecord // SmartSuite's groups, keyed like the store
+	Created []string
+	Deleted []string
+	Changed []groupChange
+}
+
+// groupChange is a group whose external id or members differ. Added and
+// Removed hold member SCIM ids.
+type groupChange struct {
+	Name                         string
+	FromExternalID, ToExternalID string
+	Added, Removed               []string
+}
+
+// detectUserDrift fetches every user from SmartSuite and compares them with
+// oldState. It only reads, from SmartSuite and nowhere else.
+func detectUserDrift(ctx context.Context, client *smartsuite.Client, oldState map[string]models.UserRecord) (*userDrift, error) {
+	scimUsers, err := client.GetUsers(ctx, userListOrder)
+	if err != nil {
+		return nil, err
+	}
+	drift := &userDrift{}
+	drift.Live, drift.Duplicates = userRecords(scimUsers)
+	resolveManagers(drift.Live)
+
+	// Users missing from the listing are double-checked by SCIM id before being
+	// reported as deleted: a user whose userName was changed in SmartSuite shows
+	// up under a new key, and should be reported as a rename instead.
+	renamedTo := make(map[string]bool)
+	for _, eppn := range slices.Sorted(maps.Keys(oldState)) {
+		if _, ok := drift.Live[eppn]; ok {
+			continue
+		}
+		oldUser := oldState[eppn]
+		if oldUser.SCIMID == "" {
+			// Without an id there is nothing to fetch; GET /Users/ would
+			// list every user instead.
+			slog.Warn("User is missing from the user listing and has no SCIM ID to check; treating it as deleted.", "eppn", eppn)
+			drift.Deleted = append(drift.Deleted, eppn)
+			continue
+		}
+		liveUser, err := client.GetUserByID(ctx, oldUser.SCIMID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case liveUser == nil:
+			drift.Deleted = append(drift.Deleted, eppn)
+		case liveUser.UserName != eppn:
+			renamedTo[liveUser.UserName] = true
+			drift.Renamed = append(drift.Renamed, userRename{From: eppn, To: liveUser.UserName})
+		default:
+			slog.Warn("User is missing from the user listing but still exists when fetched by id.", "eppn", eppn, "scim_id", oldUser.SCIMID)
+		}
+	}
+
+	for _, eppn := range slices.Sorted(maps.Keys(drift.Live)) {
+		newUser := drift.Live[eppn]
+		oldUser, ok := oldState[eppn]
+		if !ok {
+			if !renamedTo[eppn] {
+				drift.Created = append(drift.Created, eppn)
+			}
+			continue
+		}
+		if !modifiedSince(oldUser.LastModified, newUser.LastModified) {
+			continue
+		}
+		if deltas := detectUserDeltas(oldUser, newUser); len(deltas) > 0 {
+			drift.Changed = append(drift.Changed, userChange{EPPN: eppn, Deltas: deltas})
+		}
+	}
+	return drift, nil
+}
+
+// detectGroupDrift fetches every group from SmartSuite and compares them with
+// oldState. It only reads, from SmartSuite and nowhere else.
+func detectGroupDrift(ctx context.Context, client *smartsuite.Client, oldState map[string]models.GroupRecord) (*groupDrift, error) {
+	scimGroups, err := client.GetGroups(ctx, groupListOrder)
+	if err != nil {
+		return nil, err
+	}
+	drift := &groupDrift{Live: make(map[string]models.GroupRecord)}
+	for _, g := range scimGroups {
+		if g.DisplayName == "" {
+			continue
+		}
+		drift.Live[g.DisplayName] = newGroupRecord(g)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(drift.Live)) {
+		newGroup := drift.Live[name]
+		oldGroup, ok := oldState[name]
+		if !ok {
+			drift.Created = append(drift.Created, name)
+			continue
+		}
+		change := groupChange{Name: name, FromExternalID: oldGroup.ExternalID, ToExternalID: newGroup.ExternalID}
+		change.Added, change.Removed = memberChanges(oldGroup.Members, newGroup.Members)
+		if change.FromExternalID != change.ToExternalID || len(change.Added) > 0 || len(change.Removed) > 0 {
+			drift.Changed = append(drift.Changed, change)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(oldState)) {
+		if _, ok := drift.Live[name]; !ok {
+			drift.Deleted = append(drift.Deleted, name)
+		}
+	}
+	return drift, nil
+}
+
+// modifiedSince reports whether a resource may have changed between two reads,
+// judged by meta.lastModified. If either read lacks it, the resource is
+// assumed to have changed.
+func modifiedSince(old, new *time.Time) bool {
+	if old == nil || new == nil {
+		return true
+	}
+	return new.After(*old)
+}
+
+// memberChanges returns the SCIM ids in new but not old, and in old but not
+// new.
+func memberChanges(old, new []string) (added, removed []string) {
+	for _, id := range new {
+		if !slices.Contains(old, id) {
+			added = append(added, id)
+		}
+	}
+	for _, id := range old {
+		if !slices.Contains(new, id) {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed
+}
+
+// memberLabel identifies a group member by ePPN, or by the raw SCIM id when
+// the member is not in the local user store.
+func memberLabel(s *store.Store, scimID string) string {
+	if _, eppn, ok := s.UserBySCIMID(scimID); ok {
+		return eppn
+	}
+	return scimID
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+func TestDetectUserDriftChecksMissingUsersByID(t *testing.T) {
+	// carol was renamed in SmartSuite, so the listing only has her new
+	// userName; dave was deleted; erin was stored without a SCIM ID.
+	fake := newFakeSCIM(t,
+		models.SCIMUser{ID: "a1", UserName: "alice@example.edu", Active: true},
+		models.SCIMUser{ID: "c3", UserName: "carol@new.example.edu", Active: true},
+	)
+	oldState := map[string]models.UserRecord{
+		"alice@example.edu": {SCIMID: "a1", Status: "active"},
+		"carol@example.edu": {SCIMID: "c3", Status: "active"},
+		"dave@example.edu":  {SCIMID: "d4", Status: "active"},
+		"erin@example.edu":  {Status: "active"},
+	}
+
+	drift, err := detectUserDrift(context.Background(), fake.client(t), oldState)
+	if err != nil {
+		t.Fatalf("detectUserDrift: %v", err)
+	}
+
+	wantRenamed := []userRename{{From: "carol@example.edu", To: "carol@new.example.edu"}}
+	if !reflect.DeepEqual(drift.Renamed, wantRenamed) {
+		t.Errorf("Renamed = %v, want %v", drift.Renamed, wantRenamed)
+	}
+	if want := []string{"dave@example.edu", "erin@example.edu"}; !reflect.DeepEqual(drift.Deleted, want) {
+		t.Errorf("Deleted = %v, want %v", drift.Deleted, want)
+	}
+	if len(drift.Created) != 0 {
+		t.Errorf("Created = %v, want none: the rename is not a new user", drift.Created)
+	}
+
+	calls := fake.calls()
+	for _, want := range []string{"GET /Users/c3", "GET /Users/d4"} {
+		if !slices.Contains(calls, want) {
+			t.Errorf("requests %v do not include %s", calls, want)
+		}
+	}
+	if slices.Contains(calls, "GET /Users/") {
+		t.Errorf("requests %v fetched the user without a SCIM ID", calls)
+	}
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Column layouts of export's CSV output. Columns are only ever appended, so
+// consumers that read by position keep working.
+var (
+	exportUserColumns  = []string{"eppn", "scim_id", "external_id", "email", "status", "title", "organization", "department", "cost_center", "division", "employee_number", "phone", "manager", "deactivation_timestamp", "last_modified"}
+	exportGroupColumns = []string{"display_name", "scim_id", "external_id", "member_count", "members"}
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the local store as CSV or JSON.",
+	Long: `Writes every user or group in the local store to a CSV or JSON file for
+reporting and offline analysis. JSON output is an array of records sorted by
+ePPN or display name. This command is read-only and makes no API calls.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		exportType, _ := cmd.Flags().GetString("type")
+		format, _ := cmd.Flags().GetString("format")
+		outFile, _ := cmd.Flags().GetString("out")
+
+		if exportType != "users" && exportType != "groups" {
+			slog.Error("--type must be 'users' or 'groups'.", "value", exportType)
+			os.Exit(1)
+		}
+		if format != "csv" && format != "json" {
+			slog.Error("--format must be 'csv' or 'json'.", "value", format)
+			os.Exit(1)
+		}
+
+		s, err := newReadOnlyStore(resolveDataDir())
+		if err != nil {
+			slog.Error("Failed to open store", "error", err)
+			os.Exit(1)
+		}
+
+		out := cmd.OutOrStdout()
+		if outFile != "-" {
+			f, err := os.Create(outFile)
+			if err != nil {
+				slog.Error("Failed to create output file", "file", outFile, "error", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		var count int
+		var exportErr error
+		if exportType == "users" {
+			users, err := s.LoadUsers()
+			if err != nil {
+				slog.Error("Failed to load local user store", "error", err)
+				os.Exit(1)
+			}
+			listed := filterUsers(users, "", "")
+			count = len(listed)
+			exportErr = exportUsers(out, listed, format)
+		} else {
+			groups, err := s.LoadGroups()
+			if err != nil {
+				slog.Error("Failed to load group store", "error", err)
+				os.Exit(1)
+			}
+			listed := sortedGroups(groups)
+			count = len(listed)
+			exportErr = exportGroups(out, listed, format)
+		}
+		if exportErr != nil {
+			slog.Error("Failed to write export", "error", exportErr)
+			os.Exit(1)
+		}
+		slog.Info("Export complete.", "type", exportType, "format", format, "count", count, "out", outFile)
+	},
+}
+
+// exportUsers writes users as a JSON array or as CSV with exportUserColumns.
+func exportUsers(out io.Writer, users []listedUser, format string) error {
+	if format == "json" {
+		if users == nil {
+			users = []listedUser{}
+		}
+		return writeJSONArray(out, users)
+	}
+	w := csv.NewWriter(out)
+	w.Write(exportUserColumns)
+	for _, u := range users {
+		w.Write([]string{
+			u.EPPN, u.SCIMID, u.ExternalID, u.Email, u.Status, u.Title, u.Organization,
+			u.Department, u.CostCenter, u.Division, u.EmployeeNumber, u.Phone, u.Manager,
+			exportTime(u.DeactivationTimestamp), exportTime(u.LastModified),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// exportGroups writes groups as a JSON array or as CSV with
+// exportGroupColumns. Members are the SCIM ids separated by semicolons.
+func exportGroups(out io.Writer, groups []listedGroup, format string) error {
+	if format == "json" {
+		return writeJSONArray(out, groups)
+	}
+	w := csv.NewWriter(out)
+	w.Write(exportGroupColumns)
+	for _, g := range groups {
+		w.Write([]string{g.DisplayName, g.SCIMID, g.ExternalID, strconv.Itoa(g.MemberCount), strings.Join(g.Members, ";")})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeJSONArray(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode export: %w", err)
+	}
+	return nil
+}
+
+// exportTime renders an optional timestamp as RFC 3339, or empty when unset.
+func exportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func init() {
+	exportCmd.Flags().String("type", "users", "What to export: 'users' or 'groups'.")
+	exportCmd.Flags().String("format", "csv", "Output format: 'csv' or 'json'.")
+	exportCmd.Flags().String("out", "-", "File to write the export to ('-' for stdout).")
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// fakeSCIM is an in-memory SmartSuite for command tests. It lists, filters,
+// creates, fetches, patches and deletes users, lists groups, and records
+// every request as "METHOD /path".
+type fakeSCIM struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	users    []models.SCIMUser
+	groups   []models.SCIMGroup
+	requests []string
+	// listGate, when set, holds every user listing until it is closed or the
+	// request is cancelled.
+	listGate chan struct{}
+}
+
+func newFakeSCIM(t *testing.T, users ...models.SCIMUser) *fakeSCIM {
+	t.Helper()
+	f := &fakeSCIM{users: users}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// client returns a client for the fake that does not retry.
+func (f *fakeSCIM) client(t *testing.T) *smartsuite.Client {
+	t.Helper()
+	c, err := smartsuite.NewClient(f.URL, "test-key", smartsuite.WithMaxRetries(0), smartsuite.WithPageWorkers(1))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return c
+}
+
+// calls returns the requests made so far.
+func (f *fakeSCIM) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.requests)
+}
+
+func (f *fakeSCIM) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	gate := f.listGate
+	f.mu.Unlock()
+
+	resource, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case resource == "Users" && id == "" && r.Method == http.MethodGet:
+		if gate != nil {
+			select {
+			case <-gate:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		f.mu.Lock()
+		var resources []interface{}
+		userName, filtered := strings.CutPrefix(r.URL.Query().Get("filter"), "userName eq ")
+		for _, u := range f.users {
+			if !filtered || strconv.Quote(u.UserName) == userName {
+				resources = append(resources, u)
+			}
+		}
+		f.mu.Unlock()
+		writeList(w, r, resources)
+	case resource == "Users" && id == "" && r.Method == http.MethodPost:
+		var u models.SCIMUser
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		u.ID = fmt.Sprintf("u%d", len(f.users)+1)
+		f.users = append(f.users, u)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(u)
+	case resource == "Groups" && id == "" && r.Method == http.MethodGet:
+		f.mu.Lock()
+		resources := make([]interface{}, len(f.groups))
+		for i, g := range f.groups {
+			resources[i] = g
+		}
+		f.mu.Unlock()
+		writeList(w, r, resources)
+	case resource == "Users" && id != "":
+		f.serveUser(w, r, id)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeSCIM) serveUser(w http.ResponseWriter, r *http.Request, id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := slices.IndexFunc(f.users, func(u models.SCIMUser) bool { return u.ID == id })
+	if i < 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodPatch:
+		json.NewEncoder(w).Encode(f.users[i])
+	case http.MethodDelete:
+		f.users = slices.Delete(f.users, i, i+1)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// writeList writes the page of resources the request's startIndex and count
+// ask for.
+func writeList(w http.ResponseWriter, r *http.Request, resources []interface{}) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	start = max(start, 1)
+	if count <= 0 {
+		count = len(resources)
+	}
+	from := min(start-1, len(resources))
+	to := min(from+count, len(resources))
+	json.NewEncoder(w).Encode(models.ListResponse{
+		TotalResults: len(resources),
+		ItemsPerPage: to - from,
+		StartIndex:   start,
+		Resources:    resources[from:to],
+	})
+}
+
+// seedDataDir returns a fresh data directory holding users.
+func seedDataDir(t *testing.T, users map[string]models.UserRecord) string {
+	t.Helper()
+	dataDir := t.TempDir()
+	s, err := store.NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer s.Close()
+	if err := s.SaveUsers(users); err != nil {
+		t.Fatalf("SaveUsers: %v", err)
+	}
+	return dataDir
+}
+
+// runCommand runs the command line args through the root command against
+// fake and dataDir, and resets the flags and settings it used afterwards.
+func runCommand(t *testing.T, fake *fakeSCIM, dataDir string, args ...string) {
+	t.Helper()
+	settings := map[string]string{"api_url": fake.URL, "api_key": "test-key", "data_dir": dataDir}
+	for key, value := range settings {
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, "") })
+	}
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	t.Cleanup(func() {
+		rootCmd.SetArgs(nil)
+		for _, arg := range args {
+			name, _, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			if f := cmd.Flags().Lookup(name); f != nil && strings.HasPrefix(arg, "--") {
+				f.Value.Set(f.DefValue)
+				f.Changed = false
+			}
+		}
+	})
+	// The root pre-run points the logger at --log-output; keep whatever
+	// logger the test installed, such as captureLogs.
+	installed, preRun := slog.Default(), rootCmd.PersistentPreRun
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		preRun(cmd, args)
+		slog.SetDefault(installed)
+	}
+	t.Cleanup(func() { rootCmd.PersistentPreRun = preRun })
+	rootCmd.SetArgs(args)
+	if err := rootCmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+}
+
+// readAudit returns the events in dataDir's audit log.
+func readAudit(t *testing.T, dataDir string) []models.AuditEvent {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dataDir, "audit.log"))
+	if err != nil {
+		t.Fatalf("opening audit log: %v", err)
+	}
+	defer f.Close()
+	var events []models.AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// writeFile writes content to name in a fresh directory and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// captureLogs routes the default logger to a buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// relativeTime renders t relative to now for human-facing text output, e.g.
+// "3 days ago" or "in 4 hours". JSON output should keep absolute RFC3339 times.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	if d < time.Minute {
+		return "just now"
+	}
+
+	var amount int
+	var unit string
+	switch {
+	case d < time.Hour:
+		amount, unit = int(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		amount, unit = int(d/time.Hour), "hour"
+	case d < 60*24*time.Hour:
+		amount, unit = int(d/(24*time.Hour)), "day"
+	case d < 730*24*time.Hour:
+		amount, unit = int(d/(30*24*time.Hour)), "month"
+	default:
+		amount, unit = int(d/(365*24*time.Hour)), "year"
+	}
+	if amount != 1 {
+		unit += "s"
+	}
+	if future {
+		return fmt.Sprintf("in %d %s", amount, unit)
+	}
+	return fmt.Sprintf("%d %s ago", amount, unit)
+}
+
+// formatTime renders an optional timestamp for text output as the absolute
+// time followed by its relative form, or "-" when t is nil.
+func formatTime(t *time.Time, now time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s)", t.Format(time.RFC3339), relativeTime(*t, now))
+}
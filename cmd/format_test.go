@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{ago: 30 * time.Second, want: "just now"},
+		{ago: time.Minute, want: "1 minute ago"},
+		{ago: 45 * time.Minute, want: "45 minutes ago"},
+		{ago: 3 * time.Hour, want: "3 hours ago"},
+		{ago: 24 * time.Hour, want: "1 day ago"},
+		{ago: 59 * 24 * time.Hour, want: "59 days ago"},
+		{ago: 90 * 24 * time.Hour, want: "3 months ago"},
+		{ago: 800 * 24 * time.Hour, want: "2 years ago"},
+		{ago: -4 * time.Hour, want: "in 4 hours"},
+	}
+	for _, tt := range tests {
+		if got := relativeTime(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("relativeTime(now - %s) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+}
+
+func TestStaleDryRunShowsRelativeTimeAndJSONStaysAbsolute(t *testing.T) {
+	lastActive := time.Now().Add(-100 * 24 * time.Hour).Truncate(time.Second).UTC()
+	stale := models.SCIMUser{ID: "a1", UserName: "alice@example.edu", Active: true, Meta: &models.SCIMMeta{LastModified: &lastActive}}
+	fake := newFakeSCIM(t, stale)
+	dataDir := seedDataDir(t, map[string]models.UserRecord{"alice@example.edu": {SCIMID: "a1", Status: "active"}})
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	t.Cleanup(func() { rootCmd.SetOut(nil) })
+
+	runCommand(t, fake, dataDir, "deactivate-stale", "--inactive-days", "90", "--dry-run")
+
+	want := "last active " + lastActive.Format(time.RFC3339) + " (3 months ago)"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("dry run output = %q, want it to contain %q", out.String(), want)
+	}
+
+	data, err := json.Marshal(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"lastModified":"`+lastActive.Format(time.RFC3339)+`"`) || strings.Contains(string(data), "ago") {
+		t.Errorf("JSON = %s, want an absolute RFC3339 lastModified", data)
+	}
+}
@@ -1,45 +1,220 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/viper"
 )
 
+// exitMaintenance is the exit status used when the tenant is in a maintenance
+// window (EX_TEMPFAIL), so schedulers can tell "try later" from a real failure.
+const exitMaintenance = 75
+
+// exitCode maps an error to the process exit status.
+func exitCode(err error) int {
+	var maintenance *smartsuite.MaintenanceError
+	if errors.As(err, &maintenance) {
+		return exitMaintenance
+	}
+	return 1
+}
+
 // logAndAudit provides a consistent way to log structured messages to the console
-// and also append a human-readable event to the audit.log file.
-func logAndAudit(s *store.Store, useCase, target, level, details string, args ...interface{}) {
+// and also append a human-readable event to the audit.log file. Events are tagged
+// with the transaction ID carried by ctx so that multi-step operations can be grouped.
+// The "fatal" level is logged as an error and audited as fatal; it is up to the
+// caller to stop, so that any cleanup it has left still runs.
+func logAndAudit(ctx context.Context, s *store.Store, useCase, target, level, details string, args ...interface{}) {
+	txnID := transactionID(ctx)
+
 	// Structured logging for console/log collection
-	logArgs := append([]interface{}{"use_case", useCase, "target", target}, args...)
+	logArgs := append([]interface{}{"use_case", useCase, "target", target, "transaction_id", txnID}, args...)
 
 	switch level {
-	//case "info":
-	//	slog.Info(details, logArgs...)
 	case "warn":
 		slog.Warn(details, logArgs...)
-	case "error":
-		slog.Error(details, logArgs...)
-	case "fatal":
-		// Log as error and then exit.
+	case "error", "fatal":
 		slog.Error(details, logArgs...)
-		os.Exit(1)
 	default:
-		//	slog.Info(details, logArgs...)
+		slog.Info(details, logArgs...)
 	}
 
 	// Plain text audit log for human-readable history
 	event := models.AuditEvent{
-		Timestamp: time.Now(),
-		UseCase:   useCase,
-		Target:    target,
-		Status:    level, // The status in the audit log reflects the log level
-		Details:   fmt.Sprintf("%s (%v)", details, args),
+		Timestamp:     time.Now(),
+		TransactionID: txnID,
+		UseCase:       useCase,
+		Target:        target,
+		Status:        level, // The status in the audit log reflects the log level
+		Details:       fmt.Sprintf("%s (%v)", details, args),
 	}
 	if err := s.AppendToAuditLog(event); err != nil {
 		slog.Warn("Failed to write to audit log", "error", err)
 	}
 }
+
+// writeResource writes v as indented JSON to path, or to stdout when path is "-".
+func writeResource(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal resource: %w", err)
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write resource to %s: %w", path, err)
+	}
+	return nil
+}
+
+// userStoreKey returns the key a SCIM user is stored under. Users are keyed by
+// userName; for users without one the missing_username setting decides whether
+// they are skipped (the default) or tracked under their SCIM ID. Skipped users
+// are logged so they do not silently vanish from view.
+func userStoreKey(u models.SCIMUser) (string, bool) {
+	if u.UserName != "" {
+		return u.UserName, true
+	}
+	if viper.GetString("missing_username") == "scim_id" && u.ID != "" {
+		slog.Warn("User has no userName. Storing it under its SCIM ID.", "scim_id", u.ID)
+		return u.ID, true
+	}
+	slog.Warn("User has no userName and will not be stored.", "scim_id", u.ID)
+	return "", false
+}
+
+// userRecords converts SCIM users into store records keyed by userStoreKey.
+// SmartSuite can hold several users with the same userName, e.g. after a
+// botched rename; only one of them can be stored, so an active user is kept
+// over an inactive one, and then the one with the lowest SCIM id. Every key
+// held by more than one user is returned in duplicates with the SCIM ids
+// sharing it, the kept one first.
+func userRecords(users []models.SCIMUser) (records map[string]models.UserRecord, duplicates map[string][]string) {
+	records = make(map[string]models.UserRecord, len(users))
+	duplicates = make(map[string][]string)
+	for _, u := range users {
+		key, ok := userStoreKey(u)
+		if !ok {
+			continue
+		}
+		record := newUserRecord(u)
+		existing, taken := records[key]
+		if !taken {
+			records[key] = record
+			continue
+		}
+		if len(duplicates[key]) == 0 {
+			duplicates[key] = []string{existing.SCIMID}
+		}
+		duplicates[key] = append(duplicates[key], record.SCIMID)
+		if preferRecord(record, existing) {
+			records[key] = record
+		}
+	}
+	for key, ids := range duplicates {
+		kept := records[key].SCIMID
+		sort.Slice(ids, func(i, j int) bool {
+			if (ids[i] == kept) != (ids[j] == kept) {
+				return ids[i] == kept
+			}
+			return ids[i] < ids[j]
+		})
+	}
+	return records, duplicates
+}
+
+// preferRecord reports whether a should be stored instead of b when both
+// users have the same userName.
+func preferRecord(a, b models.UserRecord) bool {
+	if (a.Status == "active") != (b.Status == "active") {
+		return a.Status == "active"
+	}
+	return a.SCIMID < b.SCIMID
+}
+
+// newUserRecord converts a SCIM user into the record kept in the local store.
+func newUserRecord(u models.SCIMUser) models.UserRecord {
+	status := "inactive"
+	if u.Active {
+		status = "active"
+	}
+	return models.UserRecord{
+		SCIMID:         u.ID,
+		ExternalID:     u.ExternalID,
+		Email:          u.PrimaryEmail(),
+		Emails:         u.EmailRecords(),
+		Status:         status,
+		Name:           u.Name,
+		Title:          u.Title,
+		Organization:   u.EnterpriseData.Organization,
+		Department:     u.EnterpriseData.Department,
+		CostCenter:     u.EnterpriseData.CostCenter,
+		Division:       u.EnterpriseData.Division,
+		EmployeeNumber: u.EnterpriseData.EmployeeNumber,
+		Phone:          u.PrimaryPhone(),
+		ManagerSCIMID:  u.EnterpriseData.ManagerID(),
+		ETag:           u.Version(),
+		LastModified:   u.Meta.Modified(),
+	}
+}
+
+// newCreatedUserRecord is newUserRecord for a user SmartSuite has just
+// created. A create response may be partial and leave out active, which would
+// store the new user as inactive, so created users are always recorded as
+// active.
+func newCreatedUserRecord(u models.SCIMUser) models.UserRecord {
+	record := newUserRecord(u)
+	record.Status = "active"
+	return record
+}
+
+// newGroupRecord converts a SCIM group into the record kept in the local store.
+func newGroupRecord(g models.SCIMGroup) models.GroupRecord {
+	return models.GroupRecord{SCIMID: g.ID, ExternalID: g.ExternalID, Members: g.MemberIDs(), LastModified: g.Meta.Modified()}
+}
+
+// resolveManagers sets each record's Manager to the ePPN of the user in users
+// whose SCIM id is its ManagerSCIMID. A manager not among users is left
+// unresolved and logged; the next refresh resolves them once they are stored.
+func resolveManagers(users map[string]models.UserRecord) {
+	byID := make(map[string]string, len(users))
+	for eppn, record := range users {
+		byID[record.SCIMID] = eppn
+	}
+	for eppn, record := range users {
+		if record.ManagerSCIMID == "" {
+			continue
+		}
+		record.Manager = byID[record.ManagerSCIMID]
+		if record.Manager == "" {
+			slog.Warn("User's manager is not in the local store yet.", "eppn", eppn, "manager_scim_id", record.ManagerSCIMID)
+		}
+		users[eppn] = record
+	}
+}
+
+// resolveManager sets record's Manager from the store's SCIM id index.
+func resolveManager(s *store.Store, record *models.UserRecord) {
+	if record.ManagerSCIMID == "" {
+		return
+	}
+	record.Manager = ""
+	if _, eppn, ok := s.UserBySCIMID(record.ManagerSCIMID); ok {
+		record.Manager = eppn
+	}
+}
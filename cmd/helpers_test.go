@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+func TestNewUserRecordEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		emails []models.SCIMEmail
+		want   string
+	}{
+		{"no emails", nil, ""},
+		{"several, none primary", []models.SCIMEmail{
+			{Value: "alice@example.edu"},
+			{Value: "alice@alumni.example.edu"},
+		}, "alice@example.edu"},
+		{"several, second primary", []models.SCIMEmail{
+			{Value: "alice@alumni.example.edu"},
+			{Value: "alice@example.edu", Primary: true},
+		}, "alice@example.edu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := newUserRecord(models.SCIMUser{ID: "a1", UserName: "alice@example.edu", Emails: tt.emails})
+			if record.Email != tt.want {
+				t.Errorf("Email = %q, want %q", record.Email, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogAndAuditLogsInfoEvents(t *testing.T) {
+	s, err := store.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	logs := captureLogs(t)
+	ctx := withTransaction(context.Background())
+
+	logAndAudit(ctx, s, "CreateUser", "alice@example.edu", "info", "Successfully created user.", "scim_id", "a1")
+
+	line := logs.String()
+	for _, want := range []string{
+		"level=INFO",
+		`msg="Successfully created user."`,
+		"use_case=CreateUser",
+		"target=alice@example.edu",
+		"transaction_id=" + transactionID(ctx),
+		"scim_id=a1",
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log = %q, want it to contain %q", line, want)
+		}
+	}
+}
+
+func TestUserRecordsKeepsOneUserPerUserName(t *testing.T) {
+	users := []models.SCIMUser{
+		{ID: "c3", UserName: "alice@example.edu", Active: true},
+		{ID: "a1", UserName: "alice@example.edu", Active: false},
+		{ID: "b2", UserName: "alice@example.edu", Active: true},
+		{ID: "d4", UserName: "bob@example.edu", Active: true},
+	}
+
+	records, duplicates := userRecords(users)
+
+	if got := records["alice@example.edu"].SCIMID; got != "b2" {
+		t.Errorf("kept alice = %q, want the active user with the lowest id, b2", got)
+	}
+	if got := records["bob@example.edu"].SCIMID; got != "d4" {
+		t.Errorf("kept bob = %q, want d4", got)
+	}
+	want := map[string][]string{"alice@example.edu": {"b2", "a1", "c3"}}
+	if !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("duplicates = %v, want %v", duplicates, want)
+	}
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/cobra"
+)
+
+// importColumns maps the CSV header names import-users understands, compared
+// case-insensitively, to the SCIM attribute each one sets.
+var importColumns = map[string]func(u *models.SCIMUser, v string){
+	"username":   func(u *models.SCIMUser, v string) { u.UserName = v },
+	"externalid": func(u *models.SCIMUser, v string) { u.ExternalID = v },
+	"givenname":  func(u *models.SCIMUser, v string) { u.Name.GivenName = v },
+	"familyname": func(u *models.SCIMUser, v string) { u.Name.FamilyName = v },
+	"email": func(u *models.SCIMUser, v string) {
+		u.Emails = []models.SCIMEmail{{Value: v, Type: "work", Primary: true}}
+	},
+	"phone": func(u *models.SCIMUser, v string) {
+		u.PhoneNumbers = []models.SCIMPhoneNumber{{Value: v, Type: "work", Primary: true}}
+	},
+	"title":          func(u *models.SCIMUser, v string) { u.Title = v },
+	"organization":   func(u *models.SCIMUser, v string) { u.EnterpriseData.Organization = v },
+	"department":     func(u *models.SCIMUser, v string) { u.EnterpriseData.Department = v },
+	"costcenter":     func(u *models.SCIMUser, v string) { u.EnterpriseData.CostCenter = v },
+	"division":       func(u *models.SCIMUser, v string) { u.EnterpriseData.Division = v },
+	"employeenumber": func(u *models.SCIMUser, v string) { u.EnterpriseData.EmployeeNumber = v },
+}
+
+// importOutcome is how import-users disposed of one row.
+type importOutcome string
+
+const (
+	importCreated importOutcome = "created"
+	importSkipped importOutcome = "skipped"
+	importFailed  importOutcome = "failed"
+)
+
+var importUsersCmd = &cobra.Command{
+	Use:   "import-users",
+	Short: "Seeds the local store from a CSV of users.",
+	Long: `Reads users from a CSV file with a header row. Each user that already exists
+in SmartSuite is skipped and added to the local store if it is missing there.
+With --create, users that do not exist are provisioned with the same duplicate
+checks as create-user; without it they are reported as failed. A failing row
+does not stop the import, and a summary is printed at the end.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		fromFile, _ := cmd.Flags().GetString("from-file")
+		create, _ := cmd.Flags().GetBool("create")
+		slog.Info("Starting import-users process", "from_file", fromFile, "create", create)
+
+		f, err := os.Open(fromFile)
+		if err != nil {
+			slog.Error("Failed to open input file", "file", fromFile, "error", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		rows, err := readImportRows(f)
+		if err != nil {
+			slog.Error("Failed to read input file", "file", fromFile, "error", err)
+			os.Exit(1)
+		}
+
+		client, s, err := setup(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
+			os.Exit(1)
+		}
+		userStore, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load local user store", "error", err)
+			os.Exit(1)
+		}
+
+		counts := make(map[importOutcome]int)
+		for i, newUser := range rows {
+			if ctx.Err() != nil {
+				slog.Warn("Shutdown signal received during import. Halting.", "reason", ctx.Err())
+				break
+			}
+			line := i + 2 // the header is line 1
+			eppn := newUser.UserName
+			if eppn == "" {
+				slog.Error("Row has no userName. Skipping.", "line", line)
+				counts[importFailed]++
+				continue
+			}
+
+			existing, inStore, err := lookupUser(ctx, client, userStore, eppn)
+			if exitCode(err) == exitMaintenance {
+				slog.Error("Tenant is in maintenance. Halting import.", "error", err)
+				writeImportSummary(counts)
+				os.Exit(exitMaintenance)
+			}
+			switch {
+			case err != nil:
+				logAndAudit(ctx, s, "ImportUsers", eppn, "error", "Failed to search for user via API", "line", line, "error", err)
+				counts[importFailed]++
+			case existing != nil:
+				if !inStore {
+					record := newUserRecord(*existing)
+					resolveManager(s, &record)
+					if err := s.UpsertUser(eppn, record); err != nil {
+						logAndAudit(ctx, s, "ImportUsers", eppn, "error", "User exists in SmartSuite but could not be added to the local store", "line", line, "error", err)
+						counts[importFailed]++
+						continue
+					}
+					userStore[eppn] = record
+				}
+				slog.Info("User already exists in SmartSuite. Skipping.", "line", line, "eppn", eppn, "scim_id", existing.ID)
+				counts[importSkipped]++
+			case !create:
+				slog.Error("User does not exist in SmartSuite. Pass --create to provision it.", "line", line, "eppn", eppn)
+				counts[importFailed]++
+			case inStore:
+				slog.Error("User already exists in the local store. Run 'refresh' to sync state.", "line", line, "eppn", eppn)
+				counts[importFailed]++
+			default:
+				if err := importUser(ctx, client, s, userStore, newUser); err != nil {
+					if exitCode(err) == exitMaintenance {
+						slog.Error("Tenant is in maintenance. Halting import.", "error", err)
+						writeImportSummary(counts)
+						os.Exit(exitMaintenance)
+					}
+					logAndAudit(ctx, s, "ImportUsers", eppn, "error", "Failed to create user", "line", line, "error", err)
+					counts[importFailed]++
+					continue
+				}
+				counts[importCreated]++
+			}
+		}
+
+		writeImportSummary(counts)
+		if counts[importFailed] > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// readImportRows parses a CSV with a header row into the users to import.
+// Unknown columns are rejected so a typo does not silently drop an attribute;
+// empty cells leave the attribute unset.
+func readImportRows(r io.Reader) ([]models.SCIMUser, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header row: %w", err)
+	}
+	setters := make([]func(*models.SCIMUser, string), len(header))
+	hasUserName := false
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		setter, ok := importColumns[key]
+		if !ok {
+			known := make([]string, 0, len(importColumns))
+			for column := range importColumns {
+				known = append(known, column)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown column '%s'; known columns are %s", name, strings.Join(known, ", "))
+		}
+		setters[i] = setter
+		hasUserName = hasUserName || key == "username"
+	}
+	if !hasUserName {
+		return nil, errors.New("header row must include a 'userName' column")
+	}
+
+	var users []models.SCIMUser
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		user := models.SCIMUser{Active: true}
+		for i, value := range record {
+			if value = strings.TrimSpace(value); value != "" {
+				setters[i](&user, value)
+			}
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// importUser provisions one user and adds it to the local store.
+func importUser(ctx context.Context, client *smartsuite.Client, s *store.Store, userStore map[string]models.UserRecord, newUser models.SCIMUser) error {
+	eppn := newUser.UserName
+	logAndAudit(ctx, s, "ImportUsers", eppn, "info", "Attempting to create user...")
+	createdUser, err := client.CreateUser(ctx, newUser)
+	if err != nil {
+		return err
+	}
+	if createdUser.ID == "" {
+		return errors.New("API accepted the new user but returned no SCIM id; run 'refresh' to pick it up")
+	}
+
+	record := newCreatedUserRecord(*createdUser)
+	resolveManager(s, &record)
+	if err := s.UpsertUser(eppn, record); err != nil {
+		logAndAudit(ctx, s, "ImportUsers", eppn, "fatal", "API user creation succeeded, but failed to save to local store. MANUAL INTERVENTION REQUIRED.", "scim_id", createdUser.ID, "error", err)
+		return err
+	}
+	userStore[eppn] = record
+	logAndAudit(ctx, s, "ImportUsers", eppn, "info", "Successfully created user.", "scim_id", createdUser.ID)
+	return nil
+}
+
+func writeImportSummary(counts map[importOutcome]int) {
+	slog.Info("Import finished.", "created", counts[importCreated], "skipped", counts[importSkipped], "failed", counts[importFailed])
+}
+
+func init() {
+	importUsersCmd.Flags().String("from-file", "", "Path to the CSV file of users to import.")
+	importUsersCmd.MarkFlagRequired("from-file")
+	importUsersCmd.Flags().Bool("create", false, "Create users that do not exist in SmartSuite instead of reporting them as failed.")
+}
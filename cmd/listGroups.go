@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/cobra"
+)
+
+var listGroupsCmd = &cobra.Command{
+	Use:   "list-groups",
+	Short: "Lists the groups in the local store with their member counts.",
+	Long: `Prints the groups known to the local store, sorted by display name, with the
+number of members recorded at the last populate or refresh. This command is
+read-only and makes no API calls.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		if !validListFormat(format) {
+			slog.Error("--format must be 'table', 'json' or 'csv'.", "value", format)
+			os.Exit(1)
+		}
+
+		dataDir := resolveDataDir()
+		s, err := newReadOnlyStore(dataDir)
+		if err != nil {
+			slog.Error("Failed to open store", "error", err)
+			os.Exit(1)
+		}
+		groupStore, err := s.LoadGroups()
+		if err != nil {
+			slog.Error("Failed to load group store", "error", err)
+			os.Exit(1)
+		}
+
+		if err := writeGroupList(cmd.OutOrStdout(), sortedGroups(groupStore), format); err != nil {
+			slog.Error("Failed to write group list", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// listedGroup is a group record together with its display name, as printed
+// by list-groups.
+type listedGroup struct {
+	DisplayName string `json:"display_name"`
+	models.GroupRecord
+	MemberCount int `json:"member_count"`
+}
+
+// sortedGroups returns the groups ordered by display name.
+func sortedGroups(groups map[string]models.GroupRecord) []listedGroup {
+	listed := make([]listedGroup, 0, len(groups))
+	for name, record := range groups {
+		listed = append(listed, listedGroup{DisplayName: name, GroupRecord: record, MemberCount: len(record.Members)})
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].DisplayName < listed[j].DisplayName })
+	return listed
+}
+
+// writeGroupList prints groups to out as an aligned table, a JSON array, or
+// CSV with a header row.
+func writeGroupList(out io.Writer, groups []listedGroup, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"display_name", "scim_id", "external_id", "member_count"})
+		for _, g := range groups {
+			w.Write([]string{g.DisplayName, g.SCIMID, g.ExternalID, strconv.Itoa(g.MemberCount)})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DISPLAY NAME\tSCIM ID\tEXTERNAL ID\tMEMBERS")
+		for _, g := range groups {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", g.DisplayName, g.SCIMID, g.ExternalID, g.MemberCount)
+		}
+		return w.Flush()
+	}
+}
+
+func init() {
+	listGroupsCmd.Flags().String("format", "table", "Output format: 'table', 'json' or 'csv'.")
+}
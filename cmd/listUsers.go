@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/cobra"
+)
+
+var listUsersCmd = &cobra.Command{
+	Use:   "list-users",
+	Short: "Lists the users in the local store.",
+	Long: `Prints the users known to the local store, sorted by ePPN, optionally filtered
+by status and organization. With --live the users are fetched from SmartSuite
+instead, without updating the store. This command is read-only.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		live, _ := cmd.Flags().GetBool("live")
+		status, _ := cmd.Flags().GetString("status")
+		org, _ := cmd.Flags().GetString("org")
+		format, _ := cmd.Flags().GetString("format")
+
+		if status != "" && status != "active" && status != "inactive" {
+			slog.Error("--status must be 'active' or 'inactive'.", "value", status)
+			os.Exit(1)
+		}
+		if !validListFormat(format) {
+			slog.Error("--format must be 'table', 'json' or 'csv'.", "value", format)
+			os.Exit(1)
+		}
+
+		var users map[string]models.UserRecord
+		if live {
+			client, err := commandClient(cmd)
+			if err != nil {
+				slog.Error("Failed to set up command", "error", err)
+				os.Exit(1)
+			}
+			scimUsers, err := client.GetUsers(ctx, userListOrder)
+			if err != nil {
+				slog.Error("Failed to get users from API", "error", err)
+				os.Exit(exitCode(err))
+			}
+			users = make(map[string]models.UserRecord, len(scimUsers))
+			for _, u := range scimUsers {
+				if key, ok := userStoreKey(u); ok {
+					users[key] = newUserRecord(u)
+				}
+			}
+			resolveManagers(users)
+		} else {
+			dataDir := resolveDataDir()
+			s, err := newReadOnlyStore(dataDir)
+			if err != nil {
+				slog.Error("Failed to open store", "error", err)
+				os.Exit(1)
+			}
+			defer s.Close()
+			users, err = s.LoadUsers()
+			if err != nil {
+				slog.Error("Failed to load local user store", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		listed := filterUsers(users, status, org)
+		if err := writeUserList(cmd.OutOrStdout(), listed, format); err != nil {
+			slog.Error("Failed to write user list", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// validListFormat reports whether format is one the list commands can print.
+func validListFormat(format string) bool {
+	return format == "table" || format == "json" || format == "csv"
+}
+
+// listedUser is a user record together with its store key, as printed by
+// list-users.
+type listedUser struct {
+	EPPN string `json:"eppn"`
+	models.UserRecord
+}
+
+// filterUsers returns the users matching status and org (either may be empty
+// to match all), sorted by ePPN.
+func filterUsers(users map[string]models.UserRecord, status, org string) []listedUser {
+	var listed []listedUser
+	for eppn, record := range users {
+		if status != "" && record.Status != status {
+			continue
+		}
+		if org != "" && record.Organization != org {
+			continue
+		}
+		listed = append(listed, listedUser{EPPN: eppn, UserRecord: record})
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].EPPN < listed[j].EPPN })
+	return listed
+}
+
+// writeUserList prints users to out as an aligned table, a JSON array, or CSV
+// with a header row.
+func writeUserList(out io.Writer, users []listedUser, format string) error {
+	switch format {
+	case "json":
+		if users == nil {
+			users = []listedUser{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(users)
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"eppn", "email", "status", "title", "organization", "scim_id", "external_id"})
+		for _, u := range users {
+			w.Write([]string{u.EPPN, u.Email, u.Status, u.Title, u.Organization, u.SCIMID, u.ExternalID})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "EPPN\tEMAIL\tSTATUS\tTITLE\tORG\tEXTERNAL ID")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", u.EPPN, u.Email, u.Status, u.Title, u.Organization, u.ExternalID)
+		}
+		return w.Flush()
+	}
+}
+
+func init() {
+	listUsersCmd.Flags().Bool("live", false, "Fetch users from SmartSuite instead of reading the local store.")
+	listUsersCmd.Flags().String("status", "", "Only list users with this status: 'active' or 'inactive'.")
+	listUsersCmd.Flags().String("org", "", "Only list users in this organization.")
+	listUsersCmd.Flags().String("format", "table", "Output format: 'table', 'json' or 'csv'.")
+}
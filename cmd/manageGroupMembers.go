@@ -6,11 +6,8 @@ import (
 	"os"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var manageGroupMembersCmd = &cobra.Command{
@@ -24,25 +21,18 @@ var manageGroupMembersCmd = &cobra.Command{
 		removeMembers, _ := cmd.Flags().GetStringSlice("remove")
 
 		slog.Info("Managing members", "group", groupName, "add_count", len(addMembers), "remove_count", len(removeMembers))
-
-		apiURL := viper.GetString("api_url")
-		apiKey := viper.GetString("api_key")
-		dataDir := viper.GetString("data_dir")
-		if dataDir == "" {
-			dataDir = "./data"
-		}
-
-		client, err := smartsuite.NewClient(apiURL, apiKey)
+		format, err := outputFormat(cmd)
 		if err != nil {
-			slog.Error("Failed to create API client", "error", err)
+			slog.Error("Invalid output format", "error", err)
 			os.Exit(1)
 		}
 
-		s, err := store.NewStore(dataDir)
+		client, s, err := setup(cmd)
 		if err != nil {
-			slog.Error("Failed to create store", "error", err)
+			slog.Error("Failed to set up command", "error", err)
 			os.Exit(1)
 		}
+		defer s.Close()
 
 		userStore, err := s.LoadUsers()
 		if err != nil {
@@ -62,6 +52,7 @@ var manageGroupMembersCmd = &cobra.Command{
 		}
 
 		var operations []models.SCIMPatchOp
+		changes := make(map[string]bool) // SCIM id -> whether it becomes a member
 		for _, eppn := range addMembers {
 			user, ok := userStore[eppn]
 			if !ok {
@@ -73,6 +64,7 @@ var manageGroupMembersCmd = &cobra.Command{
 				Path:  "members",
 				Value: []map[string]string{{"value": user.SCIMID}},
 			})
+			changes[user.SCIMID] = true
 		}
 
 		for _, eppn := range removeMembers {
@@ -85,21 +77,46 @@ var manageGroupMembersCmd = &cobra.Command{
 				Op:   "remove",
 				Path: fmt.Sprintf(`members[value eq "%s"]`, user.SCIMID),
 			})
+			changes[user.SCIMID] = false
 		}
 
 		if len(operations) == 0 {
 			slog.Info("No valid members to add or remove. Exiting.")
+			if err := printResult(cmd, format, operationResult{Status: "unchanged", Target: groupName, SCIMID: group.SCIMID, Record: group}); err != nil {
+				slog.Error("Printing the result failed", "error", err)
+				os.Exit(1)
+			}
 			return
 		}
 
-		logAndAudit(s, "ManageGroupMembers", groupName, "info", "Attempting to modify group...")
+		logAndAudit(ctx, s, "ManageGroupMembers", groupName, "info", "Attempting to modify group...")
 
 		err = client.PatchGroup(ctx, group.SCIMID, operations)
 		if err != nil {
-			logAndAudit(s, "ManageGroupMembers", groupName, "fatal", "Failed to modify group via API", "error", err)
+			logAndAudit(ctx, s, "ManageGroupMembers", groupName, "fatal", "Failed to modify group via API", "error", err)
+			os.Exit(exitCode(err))
 		}
 
-		logAndAudit(s, "ManageGroupMembers", groupName, "info", "Successfully modified members for group.")
+		for scimID, member := range changes {
+			if err := recordMembership(s, groupStore, groupName, scimID, member); err != nil {
+				slog.Error("Group was modified in SmartSuite but the local group store could not be updated. Run refresh to resync.", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		logAndAudit(ctx, s, "ManageGroupMembers", groupName, "info", "Successfully modified members for group.")
+		if err := printResult(cmd, format, operationResult{Status: "modified", Target: groupName, SCIMID: group.SCIMID, Record: groupStore[groupName]}); err != nil {
+			slog.Error("Group was modified, but printing the result failed", "error", err)
+			os.Exit(1)
+		}
 		slog.Info("Group membership management completed successfully.")
 	},
 }
+
+func init() {
+	manageGroupMembersCmd.Flags().String("group", "", "Name of the group to manage.")
+	manageGroupMembersCmd.MarkFlagRequired("group")
+	manageGroupMembersCmd.Flags().StringSlice("add", nil, "ePPN of a user to add to the group. Can be repeated.")
+	manageGroupMembersCmd.Flags().StringSlice("remove", nil, "ePPN of a user to remove from the group. Can be repeated.")
+	addOutputFlag(manageGroupMembersCmd)
+}
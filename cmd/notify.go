@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// notifyTimeout bounds each notification, so a slow receiver cannot hold up
+// the run it reports on.
+const notifyTimeout = 10 * time.Second
+
+// deletionNotice describes a user cleanup-users permanently deleted.
+type deletionNotice struct {
+	EPPN          string     `json:"eppn"`
+	SCIMID        string     `json:"scim_id"`
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+	DeletedAt     time.Time  `json:"deleted_at"`
+}
+
+// deletionNotifier tells a downstream system (ticketing, chat, ...) about
+// deleted users. It is handed every notice of a run at once, so
+// implementations may send them one by one or as a batch.
+type deletionNotifier interface {
+	notifyDeleted(ctx context.Context, notices []deletionNotice) error
+}
+
+// webhookNotifier POSTs each notice as a JSON object to url.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookNotifier(url string) *webhookNotifier {
+	return &webhookNotifier{url: url, client: &http.Client{Timeout: notifyTimeout}}
+}
+
+func (n *webhookNotifier) notifyDeleted(ctx context.Context, notices []deletionNotice) error {
+	var failed int
+	var lastErr error
+	for _, notice := range notices {
+		if err := n.post(ctx, notice); err != nil {
+			slog.Warn("Failed to send deletion notification", "eppn", notice.EPPN, "url", n.url, "error", err)
+			failed++
+			lastErr = err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notifications failed, last error: %w", failed, len(notices), lastErr)
+	}
+	return nil
+}
+
+func (n *webhookNotifier) post(ctx context.Context, notice deletionNotice) error {
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %d", res.StatusCode)
+	}
+	return nil
+}
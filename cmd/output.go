@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// operationResult is what a mutating command prints to stdout with --output
+// json, so scripts can pick up the SCIM id without parsing the log stream.
+type operationResult struct {
+	Status string      `json:"status"`
+	Target string      `json:"target"`
+	SCIMID string      `json:"scim_id,omitempty"`
+	Record interface{} `json:"record,omitempty"`
+}
+
+// addOutputFlag registers --output/-o on a mutating command.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "text", "Output format: 'text' (log lines only) or 'json' (also print the result as a single JSON object on stdout).")
+}
+
+// outputFormat returns the --output value, or an error if it is not one the
+// mutating commands can print. JSON output cannot be combined with --out -,
+// since both would write to stdout and interleave into invalid JSON.
+func outputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("output")
+	if format != "text" && format != "json" {
+		return "", fmt.Errorf("--output must be 'text' or 'json', got %q", format)
+	}
+	if out, _ := cmd.Flags().GetString("out"); format == "json" && out == "-" {
+		return "", fmt.Errorf("--output json cannot be combined with --out -; write the created object to a file instead")
+	}
+	return format, nil
+}
+
+// printResult writes result to the command's stdout when format is json.
+// Text output is left to the log lines the command already emits.
+func printResult(cmd *cobra.Command, format string, result operationResult) error {
+	if format != "json" {
+		return nil
+	}
+	return json.NewEncoder(cmd.OutOrStdout()).Encode(result)
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "text", false},
+		{[]string{"-o", "json"}, "json", false},
+		{[]string{"-o", "yaml"}, "", true},
+		{[]string{"-o", "json", "--out", "created.json"}, "json", false},
+		{[]string{"--out", "-"}, "text", false},
+		{[]string{"-o", "json", "--out", "-"}, "", true},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("out", "", "")
+		addOutputFlag(cmd)
+		if err := cmd.ParseFlags(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		got, err := outputFormat(cmd)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("outputFormat(%v) = %q, %v; want %q, error %v", tt.args, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -2,14 +2,13 @@ package cmd
 
 import (
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var populateCmd = &cobra.Command{
@@ -18,70 +17,66 @@ var populateCmd = &cobra.Command{
 	Long:  `Performs a full read from the SmartSuite SCIM API and overwrites the local users.json and groups.json files. This is intended for initial setup.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := cmd.Context()
+		force, _ := cmd.Flags().GetBool("force")
+		incremental, _ := cmd.Flags().GetBool("incremental")
 		slog.Info("Starting population process")
 
-		apiURL := viper.GetString("api_url")
-		apiKey := viper.GetString("api_key")
-		dataDir := viper.GetString("data_dir")
-		if dataDir == "" {
-			dataDir = "./data"
-		}
-
-		client, err := smartsuite.NewClient(apiURL, apiKey)
-		if err != nil {
-			slog.Error("Failed to create API client", "error", err)
-			os.Exit(1)
-		}
-
-		s, err := store.NewStore(dataDir)
+		client, s, err := setup(cmd)
 		if err != nil {
-			slog.Error("Failed to create store", "error", err)
+			slog.Error("Failed to set up command", "error", err)
 			os.Exit(1)
 		}
+		defer s.Close()
 
 		// Populate Users
 		slog.Info("Fetching users from SmartSuite")
-		scimUsers, err := client.GetUsers(ctx)
+		var scimUsers []models.SCIMUser
+		if incremental {
+			scimUsers, err = fetchUsersJournaled(ctx, client, resolveDataDir())
+		} else {
+			scimUsers, err = client.GetUsers(ctx, userListOrder)
+		}
 		if err != nil {
 			slog.Error("Failed to get users from API", "error", err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 
-		userStore := make(map[string]models.UserRecord)
-		for _, u := range scimUsers {
-			if ctx.Err() != nil {
-				slog.Warn("Shutdown signal received during user population. Halting.", "reason", ctx.Err())
-				return
-			}
-			if u.UserName == "" {
-				continue
-			}
-			status := "inactive"
-			if u.Active {
-				status = "active"
-			}
-			userStore[u.UserName] = models.UserRecord{
-				SCIMID:       u.ID,
-				Email:        u.Emails[0].Value,
-				Status:       status,
-				Name:         u.Name,
-				Title:        u.Title,
-				Organization: u.EnterpriseData.Organization,
-			}
+		if ctx.Err() != nil {
+			slog.Warn("Shutdown signal received during user population. Halting.", "reason", ctx.Err())
+			return
 		}
+		userStore, duplicates := userRecords(scimUsers)
+		for _, key := range slices.Sorted(maps.Keys(duplicates)) {
+			logAndAudit(ctx, s, "Populate", key, "warn", "Several SmartSuite users share this userName; only the first SCIM id is stored.", "scim_ids", duplicates[key])
+		}
+		resolveManagers(userStore)
 
+		// The listing came back without error, so it is complete; still refuse
+		// to let a suspiciously small one replace what is stored.
+		oldUsers, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load local user store", "error", err)
+			os.Exit(1)
+		}
+		if err := checkShrink("users", len(oldUsers), len(userStore), force); err != nil {
+			slog.Error("Not saving users", "error", err)
+			os.Exit(1)
+		}
 		if err := s.SaveUsers(userStore); err != nil {
 			slog.Error("Failed to save users to store", "error", err)
 			os.Exit(1)
 		}
+		if incremental {
+			removePopulateJournal(resolveDataDir())
+		}
 		slog.Info("Successfully populated users.", "count", len(userStore))
 
 		// Populate Groups
 		slog.Info("Fetching groups from SmartSuite")
-		scimGroups, err := client.GetGroups(ctx)
+		scimGroups, err := client.GetGroups(ctx, groupListOrder)
 		if err != nil {
 			slog.Error("Failed to get groups from API", "error", err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 
 		groupStore := make(map[string]models.GroupRecord)
@@ -93,9 +88,18 @@ var populateCmd = &cobra.Command{
 			if g.DisplayName == "" {
 				continue
 			}
-			groupStore[g.DisplayName] = models.GroupRecord{SCIMID: g.ID}
+			groupStore[g.DisplayName] = newGroupRecord(g)
 		}
 
+		oldGroups, err := s.LoadGroups()
+		if err != nil {
+			slog.Error("Failed to load local group store", "error", err)
+			os.Exit(1)
+		}
+		if err := checkShrink("groups", len(oldGroups), len(groupStore), force); err != nil {
+			slog.Error("Not saving groups", "error", err)
+			os.Exit(1)
+		}
 		if err := s.SaveGroups(groupStore); err != nil {
 			slog.Error("Failed to save groups to store", "error", err)
 			os.Exit(1)
@@ -105,3 +109,8 @@ var populateCmd = &cobra.Command{
 		slog.Info("Population process completed successfully.")
 	},
 }
+
+func init() {
+	populateCmd.Flags().Bool("incremental", false, "Record each page of users in a journal in the data directory as it is fetched, and resume from it if a previous run was interrupted.")
+	populateCmd.Flags().Bool("force", false, "Overwrite the local store even when SmartSuite returns far fewer users or groups than it holds (see SMARTSUITE_MAX_SHRINK).")
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+)
+
+// populateJournalFile is kept in the data directory while populate
+// --incremental runs, and removed once the store has been saved.
+const populateJournalFile = "populate.journal"
+
+// populatePage is one entry of the populate journal: a page of users as
+// fetched, and the startIndex of the page after it.
+type populatePage struct {
+	Next  int               `json:"next"`
+	Users []models.SCIMUser `json:"users"`
+}
+
+// fetchUsersJournaled fetches every user like GetUsers, but appends each page
+// to the journal in dataDir as it arrives. If a journal is already there, the
+// pages it holds are reused and the listing resumes after them, so an
+// interrupted populate does not start over. The caller removes the journal
+// with removePopulateJournal once the users have been saved.
+func fetchUsersJournaled(ctx context.Context, client *smartsuite.Client, dataDir string) ([]models.SCIMUser, error) {
+	path := filepath.Join(dataDir, populateJournalFile)
+	users, next, err := readPopulateJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	if next > 1 {
+		slog.Info("Existing populate journal found. Resuming user listing.", "journal", path, "users", len(users), "start_index", next)
+	}
+
+	journal, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open populate journal: %w", err)
+	}
+	defer journal.Close()
+	enc := json.NewEncoder(journal)
+
+	err = client.UserPages(ctx, userListOrder, next, func(page []models.SCIMUser, next int) error {
+		if err := enc.Encode(populatePage{Next: next, Users: page}); err != nil {
+			return fmt.Errorf("failed to write populate journal: %w", err)
+		}
+		users = append(users, page...)
+		slog.Info("Fetched page of users.", "users", len(users))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// readPopulateJournal returns the users recorded in the journal at path and
+// the startIndex to resume the listing at, which is 1 when there is no
+// journal. A page cut short by a crash is dropped from the file, to be
+// fetched again.
+func readPopulateJournal(path string) ([]models.SCIMUser, int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 1, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open populate journal: %w", err)
+	}
+	defer f.Close()
+
+	var users []models.SCIMUser
+	next := 1
+	dec := json.NewDecoder(f)
+	for {
+		var page populatePage
+		good := dec.InputOffset()
+		err := dec.Decode(&page)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			slog.Warn("Discarding incomplete last page of the populate journal.", "journal", path, "error", err)
+			if err := os.Truncate(path, good); err != nil {
+				return nil, 0, fmt.Errorf("failed to truncate populate journal: %w", err)
+			}
+			break
+		}
+		users = append(users, page.Users...)
+		next = page.Next
+	}
+	return users, next, nil
+}
+
+// removePopulateJournal deletes the populate journal in dataDir, if any.
+func removePopulateJournal(dataDir string) {
+	path := filepath.Join(dataDir, populateJournalFile)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove populate journal; delete it before the next populate --incremental.", "journal", path, "error", err)
+	}
+}
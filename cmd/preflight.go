@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Exit statuses used by preflight, following sysexits.h like exitMaintenance.
+const (
+	// exitConfig means the configuration is missing or invalid (EX_CONFIG).
+	exitConfig = 78
+	// exitUnavailable means SmartSuite could not be reached (EX_UNAVAILABLE).
+	exitUnavailable = 69
+	// exitNoPerm means SmartSuite rejected the API key (EX_NOPERM).
+	exitNoPerm = 77
+)
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Checks the configuration, credentials and data directory.",
+	Long: `Validates that api_url and api_key (or OAuth2 client credentials) are set and
+that api_url is a usable URL, that the data directory is writable, and then
+makes one lightweight authenticated request to SmartSuite to confirm
+connectivity and credentials. Each check is reported as it runs. Nothing in
+SmartSuite or the local store is changed.
+
+Exit status is 0 when every check passes, 78 for a configuration problem
+(including an unwritable data directory), 77 when SmartSuite or the token
+endpoint rejects the credentials, and 69 when SmartSuite cannot be reached or returns an error.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		out := cmd.OutOrStdout()
+		slog.Info("Starting preflight checks")
+
+		dataDir := resolveDataDir()
+
+		status := 0
+		fail := func(code int, check, format string, args ...interface{}) {
+			fmt.Fprintf(out, "[fail] %s: %s\n", check, fmt.Sprintf(format, args...))
+			if status == 0 {
+				status = code
+			}
+		}
+
+		apiURL := viper.GetString("api_url")
+		configOK := true
+		if err := checkAPIURL(apiURL); err != nil {
+			fail(exitConfig, "api_url", "%s", err)
+			configOK = false
+		} else {
+			fmt.Fprintf(out, "[ok] api_url: %s\n", apiURL)
+		}
+		if viper.GetString("oauth_token_url") != "" {
+			if err := checkClientCredentials(); err != nil {
+				fail(exitConfig, "oauth", "%s", err)
+				configOK = false
+			} else {
+				fmt.Fprintf(out, "[ok] oauth: client credentials set for %s\n", viper.GetString("oauth_token_url"))
+			}
+		} else if viper.GetString("api_key") == "" {
+			fail(exitConfig, "api_key", "not set (SMARTSUITE_API_KEY)")
+			configOK = false
+		} else {
+			fmt.Fprintln(out, "[ok] api_key: set")
+		}
+
+		if err := checkWritable(dataDir); err != nil {
+			fail(exitConfig, "data_dir", "%s", err)
+		} else {
+			fmt.Fprintf(out, "[ok] data_dir: %s is writable\n", dataDir)
+		}
+
+		if configOK {
+			checkConnection(ctx, out, fail)
+		} else {
+			fmt.Fprintln(out, "[skip] connection: fix the configuration first")
+		}
+
+		if status != 0 {
+			slog.Error("Preflight checks failed.", "exit_code", status)
+			os.Exit(status)
+		}
+		slog.Info("All preflight checks passed.")
+	},
+}
+
+// checkAPIURL reports why apiURL cannot be used as the client's BaseURL.
+func checkAPIURL(apiURL string) error {
+	if apiURL == "" {
+		return errors.New("not set (SMARTSUITE_API_URL)")
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return fmt.Errorf("does not parse: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("'%s' must be an http or https URL", apiURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("'%s' has no host", apiURL)
+	}
+	return nil
+}
+
+// checkClientCredentials reports what is missing from an OAuth2
+// client-credentials configuration.
+func checkClientCredentials() error {
+	if err := checkAPIURL(viper.GetString("oauth_token_url")); err != nil {
+		return fmt.Errorf("oauth_token_url %s", err)
+	}
+	if viper.GetString("oauth_client_id") == "" {
+		return errors.New("oauth_client_id not set (SMARTSUITE_OAUTH_CLIENT_ID)")
+	}
+	if viper.GetString("oauth_client_secret") == "" {
+		return errors.New("oauth_client_secret not set (SMARTSUITE_OAUTH_CLIENT_SECRET)")
+	}
+	return nil
+}
+
+// checkWritable creates dataDir if needed and confirms a file can be written
+// in it, removing the file again.
+func checkWritable(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dataDir, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkConnection makes one authenticated request and reports the outcome,
+// telling apart a rejected key from an unreachable or failing server.
+func checkConnection(ctx context.Context, out io.Writer, fail func(code int, check, format string, args ...interface{})) {
+	client, err := newClient()
+	if err != nil {
+		fail(exitConfig, "client", "%s", err)
+		return
+	}
+	total, err := client.CountUsers(ctx)
+	switch {
+	case errors.Is(err, smartsuite.ErrUnauthorized):
+		fail(exitNoPerm, "credentials", "SmartSuite rejected the credentials: %s", err)
+	case err != nil:
+		fail(exitUnavailable, "connection", "%s", err)
+	default:
+		fmt.Fprintf(out, "[ok] connection: authenticated to SmartSuite (%d users)\n", total)
+	}
+}
@@ -3,10 +3,12 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
@@ -21,7 +23,7 @@ var processBatchCmd = &cobra.Command{
 	Use:   "process-batch",
 	Short: "Executes a bulk update from a source file.",
 	Long: `Reads a source file containing a list of tasks (e.g., update, deactivate, add-to-group),
-and processes them sequentially. This command is designed to be resumable; if it's
+and processes them in order, optionally several at a time. This command is designed to be resumable; if it's
 interrupted, it can be re-run to process the remaining pending tasks.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// --- Get context for graceful shutdown ---
@@ -29,11 +31,51 @@ interrupted, it can be re-run to process the remaining pending tasks.`,
 
 		// --- Initialization ---
 		fromFile, _ := cmd.Flags().GetString("from-file")
-		slog.Info("Starting batch process", "from_file", fromFile)
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		deterministic, _ := cmd.Flags().GetBool("deterministic")
+		stream, _ := cmd.Flags().GetBool("stream")
+		bulkSize, _ := cmd.Flags().GetInt("bulk-size")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		taskRetries, _ := cmd.Flags().GetInt("task-retries")
+		taskBackoff, _ := cmd.Flags().GetDuration("task-retry-backoff")
+		slog.Info("Starting batch process", "from_file", fromFile, "dry_run", dryRun, "deterministic", deterministic, "stream", stream, "bulk_size", bulkSize, "concurrency", concurrency)
 
-		dataDir := viper.GetString("data_dir")
-		if dataDir == "" {
-			dataDir = "./data"
+		dataDir := resolveDataDir()
+
+		if concurrency < 1 {
+			slog.Error("--concurrency must be at least 1.", "concurrency", concurrency)
+			os.Exit(1)
+		}
+		if taskRetries < 0 {
+			slog.Error("--task-retries cannot be negative.", "task_retries", taskRetries)
+			os.Exit(1)
+		}
+		retry := taskRetry{retries: taskRetries, backoff: taskBackoff}
+		if deterministic && concurrency > 1 {
+			slog.Warn("--deterministic runs tasks one at a time. Ignoring --concurrency.", "concurrency", concurrency)
+			concurrency = 1
+		}
+		if bulkSize > 0 && concurrency > 1 {
+			slog.Error("--bulk-size cannot be combined with --concurrency greater than 1.")
+			os.Exit(1)
+		}
+
+		if stream {
+			if dryRun || deterministic || bulkSize > 0 || concurrency > 1 {
+				slog.Error("--stream cannot be combined with --dry-run, --deterministic, --bulk-size or --concurrency, which need the whole batch in memory.")
+				os.Exit(1)
+			}
+			client, s, err := setup(cmd)
+			if err != nil {
+				slog.Error("Failed to set up command", "error", err)
+				os.Exit(1)
+			}
+			defer s.Close()
+			if err := streamBatch(ctx, client, s, fromFile, filepath.Join(dataDir, "job_queue.journal"), retry); err != nil {
+				slog.Error("Streamed batch process failed", "error", err)
+				os.Exit(exitCode(err))
+			}
+			return
 		}
 		jobQueueFile := filepath.Join(dataDir, "job_queue.json")
 		var jobQueue []models.JobTask
@@ -66,69 +108,64 @@ interrupted, it can be re-run to process the remaining pending tasks.`,
 			}
 		}
 
-		// --- Process Job Queue ---
-		client, err := smartsuite.NewClient(viper.GetString("api_url"), viper.GetString("api_key"))
-		if err != nil {
-			slog.Error("Failed to create API client", "error", err)
-			os.Exit(1)
-		}
-		s, err := store.NewStore(dataDir)
-		if err != nil {
-			slog.Error("Failed to create store", "error", err)
-			os.Exit(1)
+		order := executionOrder(jobQueue, deterministic)
+
+		if dryRun {
+			// A preview makes no API calls and leaves the store and job queue
+			// untouched; would-run statuses are never saved, and nothing is archived.
+			// It only reads the store, so it takes a shared lock and cannot
+			// write to it by accident.
+			s, err := newReadOnlyStore(dataDir)
+			if err != nil {
+				slog.Error("Failed to open store", "error", err)
+				os.Exit(1)
+			}
+			defer s.Close()
+			userStore, groupStore := loadBatchStores(s)
+			wouldRun := previewBatch(cmd.OutOrStdout(), jobQueue, order, userStore, groupStore)
+			slog.Info("Dry run complete. No changes were made.", "would_run", wouldRun)
+			return
 		}
-		userStore, err := s.LoadUsers()
+
+		// --- Process Job Queue ---
+		client, s, err := setup(cmd)
 		if err != nil {
-			slog.Error("Failed to load user store", "error", err)
+			slog.Error("Failed to set up command", "error", err)
 			os.Exit(1)
 		}
-		groupStore, err := s.LoadGroups()
-		if err != nil {
-			slog.Error("Failed to load group store", "error", err)
-			os.Exit(1)
+		defer s.Close()
+		userStore, groupStore := loadBatchStores(s)
+
+		if bulkSize > 0 {
+			bulkSize = negotiateBulkSize(ctx, client, bulkSize)
 		}
 
 		slog.Debug("Starting Queue.", "size", len(jobQueue))
 
 		var tasksProcessed int
 		hasChanges := false
-		for i := range jobQueue {
-			// --- Check for graceful shutdown signal ---
-			if ctx.Err() != nil {
-				slog.Warn("Shutdown signal received. Saving progress and exiting.", "reason", ctx.Err())
-				saveQueue(jobQueueFile, jobQueue)
-				return // Exit gracefully
-			}
 
-			task := &jobQueue[i]
-			if task.Status != "pending" {
-				slog.Debug("Not Pending.", "status", task.Status)
-				continue
-			}
-
-			hasChanges = true
-			slog.Debug("Processing task", "type", task.Type, "target", task.Target)
-
-			var taskErr error
-			switch task.Type {
-			case "update":
-				taskErr = handleUpdateTask(ctx, client, s, userStore, task)
-			case "deactivate":
-				taskErr = handleDeactivateTask(ctx, client, s, userStore, task)
-			case "add-to-group":
-				taskErr = handleGroupMembershipTask(ctx, client, userStore, groupStore, task, "add")
-			case "remove-from-group":
-				taskErr = handleGroupMembershipTask(ctx, client, userStore, groupStore, task, "remove")
-			default:
-				taskErr = fmt.Errorf("unknown task type: '%s'", task.Type)
+		// finishTask records a task's outcome in the queue and, under the
+		// task's own transaction, in the audit log.
+		finishTask := func(taskCtx context.Context, task *models.JobTask, taskErr error) {
+			if exitCode(taskErr) == exitMaintenance {
+				// Leave the task pending so a later run picks it up once the tenant is back.
+				slog.Error("Tenant is in maintenance. Saving progress and exiting.", "error", taskErr)
+				saveQueue(jobQueueFile, jobQueue)
+				os.Exit(exitMaintenance)
 			}
 
 			if taskErr != nil {
+				now := time.Now().UTC()
 				task.Status = "failed"
-				logAndAudit(s, "ProcessBatch", task.Target, "error", "Task failed", "error", taskErr)
+				task.LastError = taskErr.Error()
+				task.FailedAt = &now
+				logAndAudit(taskCtx, s, "ProcessBatch", task.Target, "error", "Task failed", "error", taskErr)
 			} else {
 				task.Status = "completed"
-				logAndAudit(s, "ProcessBatch", task.Target, "info", fmt.Sprintf("Task '%s' completed successfully.", task.Type))
+				task.LastError = ""
+				task.FailedAt = nil
+				logAndAudit(taskCtx, s, "ProcessBatch", task.Target, "info", fmt.Sprintf("Task '%s' completed successfully.", task.Type))
 			}
 
 			tasksProcessed++
@@ -138,6 +175,87 @@ interrupted, it can be re-run to process the remaining pending tasks.`,
 			}
 		}
 
+		// Consecutive membership tasks are held back and sent together, so
+		// the order tasks take effect in is unchanged.
+		var bulkPending []int
+		flushBulk := func() {
+			if len(bulkPending) == 0 || ctx.Err() != nil {
+				return
+			}
+			slog.Debug("Sending bulk request", "operations", len(bulkPending))
+			results := runBulk(ctx, client, userStore, groupStore, jobQueue, bulkPending)
+			for _, i := range bulkPending {
+				task := &jobQueue[i]
+				taskErr := results[i]
+				if taskErr == nil {
+					taskErr = recordMembership(s, groupStore, task.Data.(string), userStore[task.Target].SCIMID, task.Type == "add-to-group")
+				}
+				finishTask(withTransaction(ctx), task, taskErr)
+			}
+			bulkPending = bulkPending[:0]
+		}
+
+		if concurrency > 1 {
+			for _, i := range order {
+				if jobQueue[i].Status == "pending" {
+					hasChanges = true
+					break
+				}
+			}
+			run := func(taskCtx context.Context, users map[string]models.UserRecord, groups map[string]models.GroupRecord, task *models.JobTask) error {
+				slog.Debug("Processing task", "type", task.Type, "target", task.Target)
+				return retry.run(taskCtx, task, func() error {
+					return runTask(taskCtx, client, s, users, groups, task)
+				})
+			}
+			if err := runPool(ctx, concurrency, jobQueue, order, userStore, groupStore, run, finishTask); err != nil {
+				slog.Error("Tenant is in maintenance. Saving progress and exiting.", "error", err)
+				saveQueue(jobQueueFile, jobQueue)
+				os.Exit(exitMaintenance)
+			}
+			if ctx.Err() != nil {
+				slog.Warn("Shutdown signal received. Saving progress and exiting.", "reason", ctx.Err())
+				saveQueue(jobQueueFile, jobQueue)
+				return // Exit gracefully
+			}
+		} else {
+			for _, i := range order {
+				// --- Check for graceful shutdown signal ---
+				if ctx.Err() != nil {
+					slog.Warn("Shutdown signal received. Saving progress and exiting.", "reason", ctx.Err())
+					saveQueue(jobQueueFile, jobQueue)
+					return // Exit gracefully
+				}
+
+				task := &jobQueue[i]
+				if task.Status != "pending" {
+					slog.Debug("Not Pending.", "status", task.Status)
+					continue
+				}
+
+				hasChanges = true
+
+				if bulkSize > 0 && bulkOpType[task.Type] != "" {
+					bulkPending = append(bulkPending, i)
+					if len(bulkPending) >= bulkSize {
+						flushBulk()
+					}
+					continue
+				}
+				flushBulk()
+
+				slog.Debug("Processing task", "type", task.Type, "target", task.Target)
+
+				// Each task is a logical operation of its own, so its audit events
+				// get their own transaction rather than the whole run's.
+				taskCtx := withTransaction(ctx)
+				finishTask(taskCtx, task, retry.run(taskCtx, task, func() error {
+					return runTask(taskCtx, client, s, userStore, groupStore, task)
+				}))
+			}
+			flushBulk()
+		}
+
 		if hasChanges {
 			saveQueue(jobQueueFile, jobQueue)
 			slog.Info("Batch process finished.")
@@ -145,6 +263,8 @@ interrupted, it can be re-run to process the remaining pending tasks.`,
 			slog.Info("No pending tasks to process. Batch process complete.")
 		}
 
+		logFailedTasks(buildBatchReport(jobQueueFile, jobQueue).Failures)
+
 		// --- Archive Job Queue on Success ---
 		allCompleted := true
 		for _, task := range jobQueue {
@@ -166,6 +286,71 @@ interrupted, it can be re-run to process the remaining pending tasks.`,
 	},
 }
 
+// taskTypePriority defines the order of task types in deterministic mode:
+// attribute updates first, then membership changes, and deactivations last so
+// that every other change to a departing user lands before they are disabled.
+var taskTypePriority = map[string]int{
+	"update":            0,
+	"add-to-group":      1,
+	"remove-from-group": 2,
+	"deactivate":        3,
+}
+
+// executionOrder returns the queue indices in the order tasks should run. By
+// default that is file order. In deterministic mode tasks are sorted by type
+// priority, then target, then original position, so every run of the same
+// file executes identically. The queue itself is never reordered on disk.
+func executionOrder(queue []models.JobTask, deterministic bool) []int {
+	order := make([]int, len(queue))
+	for i := range order {
+		order[i] = i
+	}
+	if !deterministic {
+		return order
+	}
+
+	priority := func(taskType string) int {
+		if p, ok := taskTypePriority[taskType]; ok {
+			return p
+		}
+		return len(taskTypePriority) // Unknown types sort last.
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ta, tb := queue[order[a]], queue[order[b]]
+		if pa, pb := priority(ta.Type), priority(tb.Type); pa != pb {
+			return pa < pb
+		}
+		if ta.Target != tb.Target {
+			return ta.Target < tb.Target
+		}
+		return order[a] < order[b]
+	})
+	return order
+}
+
+// runTask dispatches a single task to the handler for its type. On success
+// the target's prior state is recorded on the task for undo-batch.
+func runTask(ctx context.Context, client *smartsuite.Client, s *store.Store, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord, task *models.JobTask) error {
+	before := captureBefore(task, userStore, groupStore)
+	var err error
+	switch task.Type {
+	case "update":
+		err = handleUpdateTask(ctx, client, s, userStore, task)
+	case "deactivate":
+		err = handleDeactivateTask(ctx, client, s, userStore, task)
+	case "add-to-group":
+		err = handleGroupMembershipTask(ctx, client, s, userStore, groupStore, task, "add")
+	case "remove-from-group":
+		err = handleGroupMembershipTask(ctx, client, s, userStore, groupStore, task, "remove")
+	default:
+		return fmt.Errorf("unknown task type: '%s'", task.Type)
+	}
+	if err == nil {
+		task.Before = before
+	}
+	return err
+}
+
 // handleUpdateTask processes a single user attribute update task.
 func handleUpdateTask(ctx context.Context, client *smartsuite.Client, s *store.Store, userStore map[string]models.UserRecord, task *models.JobTask) error {
 	record, ok := userStore[task.Target]
@@ -178,85 +363,154 @@ func handleUpdateTask(ctx context.Context, client *smartsuite.Client, s *store.S
 		return fmt.Errorf("task data for update must be a map of attributes")
 	}
 
-	var operations []models.SCIMPatchOp
-	for key, value := range dataMap {
-		operations = append(operations, models.SCIMPatchOp{
-			Op:    "replace",
-			Path:  key,
-			Value: value,
-		})
+	operations, err := updateOperations(dataMap)
+	if err != nil {
+		return fmt.Errorf("invalid update for user '%s': %w", task.Target, err)
 	}
-
 	if len(operations) == 0 {
 		return fmt.Errorf("no update operations provided for user '%s'", task.Target)
 	}
 
+	// Refuse a rename onto another stored user before touching SmartSuite, so
+	// neither the API nor the store ends up with the record clobbered.
+	newName := newUserName(dataMap)
+	if newName != "" && newName != task.Target {
+		if _, taken := userStore[newName]; taken {
+			return fmt.Errorf("cannot rename user '%s' to '%s': %w", task.Target, newName, store.ErrUserExists)
+		}
+	}
+
 	// Perform the API call first.
-	err := client.PatchUser(ctx, record.SCIMID, operations)
-	if err != nil {
+	if err := patchRecord(ctx, client, &record, operations); err != nil {
 		return err
 	}
 
-	newUserName := ""
+	for _, op := range operations {
+		switch value := op.Value.(type) {
+		case []models.EmailRecord:
+			record.Emails = value
+			record.Email = primaryEmail(value)
+		case []models.SCIMPhoneNumber:
+			record.Phone = primaryPhone(value)
+		case models.SCIMName:
+			record.Name = value
+		}
+	}
+
 	for key, value := range dataMap {
-		switch key {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		switch updateKey(key) {
 		case "title":
-			if title, ok := value.(string); ok {
-				record.Title = title
-			}
-		case "userName":
-			if un, ok := value.(string); ok {
-				newUserName = un
-			}
+			record.Title = str
+		case "organization":
+			record.Organization = str
+		case "department":
+			record.Department = str
+		case "costCenter":
+			record.CostCenter = str
+		case "division":
+			record.Division = str
+		case "employeeNumber":
+			record.EmployeeNumber = str
 			// Add other attribute cases here as needed
 		}
 	}
 
-	// If the userName (the key of our map) has changed, we must update the map.
-	if newUserName != "" && newUserName != task.Target {
-		// Delete the old record
+	// If the userName (the key of our map) has changed, we must move the
+	// record. The in-memory map follows only once the store has been written.
+	if newName != "" && newName != task.Target {
+		if err := s.RenameUser(task.Target, newName, record); err != nil {
+			return err
+		}
 		delete(userStore, task.Target)
-		// Add the new record
-		userStore[newUserName] = record
-	} else {
-		// Otherwise, just update the existing record
-		userStore[task.Target] = record
+		userStore[newName] = record
+		return nil
 	}
 
-	return s.SaveUsers(userStore)
+	// Otherwise, just update the existing record
+	userStore[task.Target] = record
+	return s.UpsertUser(task.Target, record)
 }
 
 // handleDeactivateTask processes a single user deactivation task.
 func handleDeactivateTask(ctx context.Context, client *smartsuite.Client, s *store.Store, userStore map[string]models.UserRecord, task *models.JobTask) error {
-	record, ok := userStore[task.Target]
+	return deactivateUser(ctx, client, s, userStore, task.Target)
+}
+
+// deactivateOperations is the PATCH that deactivates a user.
+var deactivateOperations = []models.SCIMPatchOp{{Op: "replace", Path: "active", Value: false}}
+
+// deactivateUser sets active=false on the user in SmartSuite, then records the
+// deactivation time and inactive status in the local store.
+func deactivateUser(ctx context.Context, client *smartsuite.Client, s *store.Store, userStore map[string]models.UserRecord, eppn string) error {
+	record, ok := userStore[eppn]
 	if !ok {
-		return fmt.Errorf("user '%s' not found in local store", task.Target)
+		return fmt.Errorf("user '%s' not found in local store", eppn)
 	}
-	operations := []models.SCIMPatchOp{{Op: "replace", Path: "active", Value: false}}
-	err := client.PatchUser(ctx, record.SCIMID, operations)
+	err := patchRecord(ctx, client, &record, deactivateOperations)
 	if err != nil {
 		return err
 	}
 	now := time.Now()
 	record.DeactivationTimestamp = &now
 	record.Status = "inactive"
-	userStore[task.Target] = record
-	return s.SaveUsers(userStore)
+	userStore[eppn] = record
+	return s.UpsertUser(eppn, record)
+}
+
+// patchRecord patches the user conditionally on the ETag captured at the last
+// populate or refresh. A successful patch bumps the version on the server, so
+// the stale ETag is dropped rather than sent again.
+func patchRecord(ctx context.Context, client *smartsuite.Client, record *models.UserRecord, operations []models.SCIMPatchOp) error {
+	err := client.PatchUserIfMatch(ctx, record.SCIMID, record.ETag, operations)
+	if errors.Is(err, smartsuite.ErrPreconditionFailed) {
+		return fmt.Errorf("user was changed in SmartSuite since the last refresh; run refresh and retry: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+	record.ETag = ""
+	return nil
 }
 
 // handleGroupMembershipTask processes adding or removing a user from a group.
-func handleGroupMembershipTask(ctx context.Context, client *smartsuite.Client, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord, task *models.JobTask, opType string) error {
+func handleGroupMembershipTask(ctx context.Context, client *smartsuite.Client, s *store.Store, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord, task *models.JobTask, opType string) error {
+	groupID, op, err := groupMembershipOp(userStore, groupStore, task, opType)
+	if err != nil {
+		return err
+	}
+	if err := client.PatchGroup(ctx, groupID, []models.SCIMPatchOp{op}); err != nil {
+		return err
+	}
+	return recordMembership(s, groupStore, task.Data.(string), userStore[task.Target].SCIMID, opType == "add")
+}
+
+// recordMembership applies a membership change the mediator made in SmartSuite
+// to the local group record, so refresh does not report it as drift.
+func recordMembership(s *store.Store, groupStore map[string]models.GroupRecord, groupName, scimID string, member bool) error {
+	if record, ok := groupStore[groupName]; ok && record.SetMember(scimID, member) {
+		groupStore[groupName] = record
+	}
+	return s.SetGroupMember(groupName, scimID, member)
+}
+
+// groupMembershipOp resolves a membership task against the local store and
+// returns the SCIM id of the group and the PATCH operation to apply to it.
+func groupMembershipOp(userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord, task *models.JobTask, opType string) (string, models.SCIMPatchOp, error) {
 	user, ok := userStore[task.Target]
 	if !ok {
-		return fmt.Errorf("user '%s' not found in local store", task.Target)
+		return "", models.SCIMPatchOp{}, fmt.Errorf("user '%s' not found in local store", task.Target)
 	}
 	groupName, ok := task.Data.(string)
 	if !ok {
-		return fmt.Errorf("task data for group membership must be the group name (string)")
+		return "", models.SCIMPatchOp{}, fmt.Errorf("task data for group membership must be the group name (string)")
 	}
 	group, ok := groupStore[groupName]
 	if !ok {
-		return fmt.Errorf("group '%s' not found in local store", groupName)
+		return "", models.SCIMPatchOp{}, fmt.Errorf("group '%s' not found in local store", groupName)
 	}
 	var op models.SCIMPatchOp
 	if opType == "add" {
@@ -264,9 +518,9 @@ func handleGroupMembershipTask(ctx context.Context, client *smartsuite.Client, u
 	} else if opType == "remove" {
 		op = models.SCIMPatchOp{Op: "remove", Path: fmt.Sprintf(`members[value eq "%s"]`, user.SCIMID)}
 	} else {
-		return fmt.Errorf("internal error: invalid opType '%s'", opType)
+		return "", models.SCIMPatchOp{}, fmt.Errorf("internal error: invalid opType '%s'", opType)
 	}
-	return client.PatchGroup(ctx, group.SCIMID, []models.SCIMPatchOp{op})
+	return group.SCIMID, op, nil
 }
 
 // saveQueue marshals and writes the job queue to a file to save progress.
@@ -285,4 +539,29 @@ func init() {
 	var fromFile string
 	processBatchCmd.Flags().StringVar(&fromFile, "from-file", "", "Path to the JSON file containing batch tasks.")
 	processBatchCmd.MarkFlagRequired("from-file")
+	processBatchCmd.Flags().Bool("deterministic", false, "Run tasks sorted by type (update, add-to-group, remove-from-group, deactivate) and then target, instead of file order.")
+	processBatchCmd.Flags().Bool("stream", false, "Decode the source file one task at a time and journal progress instead of loading the whole batch into memory.")
+	processBatchCmd.Flags().Int("concurrency", 1, "Run up to this many tasks at once. Tasks for the same target still run one at a time and in order.")
+	processBatchCmd.Flags().Int("bulk-size", 0, "Send up to this many consecutive group membership tasks in a single SCIM bulk request. Zero sends every task on its own.")
+	processBatchCmd.Flags().Bool("idempotent-membership", false, "Count an add-to-group task for an existing member, or a remove-from-group task for a non-member, as done when SmartSuite rejects it for that reason.")
+	viper.BindPFlag("idempotent_membership", processBatchCmd.Flags().Lookup("idempotent-membership"))
+	processBatchCmd.Flags().Int("task-retries", 0, "Retry a task up to this many times within the run when it fails with a transient API error (a network error, 429 or 5xx) before marking it failed.")
+	processBatchCmd.Flags().Duration("task-retry-backoff", 5*time.Second, "Wait before the first in-run task retry; it doubles on each subsequent retry.")
+	processBatchCmd.Flags().Bool("dry-run", false, "Preview each pending task as a before/after diff without calling the API or saving anything.")
+}
+
+// loadBatchStores loads the user and group stores a batch runs against,
+// exiting on failure.
+func loadBatchStores(s *store.Store) (map[string]models.UserRecord, map[string]models.GroupRecord) {
+	userStore, err := s.LoadUsers()
+	if err != nil {
+		slog.Error("Failed to load user store", "error", err)
+		os.Exit(1)
+	}
+	groupStore, err := s.LoadGroups()
+	if err != nil {
+		slog.Error("Failed to load group store", "error", err)
+		os.Exit(1)
+	}
+	return userStore, groupStore
 }
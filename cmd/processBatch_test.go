@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+// batchUsers are the users the process-batch tests act on.
+var batchUsers = []models.SCIMUser{
+	{ID: "a1", UserName: "alice@example.edu", Active: true},
+	{ID: "b2", UserName: "bob@example.edu", Active: true},
+	{ID: "c3", UserName: "carol@example.edu", Active: true},
+}
+
+func batchUserStore() map[string]models.UserRecord {
+	userStore := make(map[string]models.UserRecord)
+	for _, u := range batchUsers {
+		userStore[u.UserName] = models.UserRecord{SCIMID: u.ID, Status: "active"}
+	}
+	return userStore
+}
+
+func TestDeterministicRunsAuditInTheSameOrder(t *testing.T) {
+	// The same tasks, listed in two different file orders.
+	files := []string{
+		`[{"type":"deactivate","target":"bob@example.edu"},
+			{"type":"update","target":"carol@example.edu","data":{"title":"Dean"}},
+			{"type":"update","target":"alice@example.edu","data":{"title":"Professor"}}]`,
+		`[{"type":"update","target":"alice@example.edu","data":{"title":"Professor"}},
+			{"type":"deactivate","target":"bob@example.edu"},
+			{"type":"update","target":"carol@example.edu","data":{"title":"Dean"}}]`,
+	}
+
+	var runs [][]string
+	var targets []string
+	for _, content := range files {
+		fake := newFakeSCIM(t, batchUsers...)
+		dataDir := seedDataDir(t, batchUserStore())
+		batch := writeFile(t, "batch.json", content)
+
+		runCommand(t, fake, dataDir, "process-batch", "--from-file", batch, "--deterministic")
+
+		var audited []string
+		targets = nil
+		for _, event := range readAudit(t, dataDir) {
+			audited = append(audited, event.UseCase+" "+event.Target+": "+event.Details)
+			if event.Target != "" && !slices.Contains(targets, event.Target) {
+				targets = append(targets, event.Target)
+			}
+		}
+		runs = append(runs, audited)
+	}
+
+	if !slices.Equal(runs[0], runs[1]) {
+		t.Fatalf("audit order differs between runs:\n%q\n%q", runs[0], runs[1])
+	}
+	want := []string{"alice@example.edu", "carol@example.edu", "bob@example.edu"}
+	if !slices.Equal(targets, want) {
+		t.Errorf("tasks ran in order %v, want %v", targets, want)
+	}
+}
+
+func TestProcessBatchDryRunMakesNoAPICalls(t *testing.T) {
+	fake := newFakeSCIM(t, batchUsers...)
+	dataDir := seedDataDir(t, batchUserStore())
+	batch := writeFile(t, "batch.json", `[{"type":"update","target":"alice@example.edu","data":{"title":"Professor"}},
+		{"type":"deactivate","target":"bob@example.edu"},
+		{"type":"deactivate","target":"nobody@example.edu"}]`)
+	// A dry run opens the store read-only, alongside any other reader.
+	reader, err := store.NewStore(dataDir, store.WithReadOnly())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer reader.Close()
+	logs := captureLogs(t)
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	t.Cleanup(func() { rootCmd.SetOut(nil) })
+
+	runCommand(t, fake, dataDir, "process-batch", "--from-file", batch, "--dry-run")
+
+	if calls := fake.calls(); len(calls) != 0 {
+		t.Errorf("dry run made API calls %v, want none", calls)
+	}
+	if !strings.Contains(out.String(), `"Professor"`) {
+		t.Errorf("preview %q does not show the new title", out.String())
+	}
+	for _, want := range []string{
+		`path=/Users/a1 operations="[{\"op\":\"replace\",\"path\":\"title\",\"value\":\"Professor\"}]"`,
+		`path=/Users/b2 operations="[{\"op\":\"replace\",\"path\":\"active\",\"value\":false}]"`,
+		"would_run=2",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log does not contain %s:\n%s", want, logs)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "job_queue.json")); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote a job queue (stat error %v)", err)
+	}
+}
+
+func TestIsRename(t *testing.T) {
+	tests := []struct {
+		name string
+		task models.JobTask
+		want bool
+	}{
+		{"new userName", models.JobTask{Type: "update", Target: "alice@example.edu", Data: map[string]interface{}{"userName": "alice.b@example.edu"}}, true},
+		{"same userName", models.JobTask{Type: "update", Target: "alice@example.edu", Data: map[string]interface{}{"userName": "alice@example.edu"}}, false},
+		{"non-string userName", models.JobTask{Type: "update", Target: "alice@example.edu", Data: map[string]interface{}{"userName": 42}}, false},
+		{"other attributes", models.JobTask{Type: "update", Target: "alice@example.edu", Data: map[string]interface{}{"title": "Dean"}}, false},
+		{"not an update", models.JobTask{Type: "deactivate", Target: "alice@example.edu"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRename(&tt.task); got != tt.want {
+				t.Errorf("isRename() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,11 +2,13 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
-	"reflect"
+	"slices"
 
-	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
 
@@ -22,103 +24,133 @@ var refreshCmd = &cobra.Command{
 		ctx := cmd.Context()
 		slog.Info("Starting refresh & reconcile process")
 
-		apiURL := viper.GetString("api_url")
-		apiKey := viper.GetString("api_key")
-		dataDir := viper.GetString("data_dir")
-		if dataDir == "" {
-			dataDir = "./data"
-		}
-
-		client, err := smartsuite.NewClient(apiURL, apiKey)
+		remediate, err := parseRemediate(configList("remediate"))
 		if err != nil {
-			slog.Error("Failed to create API client", "error", err)
+			slog.Error("Invalid --remediate", "error", err)
 			os.Exit(1)
 		}
 
-		s, err := store.NewStore(dataDir)
-		if err != nil {
-			slog.Error("Failed to create store", "error", err)
-			os.Exit(1)
+		reportFile, _ := cmd.Flags().GetString("report")
+		var report *reconcileReport
+		if reportFile != "" {
+			report = newReconcileReport()
 		}
-
-		// --- Reconcile Users ---
-		slog.Info("--- Reconciling Users ---")
-		if err := reconcileUsers(ctx, s, client); err != nil {
-			if err == context.Canceled || err == context.DeadlineExceeded {
-				slog.Warn("Refresh process halted by shutdown signal.", "reason", err)
-				return
+		// writeReport is called on every way out once reconciling has started,
+		// so a cancelled or failed run still leaves a (partial) report behind.
+		writeReport := func(complete bool) {
+			if err := report.write(reportFile, complete); err != nil {
+				slog.Error("Failed to write reconcile report", "error", err)
 			}
-			slog.Error("Failed to reconcile users", "error", err)
+		}
+
+		client, s, err := setup(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
 			os.Exit(1)
 		}
+		defer s.Close()
 
-		// --- Reconcile Groups ---
-		slog.Info("--- Reconciling Groups ---")
-		if err := reconcileGroups(ctx, s, client); err != nil {
-			if err == context.Canceled || err == context.DeadlineExceeded {
+		force, _ := cmd.Flags().GetBool("force")
+		if err := runRefresh(ctx, s, client, remediate, force, report); err != nil {
+			writeReport(false)
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 				slog.Warn("Refresh process halted by shutdown signal.", "reason", err)
 				return
 			}
-			slog.Error("Failed to reconcile groups", "error", err)
-			os.Exit(1)
+			slog.Error("Refresh process failed", "error", err)
+			os.Exit(exitCode(err))
 		}
 
+		writeReport(true)
 		slog.Info("Refresh process completed successfully.")
 	},
 }
 
-func reconcileUsers(ctx context.Context, s *store.Store, client *smartsuite.Client) error {
+// runRefresh reconciles the users and then the groups in s with SmartSuite,
+// recording what it finds in report, which may be nil. force skips the
+// checkShrink guard.
+func runRefresh(ctx context.Context, s *store.Store, client *smartsuite.Client, remediate map[string]bool, force bool, report *reconcileReport) error {
+	slog.Info("--- Reconciling Users ---")
+	if err := reconcileUsers(ctx, s, client, remediate, force, report); err != nil {
+		return fmt.Errorf("failed to reconcile users: %w", err)
+	}
+	slog.Info("--- Reconciling Groups ---")
+	if err := reconcileGroups(ctx, s, client, force, report); err != nil {
+		return fmt.Errorf("failed to reconcile groups: %w", err)
+	}
+	return nil
+}
+
+// reconcileUsers logs every difference between the local store and SmartSuite
+// and then replaces the local users with the live ones. The store is only
+// written once the complete listing has been fetched and compared; a failed or
+// cancelled run leaves it untouched. Deltas on the fields
+// in remediate are instead pushed back to SmartSuite, keeping the local value.
+// Everything found is also recorded in report, which may be nil.
+func reconcileUsers(ctx context.Context, s *store.Store, client *smartsuite.Client, remediate map[string]bool, force bool, report *reconcileReport) error {
 	oldState, err := s.LoadUsers()
 	if err != nil {
 		return err
 	}
 
-	scimUsers, err := client.GetUsers(ctx)
+	drift, err := detectUserDrift(ctx, client, oldState)
 	if err != nil {
 		return err
 	}
-	newState := make(map[string]models.UserRecord)
-	for _, u := range scimUsers {
-		if u.UserName == "" {
-			continue
-		}
-		status := "inactive"
-		if u.Active {
-			status = "active"
-		}
-		newState[u.UserName] = models.UserRecord{
-			SCIMID:       u.ID,
-			Email:        u.Emails[0].Value,
-			Status:       status,
-			Name:         u.Name,
-			Title:        u.Title,
-			Organization: u.EnterpriseData.Organization,
-		}
+	newState := drift.Live
+
+	for _, eppn := range slices.Sorted(maps.Keys(drift.Duplicates)) {
+		logAndAudit(ctx, s, "Refresh: Duplicate userName", eppn, "warn", "Several SmartSuite users share this userName; only the first SCIM id is stored.", "scim_ids", drift.Duplicates[eppn])
+		report.duplicateUserName(eppn, drift.Duplicates[eppn])
+	}
+	for _, eppn := range drift.Deleted {
+		logAndAudit(ctx, s, "Refresh: Delta Found", eppn, "info", "User deleted in SmartSuite directly.", "scim_id", oldState[eppn].SCIMID)
+		report.userDeleted(eppn, oldState[eppn].SCIMID)
+	}
+	for _, r := range drift.Renamed {
+		logAndAudit(ctx, s, "Refresh: Delta Found", r.From, "info", "User renamed in SmartSuite directly.", "scim_id", oldState[r.From].SCIMID, "to_username", r.To)
+		report.userChanged(r.From, oldState[r.From].SCIMID, []userDelta{{Field: "user_name", From: r.From, To: r.To}}, nil)
+	}
+	for _, eppn := range drift.Created {
+		logAndAudit(ctx, s, "Refresh: Delta Found", eppn, "info", "User created in SmartSuite directly.", "scim_id", newState[eppn].SCIMID)
+		report.userCreated(eppn, newState[eppn].SCIMID)
 	}
 
-	for eppn, newUser := range newState {
-		if oldUser, ok := oldState[eppn]; !ok {
-			logAndAudit(s, "Refresh: Delta Found", eppn, "info", "User created in SmartSuite directly.", "scim_id", newUser.SCIMID)
-		} else {
-			// Check for changes in key fields. Using reflect.DeepEqual for structs like Name.
-			if oldUser.Status != newUser.Status {
-				logAndAudit(s, "Refresh: Delta Found", eppn, "info", "User status changed outside of mediator.", "from_status", oldUser.Status, "to_status", newUser.Status)
+	for _, change := range drift.Changed {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		eppn, deltas := change.EPPN, change.Deltas
+		for _, d := range deltas {
+			logAndAudit(ctx, s, "Refresh: Delta Found", eppn, "info", fmt.Sprintf("User %s changed outside of mediator.", d.Field), "from_"+d.Field, d.From, "to_"+d.Field, d.To)
+		}
+		var remediated map[string]bool
+		if len(remediate) > 0 {
+			record, err := remediateUser(ctx, client, s, eppn, oldState[eppn], newState[eppn], deltas, remediate)
+			if exitCode(err) == exitMaintenance {
+				return err
 			}
-			if oldUser.Title != newUser.Title {
-				logAndAudit(s, "Refresh: Delta Found", eppn, "info", "User title changed outside of mediator.", "from_title", oldUser.Title, "to_title", newUser.Title)
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
-			if !reflect.DeepEqual(oldUser.Name, newUser.Name) {
-				logAndAudit(s, "Refresh: Delta Found", eppn, "info", "User name changed outside of mediator.")
+			if err != nil {
+				logAndAudit(ctx, s, "Refresh: Remediated", eppn, "error", "Failed to remediate drift. Keeping local values to retry on the next refresh.", "error", err)
+			} else {
+				remediated = remediate
 			}
+			newState[eppn] = record
 		}
+		report.userChanged(eppn, newState[eppn].SCIMID, deltas, remediated)
 	}
 
-	for eppn, oldUser := range oldState {
-		if _, ok := newState[eppn]; !ok {
-			logAndAudit(s, "Refresh: Delta Found", eppn, "info", "User deleted in SmartSuite directly.", "scim_id", oldUser.SCIMID)
-		}
+	// The store is replaced wholesale, so it must never be written from a run
+	// that was interrupted: newState would then drop every user not yet seen.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkShrink("users", len(oldState), len(newState), force); err != nil {
+		return err
 	}
-
 	if err := s.SaveUsers(newState); err != nil {
 		return err
 	}
@@ -126,39 +158,56 @@ func reconcileUsers(ctx context.Context, s *store.Store, client *smartsuite.Clie
 	return nil
 }
 
-func reconcileGroups(ctx context.Context, s *store.Store, client *smartsuite.Client) error {
+func reconcileGroups(ctx context.Context, s *store.Store, client *smartsuite.Client, force bool, report *reconcileReport) error {
 	oldState, err := s.LoadGroups()
 	if err != nil {
 		return err
 	}
 
-	scimGroups, err := client.GetGroups(ctx)
+	drift, err := detectGroupDrift(ctx, client, oldState)
 	if err != nil {
 		return err
 	}
-	newState := make(map[string]models.GroupRecord)
-	for _, g := range scimGroups {
-		if g.DisplayName == "" {
-			continue
-		}
-		newState[g.DisplayName] = models.GroupRecord{SCIMID: g.ID}
-	}
+	newState := drift.Live
 
-	for name, newGroup := range newState {
-		if _, ok := oldState[name]; !ok {
-			logAndAudit(s, "Refresh: Delta Found", name, "info", "Group created in SmartSuite directly.", "scim_id", newGroup.SCIMID)
-		}
+	for _, name := range drift.Created {
+		logAndAudit(ctx, s, "Refresh: Delta Found", name, "info", "Group created in SmartSuite directly.", "scim_id", newState[name].SCIMID)
+		report.groupCreated(name, newState[name].SCIMID)
 	}
-
-	for name, oldGroup := range oldState {
-		if _, ok := newState[name]; !ok {
-			logAndAudit(s, "Refresh: Delta Found", name, "info", "Group deleted in SmartSuite directly.", "scim_id", oldGroup.SCIMID)
+	for _, change := range drift.Changed {
+		name := change.Name
+		if change.FromExternalID != change.ToExternalID {
+			logAndAudit(ctx, s, "Refresh: Delta Found", name, "info", "Group external_id changed outside of mediator.", "from_external_id", change.FromExternalID, "to_external_id", change.ToExternalID)
+		}
+		for _, id := range change.Added {
+			logAndAudit(ctx, s, "Refresh: Delta Found", name, "info", "Group member added outside of mediator.", "member", memberLabel(s, id), "scim_id", id)
+		}
+		for _, id := range change.Removed {
+			logAndAudit(ctx, s, "Refresh: Delta Found", name, "info", "Group member removed outside of mediator.", "member", memberLabel(s, id), "scim_id", id)
 		}
+		report.groupChanged(name, newState[name].SCIMID, groupReportChanges(s, change))
+	}
+	for _, name := range drift.Deleted {
+		logAndAudit(ctx, s, "Refresh: Delta Found", name, "info", "Group deleted in SmartSuite directly.", "scim_id", oldState[name].SCIMID)
+		report.groupDeleted(name, oldState[name].SCIMID)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkShrink("groups", len(oldState), len(newState), force); err != nil {
+		return err
+	}
 	if err := s.SaveGroups(newState); err != nil {
 		return err
 	}
 	slog.Info("Group reconciliation complete.", "total_groups", len(newState))
 	return nil
 }
+
+func init() {
+	refreshCmd.Flags().StringSlice("remediate", nil, "Attributes to push back to SmartSuite when they drift from the local store instead of only logging them (e.g. status,title). Off by default.")
+	viper.BindPFlag("remediate", refreshCmd.Flags().Lookup("remediate"))
+	refreshCmd.Flags().Bool("force", false, "Save the live users and groups even when they are far fewer than the stored ones (see SMARTSUITE_MAX_SHRINK).")
+	refreshCmd.Flags().String("report", "", "Write the created, deleted and changed users and groups found to this JSON file ('-' for stdout). Written even if the run is cancelled.")
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+// reconcileReportVersion is bumped whenever the report layout changes in a
+// way consumers need to know about.
+const reconcileReportVersion = 1
+
+// reconcileReport is the machine-readable summary refresh --report writes.
+// Every method is a no-op on a nil report, so reconcile code can record into
+// it unconditionally.
+type reconcileReport struct {
+	SchemaVersion int           `json:"schema_version"`
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	Complete      bool          `json:"complete"`
+	Users         reportSection `json:"users"`
+	Groups        reportSection `json:"groups"`
+	// DuplicateUserNames lists userNames held by more than one SmartSuite user.
+	DuplicateUserNames []reportDuplicate `json:"duplicate_user_names"`
+}
+
+// reportDuplicate is a userName shared by several SmartSuite users. SCIMIDs
+// starts with the user kept in the local store.
+type reportDuplicate struct {
+	UserName string   `json:"user_name"`
+	SCIMIDs  []string `json:"scim_ids"`
+}
+
+// reportSection lists the resources of one type that were created, deleted or
+// changed in SmartSuite outside of the mediator.
+type reportSection struct {
+	Created []reportEntry `json:"created"`
+	Deleted []reportEntry `json:"deleted"`
+	Changed []reportEntry `json:"changed"`
+}
+
+// reportEntry is one resource in the report, keyed the way the local store
+// keys it (ePPN for users, display name for groups).
+type reportEntry struct {
+	Key     string         `json:"key"`
+	SCIMID  string         `json:"scim_id"`
+	Changes []reportChange `json:"changes,omitempty"`
+}
+
+// reportChange is the before and after value of one changed attribute.
+// Remediated is set when refresh --remediate pushed the local value back.
+type reportChange struct {
+	Field      string `json:"field"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Remediated bool   `json:"remediated,omitempty"`
+}
+
+func newReconcileReport() *reconcileReport {
+	return &reconcileReport{
+		SchemaVersion: reconcileReportVersion,
+		StartedAt:     time.Now().UTC(),
+		Users:         newReportSection(),
+		Groups:        newReportSection(),
+
+		DuplicateUserNames: []reportDuplicate{},
+	}
+}
+
+// newReportSection starts every list empty rather than nil, so consumers
+// always see arrays.
+func newReportSection() reportSection {
+	return reportSection{Created: []reportEntry{}, Deleted: []reportEntry{}, Changed: []reportEntry{}}
+}
+
+func (r *reconcileReport) userCreated(key, scimID string) {
+	if r != nil {
+		r.Users.Created = append(r.Users.Created, reportEntry{Key: key, SCIMID: scimID})
+	}
+}
+
+func (r *reconcileReport) userDeleted(key, scimID string) {
+	if r != nil {
+		r.Users.Deleted = append(r.Users.Deleted, reportEntry{Key: key, SCIMID: scimID})
+	}
+}
+
+// userChanged records the deltas found for a user; fields in remediated are
+// marked as pushed back to SmartSuite.
+func (r *reconcileReport) userChanged(key, scimID string, deltas []userDelta, remediated map[string]bool) {
+	if r == nil || len(deltas) == 0 {
+		return
+	}
+	entry := reportEntry{Key: key, SCIMID: scimID}
+	for _, d := range deltas {
+		entry.Changes = append(entry.Changes, reportChange{Field: d.Field, From: d.From, To: d.To, Remediated: remediated[d.Field]})
+	}
+	r.Users.Changed = append(r.Users.Changed, entry)
+}
+
+func (r *reconcileReport) duplicateUserName(userName string, scimIDs []string) {
+	if r != nil {
+		r.DuplicateUserNames = append(r.DuplicateUserNames, reportDuplicate{UserName: userName, SCIMIDs: scimIDs})
+	}
+}
+
+func (r *reconcileReport) groupCreated(key, scimID string) {
+	if r != nil {
+		r.Groups.Created = append(r.Groups.Created, reportEntry{Key: key, SCIMID: scimID})
+	}
+}
+
+func (r *reconcileReport) groupDeleted(key, scimID string) {
+	if r != nil {
+		r.Groups.Deleted = append(r.Groups.Deleted, reportEntry{Key: key, SCIMID: scimID})
+	}
+}
+
+func (r *reconcileReport) groupChanged(key, scimID string, changes []reportChange) {
+	if r != nil && len(changes) > 0 {
+		r.Groups.Changed = append(r.Groups.Changed, reportEntry{Key: key, SCIMID: scimID, Changes: changes})
+	}
+}
+
+// write stamps the report and writes it to path. complete is false when the
+// run was cancelled or failed, in which case the report covers only what was
+// compared before it stopped.
+func (r *reconcileReport) write(path string, complete bool) error {
+	if r == nil {
+		return nil
+	}
+	r.FinishedAt = time.Now().UTC()
+	r.Complete = complete
+	return writeResource(path, r)
+}
+
+// groupReportChanges renders a group's changes for the report, naming members
+// as memberLabel does.
+func groupReportChanges(s *store.Store, change groupChange) []reportChange {
+	var changes []reportChange
+	if change.FromExternalID != change.ToExternalID {
+		changes = append(changes, reportChange{Field: "external_id", From: change.FromExternalID, To: change.ToExternalID})
+	}
+	for _, id := range change.Added {
+		changes = append(changes, reportChange{Field: "member", To: memberLabel(s, id)})
+	}
+	for _, id := range change.Removed {
+		changes = append(changes, reportChange{Field: "member", From: memberLabel(s, id)})
+	}
+	return changes
+}
+
+// newDriftReport records detected drift into a report, for commands that
+// only look at drift without acting on it.
+func newDriftReport(s *store.Store, oldUsers map[string]models.UserRecord, users *userDrift, oldGroups map[string]models.GroupRecord, groups *groupDrift) *reconcileReport {
+	r := newReconcileReport()
+	for _, eppn := range slices.Sorted(maps.Keys(users.Duplicates)) {
+		r.duplicateUserName(eppn, users.Duplicates[eppn])
+	}
+	for _, eppn := range users.Created {
+		r.userCreated(eppn, users.Live[eppn].SCIMID)
+	}
+	for _, eppn := range users.Deleted {
+		r.userDeleted(eppn, oldUsers[eppn].SCIMID)
+	}
+	for _, rename := range users.Renamed {
+		r.userChanged(rename.From, oldUsers[rename.From].SCIMID, []userDelta{{Field: "user_name", From: rename.From, To: rename.To}}, nil)
+	}
+	for _, change := range users.Changed {
+		r.userChanged(change.EPPN, users.Live[change.EPPN].SCIMID, change.Deltas, nil)
+	}
+	for _, name := range groups.Created {
+		r.groupCreated(name, groups.Live[name].SCIMID)
+	}
+	for _, name := range groups.Deleted {
+		r.groupDeleted(name, oldGroups[name].SCIMID)
+	}
+	for _, change := range groups.Changed {
+		r.groupChanged(change.Name, groups.Live[change.Name].SCIMID, groupReportChanges(s, change))
+	}
+	r.FinishedAt = time.Now().UTC()
+	r.Complete = true
+	return r
+}
+
+// writeText prints the report as an indented list: + for created, - for
+// deleted and ~ for changed, with one line per changed attribute.
+func (r *reconcileReport) writeText(out io.Writer) {
+	for _, section := range []struct {
+		name string
+		reportSection
+	}{{"users", r.Users}, {"groups", r.Groups}} {
+		fmt.Fprintf(out, "%s:\n", section.name)
+		if len(section.Created)+len(section.Deleted)+len(section.Changed) == 0 {
+			fmt.Fprintln(out, "  (in sync)")
+			continue
+		}
+		for _, e := range section.Created {
+			fmt.Fprintf(out, "  + %s (%s)\n", e.Key, e.SCIMID)
+		}
+		for _, e := range section.Deleted {
+			fmt.Fprintf(out, "  - %s (%s)\n", e.Key, e.SCIMID)
+		}
+		for _, e := range section.Changed {
+			fmt.Fprintf(out, "  ~ %s (%s)\n", e.Key, e.SCIMID)
+			for _, c := range e.Changes {
+				fmt.Fprintf(out, "      %s: %q → %q\n", c.Field, c.From, c.To)
+			}
+		}
+	}
+	if len(r.DuplicateUserNames) > 0 {
+		fmt.Fprintln(out, "duplicate userNames:")
+		for _, d := range r.DuplicateUserNames {
+			fmt.Fprintf(out, "  ! %s (%s)\n", d.UserName, strings.Join(d.SCIMIDs, ", "))
+		}
+	}
+}
+
+// empty reports whether the report lists no drift at all.
+func (r *reconcileReport) empty() bool {
+	for _, section := range []reportSection{r.Users, r.Groups} {
+		if len(section.Created)+len(section.Deleted)+len(section.Changed) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/viper"
+)
+
+func TestRefreshUsersWithoutUserName(t *testing.T) {
+	nameless := models.SCIMUser{ID: "n9", Active: true, Emails: []models.SCIMEmail{{Value: "n9@example.edu", Primary: true}}}
+	alice := models.SCIMUser{ID: "a1", UserName: "alice@example.edu", Active: true, Emails: []models.SCIMEmail{{Value: "alice@example.edu", Primary: true}}}
+
+	tests := []struct {
+		name      string
+		setting   string
+		wantKeys  []string
+		wantInLog string
+	}{
+		{name: "skip by default", setting: "", wantKeys: []string{"alice@example.edu"}, wantInLog: "will not be stored"},
+		{name: "stored under SCIM ID", setting: "scim_id", wantKeys: []string{"alice@example.edu", "n9"}, wantInLog: "Storing it under its SCIM ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("missing_username", tt.setting)
+			t.Cleanup(func() { viper.Set("missing_username", "") })
+			logs := captureLogs(t)
+			fake := newFakeSCIM(t, alice, nameless)
+			dataDir := seedDataDir(t, map[string]models.UserRecord{})
+
+			runCommand(t, fake, dataDir, "refresh")
+
+			if !strings.Contains(logs.String(), tt.wantInLog) || !strings.Contains(logs.String(), "scim_id=n9") {
+				t.Errorf("log does not report user n9 with %q:\n%s", tt.wantInLog, logs)
+			}
+			s, err := store.NewStore(dataDir)
+			if err != nil {
+				t.Fatalf("NewStore: %v", err)
+			}
+			defer s.Close()
+			users, err := s.LoadUsers()
+			if err != nil {
+				t.Fatalf("LoadUsers: %v", err)
+			}
+			if len(users) != len(tt.wantKeys) {
+				t.Errorf("store has %d users, want %v", len(users), tt.wantKeys)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := users[key]; !ok {
+					t.Errorf("store has no user %q", key)
+				}
+			}
+		})
+	}
+}
+
+func TestRefreshChecksMissingUsersByID(t *testing.T) {
+	// carol was renamed in SmartSuite, so the listing only has her new
+	// userName; dave was deleted; erin was stored without a SCIM ID.
+	email := []models.SCIMEmail{{Value: "x@example.edu", Primary: true}}
+	fake := newFakeSCIM(t,
+		models.SCIMUser{ID: "a1", UserName: "alice@example.edu", Active: true, Emails: email},
+		models.SCIMUser{ID: "c3", UserName: "carol@new.example.edu", Active: true, Emails: email},
+	)
+	dataDir := seedDataDir(t, map[string]models.UserRecord{
+		"alice@example.edu": {SCIMID: "a1", Status: "active", Email: "x@example.edu"},
+		"carol@example.edu": {SCIMID: "c3", Status: "active", Email: "x@example.edu"},
+		"dave@example.edu":  {SCIMID: "d4", Status: "active"},
+		"erin@example.edu":  {Status: "active"},
+	})
+
+	runCommand(t, fake, dataDir, "refresh")
+
+	deltas := make(map[string]string)
+	for _, event := range readAudit(t, dataDir) {
+		if event.UseCase == "Refresh: Delta Found" {
+			deltas[event.Target] = event.Details
+		}
+	}
+	for target, want := range map[string]string{
+		"carol@example.edu": "renamed",
+		"dave@example.edu":  "deleted",
+		"erin@example.edu":  "deleted",
+	} {
+		if !strings.Contains(deltas[target], want) {
+			t.Errorf("delta for %s = %q, want it reported as %s", target, deltas[target], want)
+		}
+	}
+	if _, ok := deltas["carol@new.example.edu"]; ok {
+		t.Errorf("carol's new userName was reported as a created user: %q", deltas["carol@new.example.edu"])
+	}
+
+	calls := fake.calls()
+	for _, want := range []string{"GET /Users/c3", "GET /Users/d4"} {
+		if !slices.Contains(calls, want) {
+			t.Errorf("requests %v do not include %s", calls, want)
+		}
+	}
+	if slices.Contains(calls, "GET /Users/") {
+		t.Errorf("requests %v fetched the user without a SCIM ID", calls)
+	}
+}
+
+func TestRunRefreshCancelledLeavesStoreUnchanged(t *testing.T) {
+	// SmartSuite has a user the store does not know about, so a refresh that
+	// got as far as saving would change the store.
+	fake := newFakeSCIM(t, models.SCIMUser{ID: "b2", UserName: "bob@example.edu", Active: true})
+	fake.listGate = make(chan struct{})
+	stored := map[string]models.UserRecord{
+		"alice@example.edu": {SCIMID: "a1", Status: "active"},
+	}
+	s, err := store.NewStore(seedDataDir(t, stored))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = runRefresh(ctx, s, fake.client(t), nil, false, newReconcileReport())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("runRefresh error = %v, want context.Canceled", err)
+	}
+
+	got, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	if !reflect.DeepEqual(got, stored) {
+		t.Errorf("store after a cancelled refresh = %v, want it unchanged %v", got, stored)
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+)
+
+// remediation pushes one tracked attribute of the local record back to
+// SmartSuite. ops builds the PATCH that sets it to the local value, and keep
+// copies the local value over the live one so the store stays authoritative.
+type remediation struct {
+	ops  func(local models.UserRecord) []models.SCIMPatchOp
+	keep func(record *models.UserRecord, local models.UserRecord)
+}
+
+// replaceOp returns a remediation op builder that replaces path with the
+// value get reads from the local record.
+func replaceOp(path string, get func(models.UserRecord) interface{}) func(models.UserRecord) []models.SCIMPatchOp {
+	return func(local models.UserRecord) []models.SCIMPatchOp {
+		return []models.SCIMPatchOp{{Op: "replace", Path: path, Value: get(local)}}
+	}
+}
+
+// remediations are the attributes refresh --remediate can push back, keyed by
+// the field names refresh reports deltas under.
+var remediations = map[string]remediation{
+	"status": {
+		ops: replaceOp("active", func(r models.UserRecord) interface{} { return r.Status == "active" }),
+		keep: func(r *models.UserRecord, l models.UserRecord) {
+			r.Status, r.DeactivationTimestamp = l.Status, l.DeactivationTimestamp
+		},
+	},
+	"title": {
+		ops:  replaceOp("title", func(r models.UserRecord) interface{} { return r.Title }),
+		keep: func(r *models.UserRecord, l models.UserRecord) { r.Title = l.Title },
+	},
+	"organization": {
+		ops:  replaceOp(updatePath("organization"), func(r models.UserRecord) interface{} { return r.Organization }),
+		keep: func(r *models.UserRecord, l models.UserRecord) { r.Organization = l.Organization },
+	},
+	"department": {
+		ops:  replaceOp(updatePath("department"), func(r models.UserRecord) interface{} { return r.Department }),
+		keep: func(r *models.UserRecord, l models.UserRecord) { r.Department = l.Department },
+	},
+	"cost_center": {
+		ops:  replaceOp(updatePath("costCenter"), func(r models.UserRecord) interface{} { return r.CostCenter }),
+		keep: func(r *models.UserRecord, l models.UserRecord) { r.CostCenter = l.CostCenter },
+	},
+	"division": {
+		ops:  replaceOp(updatePath("division"), func(r models.UserRecord) interface{} { return r.Division }),
+		keep: func(r *models.UserRecord, l models.UserRecord) { r.Division = l.Division },
+	},
+	"employee_number": {
+		ops:  replaceOp(updatePath("employeeNumber"), func(r models.UserRecord) interface{} { return r.EmployeeNumber }),
+		keep: func(r *models.UserRecord, l models.UserRecord) { r.EmployeeNumber = l.EmployeeNumber },
+	},
+}
+
+// parseRemediate validates the attribute names given to --remediate.
+func parseRemediate(names []string) (map[string]bool, error) {
+	fields := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := remediations[name]; !ok {
+			supported := make([]string, 0, len(remediations))
+			for field := range remediations {
+				supported = append(supported, field)
+			}
+			sort.Strings(supported)
+			return nil, fmt.Errorf("attribute '%s' cannot be remediated; supported attributes are %s", name, strings.Join(supported, ", "))
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// remediateUser patches SmartSuite so that every delta on a remediated field
+// is reverted to the local value, and returns the record to store: the live
+// record with those fields kept at their local values. The local values, and
+// the local lastModified, are kept even if the PATCH fails so the drift is
+// found and retried on the next refresh; the error is returned for the caller
+// to report.
+func remediateUser(ctx context.Context, client *smartsuite.Client, s *store.Store, eppn string, local, live models.UserRecord, deltas []userDelta, fields map[string]bool) (models.UserRecord, error) {
+	var ops []models.SCIMPatchOp
+	var remediated []userDelta
+	for _, d := range deltas {
+		if !fields[d.Field] {
+			continue
+		}
+		r := remediations[d.Field]
+		ops = append(ops, r.ops(local)...)
+		r.keep(&live, local)
+		remediated = append(remediated, d)
+	}
+	if len(ops) == 0 {
+		return live, nil
+	}
+
+	// The live ETag is only moments old, so a concurrent edit in SmartSuite
+	// makes the PATCH fail instead of being overwritten.
+	if err := patchRecord(ctx, client, &live, ops); err != nil {
+		live.LastModified = local.LastModified
+		return live, err
+	}
+	for _, d := range remediated {
+		logAndAudit(ctx, s, "Refresh: Remediated", eppn, "info", fmt.Sprintf("User %s reverted to the local value in SmartSuite.", d.Field), "from_"+d.Field, d.To, "to_"+d.Field, d.From)
+	}
+	return live, nil
+}
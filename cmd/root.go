@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
 
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/logger"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -14,6 +18,12 @@ var (
 	cfgFile string
 	// Variable to hold the value of the debug flag
 	debug bool
+	// logLevel is the level the logger was configured with for this command.
+	logLevel = slog.LevelInfo
+	// commandDeadline is the context --timeout wraps the command in, and
+	// cancelDeadline releases it. Both are nil without a timeout.
+	commandDeadline context.Context
+	cancelDeadline  context.CancelFunc
 )
 
 var rootCmd = &cobra.Command{
@@ -21,11 +31,41 @@ var rootCmd = &cobra.Command{
 	Short: "A trusted mediator for SCIM interactions with SmartSuite.",
 	Long: `scim-mediator is a CLI application that provides a reliable and auditable
 way to manage the identity lifecycle for a SmartSuite tenant.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := configureLogging(); err != nil {
+			slog.Error("Failed to set up logging", "error", err)
+			os.Exit(1)
+		}
+		if err := initTracing(cmd.Context()); err != nil {
+			slog.Warn("Tracing is disabled", "error", err)
+		}
+		cmd.SetContext(startCommandSpan(cmd))
+		// Each invocation is one audit transaction; every event it records shares
+		// the ID. Commands made of several independent operations, such as
+		// process-batch, start a new transaction for each.
+		cmd.SetContext(withTransaction(cmd.Context()))
+		// The deadline sits under the signal context from main, so either one
+		// cancels the command.
+		if timeout := viper.GetDuration("timeout"); timeout > 0 {
+			commandDeadline, cancelDeadline = context.WithTimeout(cmd.Context(), timeout)
+			cmd.SetContext(commandDeadline)
+		}
+	},
 }
 
 // ExecuteContext executes the root command with a given context.
 func ExecuteContext(ctx context.Context) {
-	if err := rootCmd.ExecuteContext(ctx); err != nil {
+	err := rootCmd.ExecuteContext(ctx)
+	if cancelDeadline != nil {
+		// Commands that stop early on a cancelled context return normally, so
+		// a timeout is turned into a failure here.
+		if err == nil && errors.Is(commandDeadline.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("command did not finish within --timeout: %w", commandDeadline.Err())
+		}
+		cancelDeadline()
+	}
+	endTracing(err)
+	if err != nil {
 		slog.Error("Command execution failed", "error", err)
 		os.Exit(1)
 	}
@@ -36,7 +76,21 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cobra.yaml)")
 	// Define the global --debug flag
-	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enable debug level logging.")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enable debug level logging. Shortcut for --log-level debug.")
+	rootCmd.PersistentFlags().String("log-level", "info", "Lowest level of log lines to write: 'debug', 'info', 'warn' or 'error'.")
+	viper.BindPFlag("log_level", rootCmd.PersistentFlags().Lookup("log-level"))
+	rootCmd.PersistentFlags().Duration("lock-timeout", 0, "How long to wait for another mediator process to release the data directory lock (e.g. 30s). By default the command fails immediately.")
+	viper.BindPFlag("lock_timeout", rootCmd.PersistentFlags().Lookup("lock-timeout"))
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Fail the command if it has not finished within this long (e.g. 30m). By default there is no limit.")
+	viper.BindPFlag("timeout", rootCmd.PersistentFlags().Lookup("timeout"))
+	rootCmd.PersistentFlags().String("data-dir", "", "Directory holding the local store (users.json, groups.json, audit.log). Overrides SMARTSUITE_DATA_DIR and the config file; defaults to ./data.")
+	viper.BindPFlag("data_dir", rootCmd.PersistentFlags().Lookup("data-dir"))
+	rootCmd.PersistentFlags().Bool("log-bodies", false, "With --debug, also log API request and response bodies, with credentials, passwords and SMARTSUITE_LOG_REDACT_FIELDS redacted.")
+	viper.BindPFlag("log_bodies", rootCmd.PersistentFlags().Lookup("log-bodies"))
+	rootCmd.PersistentFlags().String("log-output", logger.OutputStderr, "Where to write log lines: 'stderr', 'stdout' or the path of a file to append to.")
+	viper.BindPFlag("log_output", rootCmd.PersistentFlags().Lookup("log-output"))
+	rootCmd.PersistentFlags().String("log-format", logger.FormatAuto, "Log line format: 'json', 'text', or 'auto' for text when logging to a terminal and JSON otherwise.")
+	viper.BindPFlag("log_format", rootCmd.PersistentFlags().Lookup("log-format"))
 
 	// Add sub-commands here
 	rootCmd.AddCommand(populateCmd)
@@ -46,6 +100,41 @@ func init() {
 	rootCmd.AddCommand(manageGroupMembersCmd)
 	rootCmd.AddCommand(processBatchCmd)
 	rootCmd.AddCommand(cleanupUsersCmd)
+	rootCmd.AddCommand(cleanupPreviewCmd)
+	rootCmd.AddCommand(vacuumStoreCmd)
+	rootCmd.AddCommand(deactivateStaleCmd)
+	rootCmd.AddCommand(deactivateUserCmd)
+	rootCmd.AddCommand(batchReportCmd)
+	rootCmd.AddCommand(listUsersCmd)
+	rootCmd.AddCommand(listGroupsCmd)
+	rootCmd.AddCommand(showUserCmd)
+	rootCmd.AddCommand(validateBatchCmd)
+	rootCmd.AddCommand(undoBatchCmd)
+	rootCmd.AddCommand(preflightCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importUsersCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(serveHTTPCmd)
+}
+
+// configureLogging points the logger set up in main at the log_output
+// destination in the log_format and at the log_level, once flags and the
+// config file have been read. --debug takes precedence over log_level.
+func configureLogging() error {
+	level, err := logger.ParseLevel(viper.GetString("log_level"))
+	if err != nil {
+		return err
+	}
+	if debug {
+		level = slog.LevelDebug
+	}
+	out, err := logger.OpenOutput(viper.GetString("log_output"))
+	if err != nil {
+		return err
+	}
+	logLevel = level
+	return logger.Configure(level, out, viper.GetString("log_format"))
 }
 
 func initConfig() {
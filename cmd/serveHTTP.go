@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// sharedSecretHeader carries the secret every serve-http request must present.
+const sharedSecretHeader = "X-Mediator-Secret"
+
+// maxRequestBytes caps the size of a serve-http request body.
+const maxRequestBytes = 1 << 20
+
+// shutdownTimeout is how long serve-http waits for in-flight requests to
+// finish once a shutdown signal arrives.
+const shutdownTimeout = 30 * time.Second
+
+var serveHTTPCmd = &cobra.Command{
+	Use:   "serve-http",
+	Short: "Serves an HTTP API for provisioning single users from IdP events.",
+	Long: `Listens on --addr for lifecycle events from an identity provider and applies
+them exactly as the matching CLI commands would:
+
+  POST  /users                   create a user (the create-user JSON body)
+  PATCH /users/{eppn}            update attributes (an update task's data map)
+  POST  /users/{eppn}/deactivate deactivate a user
+
+Every request must carry the shared secret from SMARTSUITE_HTTP_SHARED_SECRET in
+the X-Mediator-Secret header. The secret and user data travel in every request,
+so the server only speaks plain HTTP on a loopback address; to listen on any
+other address, give it a certificate with --tls-cert and --tls-key. Responses are JSON: the resulting store record on
+success, or an error object. Requests are handled one at a time, and the local
+store is only held open while a request is being handled, so other commands can
+use the data directory in between. On Ctrl+C or SIGTERM the server stops
+accepting connections and exits once in-flight requests have finished.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		addr, _ := cmd.Flags().GetString("addr")
+		certFile, _ := cmd.Flags().GetString("tls-cert")
+		keyFile, _ := cmd.Flags().GetString("tls-key")
+		if (certFile == "") != (keyFile == "") {
+			slog.Error("--tls-cert and --tls-key must be set together.")
+			os.Exit(1)
+		}
+		if err := checkListenAddr(addr, certFile != ""); err != nil {
+			slog.Error("Refusing to start the HTTP server", "error", err)
+			os.Exit(1)
+		}
+
+		secret := viper.GetString("http_shared_secret")
+		if secret == "" {
+			slog.Error("serve-http needs a shared secret. Set SMARTSUITE_HTTP_SHARED_SECRET.")
+			os.Exit(1)
+		}
+
+		client, err := commandClient(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
+			os.Exit(1)
+		}
+
+		srv := &http.Server{
+			Addr:              addr,
+			Handler:           newProvisioningHandler(client, secret),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			slog.Info("Starting HTTP server", "addr", addr, "tls", certFile != "")
+			if certFile != "" {
+				errCh <- srv.ListenAndServeTLS(certFile, keyFile)
+				return
+			}
+			errCh <- srv.ListenAndServe()
+		}()
+
+		select {
+		case err := <-errCh:
+			slog.Error("HTTP server failed", "error", err)
+			os.Exit(1)
+		case <-ctx.Done():
+		}
+
+		slog.Info("Shutdown signal received, waiting for in-flight requests to finish...")
+		// ctx is already cancelled; give in-flight requests their own deadline.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("HTTP server did not shut down cleanly", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("HTTP server stopped.")
+	},
+}
+
+// provisioningServer maps the serve-http endpoints onto the same client and
+// store logic the CLI commands use.
+type provisioningServer struct {
+	client *smartsuite.Client
+	secret string
+	// mu serializes requests: the store lock is per process, and each request
+	// loads, changes and saves the user store as a whole.
+	mu sync.Mutex
+}
+
+// httpError is the structured error body serve-http responds with.
+type httpError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// userResponse is the body of a successful serve-http response.
+type userResponse struct {
+	EPPN   string            `json:"eppn"`
+	Record models.UserRecord `json:"record"`
+}
+
+func newProvisioningHandler(client *smartsuite.Client, secret string) http.Handler {
+	p := &provisioningServer{client: client, secret: secret}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /users", p.handle("HTTP CreateUser", p.createUser))
+	mux.HandleFunc("PATCH /users/{eppn}", p.handle("HTTP UpdateUser", p.updateUser))
+	mux.HandleFunc("POST /users/{eppn}/deactivate", p.handle("HTTP DeactivateUser", p.deactivateUser))
+	return mux
+}
+
+// userHandler handles one authenticated request against the open store and
+// returns the status and body to respond with.
+type userHandler func(ctx context.Context, r *http.Request, s *store.Store) (int, *userResponse, error)
+
+// handle wraps h with authentication, request serialization, opening and
+// closing the store, and JSON encoding of the outcome. Each request is its
+// own audit transaction.
+func (p *provisioningServer) handle(useCase string, h userHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(sharedSecretHeader)), []byte(p.secret)) != 1 {
+			slog.Warn("Rejected HTTP request with a missing or wrong shared secret", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, httpError{Status: http.StatusUnauthorized, Message: "missing or invalid " + sharedSecretHeader + " header"})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		ctx := withTransaction(r.Context())
+		s, err := newStore(resolveDataDir())
+		if err != nil {
+			writeHTTPError(w, useCase, r.PathValue("eppn"), err)
+			return
+		}
+		defer s.Close()
+
+		status, resp, err := h(ctx, r, s)
+		if err != nil {
+			writeHTTPError(w, useCase, r.PathValue("eppn"), err)
+			return
+		}
+		writeJSON(w, status, resp)
+	}
+}
+
+// createUser provisions the user in the request body, with the same
+// duplicate checks as create-user.
+func (p *provisioningServer) createUser(ctx context.Context, r *http.Request, s *store.Store) (int, *userResponse, error) {
+	var newUser models.SCIMUser
+	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
+		return 0, nil, badRequest("invalid user JSON: %s", err)
+	}
+	eppn := newUser.UserName
+	if eppn == "" {
+		return 0, nil, badRequest("user must contain a 'userName' (ePPN)")
+	}
+
+	userStore, err := s.LoadUsers()
+	if err != nil {
+		return 0, nil, err
+	}
+	existing, inStore, err := lookupUser(ctx, p.client, userStore, eppn)
+	if err != nil {
+		return 0, nil, err
+	}
+	if existing != nil || inStore {
+		return 0, nil, &statusError{status: http.StatusConflict, message: fmt.Sprintf("user '%s' already exists", eppn)}
+	}
+
+	logAndAudit(ctx, s, "HTTP CreateUser", eppn, "info", "Attempting to create user...")
+	createdUser, err := p.client.CreateUser(ctx, newUser)
+	if err != nil {
+		logAndAudit(ctx, s, "HTTP CreateUser", eppn, "error", "Failed to create user via API", "error", err)
+		return 0, nil, err
+	}
+	if createdUser.ID == "" {
+		logAndAudit(ctx, s, "HTTP CreateUser", eppn, "error", "API accepted the new user but returned no SCIM id. Run 'refresh' to pick it up.")
+		return 0, nil, errors.New("API accepted the new user but returned no SCIM id; run 'refresh' to pick it up")
+	}
+
+	record := newCreatedUserRecord(*createdUser)
+	resolveManager(s, &record)
+	if err := s.UpsertUser(eppn, record); err != nil {
+		logAndAudit(ctx, s, "HTTP CreateUser", eppn, "fatal", "API user creation succeeded, but failed to save to local store. MANUAL INTERVENTION REQUIRED.", "scim_id", createdUser.ID, "error", err)
+		return 0, nil, err
+	}
+	logAndAudit(ctx, s, "HTTP CreateUser", eppn, "info", "Successfully created user.", "scim_id", createdUser.ID)
+	return http.StatusCreated, &userResponse{EPPN: eppn, Record: record}, nil
+}
+
+// updateUser applies the attribute map in the request body exactly as an
+// update task in process-batch would.
+func (p *provisioningServer) updateUser(ctx context.Context, r *http.Request, s *store.Store) (int, *userResponse, error) {
+	eppn := r.PathValue("eppn")
+	var data map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		return 0, nil, badRequest("invalid update JSON: %s", err)
+	}
+	operations, err := updateOperations(data)
+	if err != nil {
+		return 0, nil, badRequest("invalid update: %s", err)
+	}
+	if len(operations) == 0 {
+		return 0, nil, badRequest("no update operations provided")
+	}
+
+	userStore, err := s.LoadUsers()
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, ok := userStore[eppn]; !ok {
+		return 0, nil, notInStore(eppn)
+	}
+
+	logAndAudit(ctx, s, "HTTP UpdateUser", eppn, "info", "Attempting to update user.")
+	task := &models.JobTask{Type: "update", Target: eppn, Data: data}
+	if err := handleUpdateTask(ctx, p.client, s, userStore, task); err != nil {
+		logAndAudit(ctx, s, "HTTP UpdateUser", eppn, "error", "Failed to update user", "error", err)
+		return 0, nil, err
+	}
+	logAndAudit(ctx, s, "HTTP UpdateUser", eppn, "info", "Successfully updated user.")
+
+	// A userName change moves the record to its new key.
+	if renamed := newUserName(data); renamed != "" {
+		eppn = renamed
+	}
+	return http.StatusOK, &userResponse{EPPN: eppn, Record: userStore[eppn]}, nil
+}
+
+// deactivateUser deactivates the user as deactivate-user does. Deactivating
+// an inactive user is a no-op, so the grace period is not restarted.
+func (p *provisioningServer) deactivateUser(ctx context.Context, r *http.Request, s *store.Store) (int, *userResponse, error) {
+	eppn := r.PathValue("eppn")
+	userStore, err := s.LoadUsers()
+	if err != nil {
+		return 0, nil, err
+	}
+	record, ok := userStore[eppn]
+	if !ok {
+		return 0, nil, notInStore(eppn)
+	}
+	if record.Status == "inactive" {
+		return http.StatusOK, &userResponse{EPPN: eppn, Record: record}, nil
+	}
+
+	logAndAudit(ctx, s, "HTTP DeactivateUser", eppn, "info", "Attempting to deactivate user.", "scim_id", record.SCIMID)
+	if err := deactivateUser(ctx, p.client, s, userStore, eppn); err != nil {
+		logAndAudit(ctx, s, "HTTP DeactivateUser", eppn, "error", "Failed to deactivate user", "error", err)
+		return 0, nil, err
+	}
+	logAndAudit(ctx, s, "HTTP DeactivateUser", eppn, "info", "Successfully deactivated user.")
+	return http.StatusOK, &userResponse{EPPN: eppn, Record: userStore[eppn]}, nil
+}
+
+// checkListenAddr refuses plain HTTP on an address other than loopback, where
+// the shared secret and user data would cross the network in the clear.
+func checkListenAddr(addr string, useTLS bool) error {
+	if useTLS {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid --addr '%s': %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("'%s' is not a loopback address; set --tls-cert and --tls-key to serve HTTPS, or listen on 127.0.0.1 behind a TLS-terminating proxy", addr)
+}
+
+// statusError is an error with the HTTP status serve-http should answer with.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &statusError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func notInStore(eppn string) error {
+	return &statusError{status: http.StatusNotFound, message: fmt.Sprintf("user '%s' not found in local store; run 'refresh' if they were created outside the mediator", eppn)}
+}
+
+// httpStatus maps an error to the status serve-http answers with.
+func httpStatus(err error) int {
+	var se *statusError
+	var maintenance *smartsuite.MaintenanceError
+	switch {
+	case errors.As(err, &se):
+		return se.status
+	case errors.Is(err, smartsuite.ErrPreconditionFailed):
+		return http.StatusConflict
+	case errors.As(err, &maintenance), errors.Is(err, store.ErrLocked):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	}
+	var apiErr *smartsuite.StatusError
+	if errors.As(err, &apiErr) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+func writeHTTPError(w http.ResponseWriter, useCase, eppn string, err error) {
+	status := httpStatus(err)
+	slog.Warn("HTTP request failed", "use_case", useCase, "target", eppn, "status", status, "error", err)
+	writeJSON(w, status, httpError{Status: status, Message: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write HTTP response", "error", err)
+	}
+}
+
+func init() {
+	serveHTTPCmd.Flags().String("addr", "127.0.0.1:8080", "Address to listen on. Addresses other than loopback need --tls-cert and --tls-key.")
+	serveHTTPCmd.Flags().String("tls-cert", "", "PEM certificate file to serve HTTPS with, including any intermediates.")
+	serveHTTPCmd.Flags().String("tls-key", "", "PEM private key file for --tls-cert.")
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/viper"
+)
+
+func TestCheckListenAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		useTLS  bool
+		wantErr bool
+	}{
+		{"127.0.0.1:8080", false, false},
+		{"[::1]:8080", false, false},
+		{"localhost:8080", false, false},
+		{":8080", false, true},
+		{"0.0.0.0:8080", false, true},
+		{"10.0.0.5:8080", false, true},
+		{":8443", true, false},
+		{"8080", false, true},
+	}
+	for _, tt := range tests {
+		err := checkListenAddr(tt.addr, tt.useTLS)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkListenAddr(%q, %v) = %v, want error %v", tt.addr, tt.useTLS, err, tt.wantErr)
+		}
+	}
+}
+
+func TestServeHTTPRenameRespondsWithNewUserName(t *testing.T) {
+	fake := newFakeSCIM(t, models.SCIMUser{ID: "a1", UserName: "alice@example.edu", Active: true})
+	dataDir := seedDataDir(t, map[string]models.UserRecord{
+		"alice@example.edu": {SCIMID: "a1", Status: "active"},
+	})
+	viper.Set("data_dir", dataDir)
+	t.Cleanup(func() { viper.Set("data_dir", "") })
+	srv := httptest.NewServer(newProvisioningHandler(fake.client(t), "secret"))
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequest(http.MethodPatch, srv.URL+"/users/alice@example.edu", strings.NewReader(`{"userName":"alice.b@example.edu"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(sharedSecretHeader, "secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var resp userResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if resp.EPPN != "alice.b@example.edu" || resp.Record.SCIMID != "a1" {
+		t.Errorf("response = %+v, want the record under its new userName", resp)
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/cobra"
+)
+
+// clientKey is the context key under which withClient stores a client.
+type clientKey struct{}
+
+// withClient returns a copy of ctx carrying client. Commands run with that
+// context use it instead of building one from the configuration, which lets
+// tests point a command at a fake server.
+func withClient(ctx context.Context, client *smartsuite.Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// commandClient returns the client carried by the command's context, or
+// builds one from the configuration when there is none.
+func commandClient(cmd *cobra.Command) (*smartsuite.Client, error) {
+	if ctx := cmd.Context(); ctx != nil {
+		if client, ok := ctx.Value(clientKey{}).(*smartsuite.Client); ok {
+			return client, nil
+		}
+	}
+	client, err := newClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API client: %w", err)
+	}
+	return client, nil
+}
+
+// setup returns the command's API client and opens the store in the
+// configured data directory, for commands that need both. The returned error
+// says which of the two failed.
+func setup(cmd *cobra.Command) (*smartsuite.Client, *store.Store, error) {
+	client, err := commandClient(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := newStore(resolveDataDir())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create store: %w", err)
+	}
+	return client, s, nil
+}
+
+// setupReadOnly is setup for commands that only read the store, which it
+// opens with newReadOnlyStore.
+func setupReadOnly(cmd *cobra.Command) (*smartsuite.Client, *store.Store, error) {
+	client, err := commandClient(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := newReadOnlyStore(resolveDataDir())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open store: %w", err)
+	}
+	return client, s, nil
+}
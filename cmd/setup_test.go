@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCommandClientUsesInjectedClient(t *testing.T) {
+	fake := newFakeSCIM(t)
+	want := fake.client(t)
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(withClient(context.Background(), want))
+	got, err := commandClient(cmd)
+	if err != nil {
+		t.Fatalf("commandClient: %v", err)
+	}
+	if got != want {
+		t.Errorf("commandClient = %p, want the injected client %p", got, want)
+	}
+}
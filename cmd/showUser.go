@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/cobra"
+)
+
+var showUserCmd = &cobra.Command{
+	Use:   "show-user",
+	Short: "Shows everything known about a single user.",
+	Long: `Prints the user's record from the local store. With --live the user is also
+fetched from SmartSuite and shown side by side with the local record; rows that
+differ are marked with '*', using the same comparison as refresh. Exits non-zero
+if the user is found in neither place. This command is read-only.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		eppn, _ := cmd.Flags().GetString("user")
+		live, _ := cmd.Flags().GetBool("live")
+		out := cmd.OutOrStdout()
+
+		dataDir := resolveDataDir()
+		s, err := newReadOnlyStore(dataDir)
+		if err != nil {
+			slog.Error("Failed to open store", "error", err)
+			os.Exit(1)
+		}
+		userStore, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load local user store", "error", err)
+			os.Exit(1)
+		}
+		local, inStore := userStore[eppn]
+
+		if !live {
+			if !inStore {
+				slog.Error("User not found in local store.", "eppn", eppn)
+				os.Exit(1)
+			}
+			data, _ := json.MarshalIndent(listedUser{EPPN: eppn, UserRecord: local}, "", "  ")
+			fmt.Fprintln(out, string(data))
+			return
+		}
+
+		client, err := commandClient(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
+			os.Exit(1)
+		}
+		liveUser, err := client.GetUserByUsername(ctx, eppn)
+		if err != nil {
+			slog.Error("Failed to get user from API", "error", err)
+			os.Exit(exitCode(err))
+		}
+		if liveUser == nil && !inStore {
+			slog.Error("User not found in the local store or in SmartSuite.", "eppn", eppn)
+			os.Exit(1)
+		}
+		if !inStore {
+			slog.Warn("User exists in SmartSuite but not in the local store. Run 'refresh' to import them.", "eppn", eppn)
+		}
+		if liveUser == nil {
+			slog.Warn("User is in the local store but was not found in SmartSuite.", "eppn", eppn)
+		}
+
+		var liveRecord *models.UserRecord
+		if liveUser != nil {
+			r := newUserRecord(*liveUser)
+			resolveManager(s, &r)
+			liveRecord = &r
+		}
+		var localRecord *models.UserRecord
+		if inStore {
+			localRecord = &local
+		}
+		writeUserComparison(out, localRecord, liveRecord)
+	},
+}
+
+// writeUserComparison prints the local and live versions of a user side by
+// side. Either may be nil when the user is missing on that side; present
+// values that differ are marked with '*'.
+func writeUserComparison(out io.Writer, local, live *models.UserRecord) {
+	changed := make(map[string]bool)
+	if local != nil && live != nil {
+		for _, d := range detectUserDeltas(*local, *live) {
+			changed[d.Field] = true
+		}
+	}
+
+	column := func(r *models.UserRecord) (string, []userField) {
+		if r == nil {
+			return "(missing)", make([]userField, len(userFields(models.UserRecord{})))
+		}
+		return r.SCIMID, userFields(*r)
+	}
+	localID, localFields := column(local)
+	liveID, liveFields := column(live)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tFIELD\tLOCAL\tLIVE")
+	fmt.Fprintf(w, "\tscim_id\t%s\t%s\n", localID, liveID)
+	for i, f := range userFields(models.UserRecord{}) {
+		marker := ""
+		if changed[f.Name] {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", marker, f.Name, localFields[i].Value, liveFields[i].Value)
+	}
+	w.Flush()
+}
+
+func init() {
+	showUserCmd.Flags().String("user", "", "The ePPN (userName) of the user to show.")
+	showUserCmd.MarkFlagRequired("user")
+	showUserCmd.Flags().Bool("live", false, "Also fetch the user from SmartSuite and compare it with the local record.")
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// defaultMaxShrink is the largest share, in percent, of the stored users or
+// groups a listing may drop before populate and refresh refuse to save it.
+const defaultMaxShrink = 50
+
+// checkShrink guards against a listing SmartSuite only half returned wiping
+// records that still exist there. It fails when replacing before stored
+// records with after would drop more than max_shrink percent of them, unless
+// force is set. An empty store may always be filled.
+func checkShrink(kind string, before, after int, force bool) error {
+	if force || before == 0 || after >= before {
+		return nil
+	}
+	maxShrink := defaultMaxShrink
+	if viper.IsSet("max_shrink") {
+		maxShrink = viper.GetInt("max_shrink")
+	}
+	if dropped := (before - after) * 100 / before; dropped > maxShrink {
+		return fmt.Errorf("refusing to replace %d stored %s with %d from SmartSuite (%d%% fewer, more than the %d%% allowed by max_shrink); check the API and rerun with --force if this is expected", before, kind, after, dropped, maxShrink)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/viper"
+)
+
+// defaultDataDir is where the store lives when data_dir is not configured.
+const defaultDataDir = "./data"
+
+// resolveDataDir returns the configured data directory. The --data-dir flag
+// takes precedence over SMARTSUITE_DATA_DIR, which takes precedence over the
+// config file.
+func resolveDataDir() string {
+	if dataDir := viper.GetString("data_dir"); dataDir != "" {
+		return dataDir
+	}
+	return defaultDataDir
+}
+
+// newStore opens the store in dataDir, applying any optional store behaviour
+// found in the configuration.
+func newStore(dataDir string) (*store.Store, error) {
+	opts := storeOptions()
+
+	if viper.GetString("duplicate_scim_ids") == "error" {
+		opts = append(opts, store.WithRejectDuplicateSCIMIDs(true))
+	}
+
+	return store.NewStore(dataDir, opts...)
+}
+
+// newReadOnlyStore opens the store in dataDir for commands that only read
+// it, so they can run alongside each other and without write access.
+func newReadOnlyStore(dataDir string) (*store.Store, error) {
+	return store.NewStore(dataDir, append(storeOptions(), store.WithReadOnly())...)
+}
+
+// storeOptions returns the configured store options every command shares,
+// including those that open the store without newStore's load checks.
+func storeOptions() []store.Option {
+	opts := []store.Option{store.WithLockTimeout(viper.GetDuration("lock_timeout"))}
+
+	if backend := viper.GetString("store_backend"); backend != "" {
+		opts = append(opts, store.WithBackend(backend))
+	}
+
+	if viper.IsSet("audit_max_bytes") || viper.IsSet("audit_backups") {
+		maxBytes, backups := int64(store.DefaultMaxAuditBytes), store.DefaultAuditBackups
+		if viper.IsSet("audit_max_bytes") {
+			maxBytes = viper.GetInt64("audit_max_bytes")
+		}
+		if viper.IsSet("audit_backups") {
+			backups = viper.GetInt("audit_backups")
+		}
+		opts = append(opts, store.WithAuditRotation(maxBytes, backups))
+	}
+
+	return opts
+}
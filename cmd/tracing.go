@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// commandSpan is the parent span of the running command.
+	commandSpan trace.Span = trace.SpanFromContext(context.Background())
+	// shutdownTracing flushes and stops the exporter installed by initTracing.
+	shutdownTracing = func(context.Context) error { return nil }
+)
+
+// initTracing installs an OTLP/HTTP trace exporter when otlp_endpoint is set.
+// Without it nothing is installed and the global tracer stays a no-op.
+func initTracing(ctx context.Context) error {
+	endpoint := viper.GetString("otlp_endpoint")
+	if endpoint == "" {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("scim-mediator"))),
+	)
+	otel.SetTracerProvider(provider)
+	shutdownTracing = provider.Shutdown
+	slog.Debug("Tracing enabled", "otlp_endpoint", endpoint)
+	return nil
+}
+
+// startCommandSpan starts the parent span for cmd, named after its full
+// command path (e.g. "scim-mediator populate"), and returns its context.
+func startCommandSpan(cmd *cobra.Command) context.Context {
+	ctx, span := otel.Tracer("github.com/SmartSuiteFoundry/scim-mediator/cmd").Start(cmd.Context(), cmd.CommandPath())
+	commandSpan = span
+	return ctx
+}
+
+// endTracing ends the command span, recording err if the command failed, and
+// flushes any spans still buffered for export.
+func endTracing(err error) {
+	if err != nil {
+		commandSpan.RecordError(err)
+		commandSpan.SetStatus(codes.Error, err.Error())
+	}
+	commandSpan.End()
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type transactionKey struct{}
+
+// withTransaction returns a copy of ctx carrying a freshly generated audit
+// transaction ID. Every audit event written with the returned context shares
+// that ID, which lets the events of one logical operation be read back together.
+func withTransaction(ctx context.Context) context.Context {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, transactionKey{}, hex.EncodeToString(b))
+}
+
+// transactionID returns the audit transaction ID carried by ctx, if any.
+func transactionID(ctx context.Context) string {
+	id, _ := ctx.Value(transactionKey{}).(string)
+	return id
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/cobra"
+)
+
+func TestProvisionFlowEventsShareOneTransaction(t *testing.T) {
+	// A user is created and added to three groups in one invocation.
+	dataDir := t.TempDir()
+	provision := &cobra.Command{
+		Use: "provision-flow",
+		Run: func(cmd *cobra.Command, args []string) {
+			s, err := store.NewStore(dataDir)
+			if err != nil {
+				t.Fatalf("NewStore: %v", err)
+			}
+			defer s.Close()
+			ctx := cmd.Context()
+			logAndAudit(ctx, s, "CreateUser", "alice@example.edu", "info", "Successfully created user.")
+			for _, group := range []string{"staff", "library", "vpn"} {
+				logAndAudit(ctx, s, "ManageGroupMembers", group, "info", "Successfully modified members for group.")
+			}
+		},
+	}
+	rootCmd.AddCommand(provision)
+	t.Cleanup(func() { rootCmd.RemoveCommand(provision) })
+
+	runCommand(t, newFakeSCIM(t), dataDir, "provision-flow")
+	first := readAudit(t, dataDir)
+	runCommand(t, newFakeSCIM(t), dataDir, "provision-flow")
+	second := readAudit(t, dataDir)[len(first):]
+
+	if len(first) != 4 {
+		t.Fatalf("audit log has %d events, want 4", len(first))
+	}
+	id := first[0].TransactionID
+	if id == "" {
+		t.Fatal("audit event has no transaction ID")
+	}
+	for _, event := range first {
+		if event.TransactionID != id {
+			t.Errorf("%s event for %s has transaction %q, want %q like the rest of the flow", event.UseCase, event.Target, event.TransactionID, id)
+		}
+	}
+	if len(second) == 0 || second[0].TransactionID == id {
+		t.Errorf("second invocation reused transaction %q", id)
+	}
+}
+
+func TestProcessBatchGivesEachTaskItsOwnTransaction(t *testing.T) {
+	for _, concurrency := range []string{"1", "2"} {
+		t.Run("concurrency "+concurrency, func(t *testing.T) {
+			fake := newFakeSCIM(t,
+				models.SCIMUser{ID: "a1", UserName: "alice@example.edu", Active: true},
+				models.SCIMUser{ID: "b2", UserName: "bob@example.edu", Active: true},
+			)
+			dataDir := seedDataDir(t, map[string]models.UserRecord{
+				"alice@example.edu": {SCIMID: "a1", Status: "active"},
+				"bob@example.edu":   {SCIMID: "b2", Status: "active"},
+			})
+			batch := writeFile(t, "batch.json", `[{"type":"update","target":"alice@example.edu","data":{"title":"Professor"}},
+				{"type":"deactivate","target":"bob@example.edu"}]`)
+
+			runCommand(t, fake, dataDir, "process-batch", "--from-file", batch, "--concurrency="+concurrency)
+
+			byTarget := make(map[string]string)
+			for _, event := range readAudit(t, dataDir) {
+				if event.TransactionID == "" {
+					t.Errorf("event %q has no transaction ID", event.Details)
+				}
+				if id, seen := byTarget[event.Target]; seen && id != event.TransactionID {
+					t.Errorf("events for %s are split across transactions %q and %q", event.Target, id, event.TransactionID)
+				}
+				byTarget[event.Target] = event.TransactionID
+			}
+			if len(byTarget) != 2 || byTarget["alice@example.edu"] == byTarget["bob@example.edu"] {
+				t.Errorf("task transactions = %v, want a different one per task", byTarget)
+			}
+		})
+	}
+}
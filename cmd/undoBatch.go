@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/cobra"
+)
+
+// taskStatusUndone marks a completed task whose effect undo-batch reversed.
+const taskStatusUndone = "undone"
+
+var undoBatchCmd = &cobra.Command{
+	Use:   "undo-batch",
+	Short: "Reverses the tasks of a completed batch run.",
+	Long: `Reads a job queue written by process-batch (usually an archived
+job_queue.json.completed_<timestamp> file), or the journal of a --stream run
+(job_queue.journal or an archived job_queue.journal.completed_<timestamp>),
+and reverses its completed tasks, newest first, using the state recorded on
+each task when it ran:
+
+  update             restores the previous value of each attribute the local
+                     store tracks (userName, title, active, name.*)
+  deactivate         reactivates the user, unless they were already inactive
+  add-to-group       removes the user, unless they were already a member
+  remove-from-group  adds the user back, if they were a member
+
+Attributes the local store does not track cannot be restored and are reported.
+Users already removed by cleanup-users cannot be brought back. Undone tasks are
+marked in the file (in a journal, by appending an entry), so an interrupted
+undo can be re-run.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		file, _ := cmd.Flags().GetString("file")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		slog.Info("Starting undo-batch process", "file", file, "dry_run", dryRun)
+
+		jobQueue, journaled, err := readUndoFile(file)
+		if err != nil {
+			slog.Error("Failed to read job queue file", "file", file, "error", err)
+			os.Exit(1)
+		}
+		// saveProgress records the undone tasks. A journal is only ever
+		// appended to, one entry per task as it is undone, so there is
+		// nothing left to save.
+		saveProgress := func() {
+			if !journaled {
+				saveQueue(file, jobQueue)
+			}
+		}
+
+		if dryRun {
+			writeUndoPlan(cmd.OutOrStdout(), jobQueue)
+			slog.Info("Dry run complete. No changes were made.")
+			return
+		}
+
+		client, s, err := setup(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
+			os.Exit(1)
+		}
+		userStore, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load user store", "error", err)
+			os.Exit(1)
+		}
+		groupStore, err := s.LoadGroups()
+		if err != nil {
+			slog.Error("Failed to load group store", "error", err)
+			os.Exit(1)
+		}
+
+		var undone, failed int
+		for i := len(jobQueue) - 1; i >= 0; i-- {
+			if ctx.Err() != nil {
+				slog.Warn("Shutdown signal received. Saving progress and exiting.", "reason", ctx.Err())
+				break
+			}
+			task := &jobQueue[i]
+			if task.Status != "completed" {
+				continue
+			}
+			inverse, err := inverseTask(task)
+			if err != nil {
+				logAndAudit(ctx, s, "UndoBatch", task.Target, "warn", "Task cannot be undone", "task_index", i, "type", task.Type, "error", err)
+				continue
+			}
+			if missing := unrestorableAttributes(task); len(missing) > 0 {
+				logAndAudit(ctx, s, "UndoBatch", task.Target, "warn", "Some attributes are not tracked locally and will not be restored.", "task_index", i, "attributes", missing)
+			}
+
+			if inverse != nil {
+				err = runInverse(ctx, client, s, userStore, groupStore, task, inverse)
+			}
+			if exitCode(err) == exitMaintenance {
+				slog.Error("Tenant is in maintenance. Saving progress and exiting.", "error", err)
+				saveProgress()
+				os.Exit(exitMaintenance)
+			}
+			if err != nil {
+				failed++
+				logAndAudit(ctx, s, "UndoBatch", task.Target, "error", "Failed to undo task", "task_index", i, "type", task.Type, "error", err)
+				continue
+			}
+			task.Status = taskStatusUndone
+			undone++
+			logAndAudit(ctx, s, "UndoBatch", task.Target, "info", fmt.Sprintf("Task '%s' undone.", task.Type), "task_index", i)
+			if journaled {
+				if err := appendJournal(file, journalEntry{Index: i, Status: taskStatusUndone}); err != nil {
+					slog.Error("Failed to record undone task in journal", "task_index", i, "error", err)
+				}
+			} else {
+				saveQueue(file, jobQueue)
+			}
+		}
+
+		saveProgress()
+		slog.Info("Undo process finished.", "undone", undone, "failed", failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// readUndoFile reads the tasks of a batch run to undo: a job queue, which is
+// a JSON array, or a --stream journal, which is one JSON object per line.
+// journaled reports which it was.
+func readUndoFile(file string) (jobQueue []models.JobTask, journaled bool, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, false, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		jobQueue, err = readJournalTasks(file)
+		return jobQueue, true, err
+	}
+	if err := json.Unmarshal(data, &jobQueue); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal job queue data: %w", err)
+	}
+	return jobQueue, false, nil
+}
+
+// inverseTask returns the task that reverses a completed task, or nil if the
+// task had no effect to reverse (e.g. adding a user who was already a
+// member). A deactivate is reversed by a "reactivate" task, which only
+// undo-batch runs. It returns an error if the task cannot be reversed.
+func inverseTask(task *models.JobTask) (*models.JobTask, error) {
+	before := task.Before
+	if before == nil {
+		return nil, fmt.Errorf("no prior state was recorded for this task")
+	}
+	switch task.Type {
+	case "update":
+		if len(before.Attributes) == 0 {
+			return nil, fmt.Errorf("none of the updated attributes are tracked locally")
+		}
+		// After a rename the user is found under the new userName.
+		target := task.Target
+		if dataMap, ok := task.Data.(map[string]interface{}); ok {
+			if userName := newUserName(dataMap); userName != "" {
+				target = userName
+			}
+		}
+		return &models.JobTask{Type: "update", Target: target, Data: before.Attributes}, nil
+	case "deactivate":
+		if before.Status == "inactive" {
+			return nil, nil
+		}
+		return &models.JobTask{Type: "reactivate", Target: task.Target}, nil
+	case "add-to-group", "remove-from-group":
+		if before.WasMember == nil {
+			return nil, fmt.Errorf("prior membership was not recorded")
+		}
+		if *before.WasMember == (task.Type == "add-to-group") {
+			return nil, nil
+		}
+		inverse := "add-to-group"
+		if task.Type == "add-to-group" {
+			inverse = "remove-from-group"
+		}
+		return &models.JobTask{Type: inverse, Target: task.Target, Data: task.Data}, nil
+	default:
+		return nil, fmt.Errorf("task type '%s' is not reversible", task.Type)
+	}
+}
+
+// unrestorableAttributes lists the attributes an update task changed whose
+// previous value was not recorded.
+func unrestorableAttributes(task *models.JobTask) []string {
+	dataMap, ok := task.Data.(map[string]interface{})
+	if task.Type != "update" || !ok || task.Before == nil {
+		return nil
+	}
+	var missing []string
+	for path := range dataMap {
+		if _, ok := task.Before.Attributes[path]; !ok {
+			missing = append(missing, path)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// runInverse applies inverse, the reversal of the completed task.
+func runInverse(ctx context.Context, client *smartsuite.Client, s *store.Store, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord, task, inverse *models.JobTask) error {
+	if inverse.Type == "reactivate" {
+		return reactivateUser(ctx, client, s, userStore, inverse.Target, task.Before.DeactivationTimestamp)
+	}
+	return runTask(ctx, client, s, userStore, groupStore, inverse)
+}
+
+// reactivateOperations is the PATCH that reactivates a user.
+var reactivateOperations = []models.SCIMPatchOp{{Op: "replace", Path: "active", Value: true}}
+
+// reactivateUser sets active=true on the user in SmartSuite and restores the
+// local record's status, which also takes the user out of cleanup-users'
+// reach.
+func reactivateUser(ctx context.Context, client *smartsuite.Client, s *store.Store, userStore map[string]models.UserRecord, eppn string, previousTimestamp *time.Time) error {
+	record, ok := userStore[eppn]
+	if !ok {
+		return fmt.Errorf("user '%s' not found in local store; they may already have been deleted by cleanup-users", eppn)
+	}
+	if err := patchRecord(ctx, client, &record, reactivateOperations); err != nil {
+		return err
+	}
+	record.Status = "active"
+	record.DeactivationTimestamp = previousTimestamp
+	userStore[eppn] = record
+	return s.UpsertUser(eppn, record)
+}
+
+// captureBefore records the state task is about to change, as the local
+// store currently knows it.
+func captureBefore(task *models.JobTask, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord) *models.TaskBefore {
+	record, ok := userStore[task.Target]
+	if !ok {
+		return nil
+	}
+	switch task.Type {
+	case "update":
+		dataMap, _ := task.Data.(map[string]interface{})
+		before := &models.TaskBefore{Attributes: make(map[string]interface{}, len(dataMap))}
+		for path := range dataMap {
+			if value, known := currentAttributeValue(task.Target, record, path); known {
+				before.Attributes[path] = value
+			}
+		}
+		return before
+	case "deactivate":
+		return &models.TaskBefore{Status: record.Status, DeactivationTimestamp: record.DeactivationTimestamp}
+	case "add-to-group", "remove-from-group":
+		groupName, _ := task.Data.(string)
+		group, ok := groupStore[groupName]
+		if !ok {
+			return nil
+		}
+		wasMember := slices.Contains(group.Members, record.SCIMID)
+		return &models.TaskBefore{WasMember: &wasMember}
+	}
+	return nil
+}
+
+// writeUndoPlan writes what undo-batch would do for each completed task, in
+// the order it would do it.
+func writeUndoPlan(out io.Writer, jobQueue []models.JobTask) {
+	for i := len(jobQueue) - 1; i >= 0; i-- {
+		task := &jobQueue[i]
+		if task.Status != "completed" {
+			continue
+		}
+		fmt.Fprintf(out, "[%d] %s %s\n", i, task.Type, task.Target)
+		inverse, err := inverseTask(task)
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "    cannot undo: %s\n", err)
+		case inverse == nil:
+			fmt.Fprintln(out, "    nothing to undo")
+		case inverse.Data != nil:
+			data, _ := json.Marshal(inverse.Data)
+			fmt.Fprintf(out, "    would run: %s %s %s\n", inverse.Type, inverse.Target, data)
+		default:
+			fmt.Fprintf(out, "    would run: %s %s\n", inverse.Type, inverse.Target)
+		}
+		if missing := unrestorableAttributes(task); len(missing) > 0 {
+			fmt.Fprintf(out, "    not restored (untracked): %v\n", missing)
+		}
+	}
+}
+
+func init() {
+	undoBatchCmd.Flags().String("file", "", "Path to the completed job queue file, or --stream journal, to undo.")
+	undoBatchCmd.Flags().Bool("dry-run", false, "Print the inverse of each completed task without calling the API or saving anything.")
+	undoBatchCmd.MarkFlagRequired("file")
+}
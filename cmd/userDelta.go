@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// userDelta is a difference in one tracked attribute between two versions of
+// a user record, with both values rendered for display.
+type userDelta struct {
+	Field string
+	From  string
+	To    string
+}
+
+// userField is one tracked attribute of a user record, rendered for display.
+type userField struct {
+	Name  string
+	Value string
+}
+
+// userFields renders the attributes refresh and show-user compare, in display
+// order.
+func userFields(record models.UserRecord) []userField {
+	return []userField{
+		{"external_id", record.ExternalID},
+		{"email", record.Email},
+		{"emails", formatEmails(record.Emails)},
+		{"status", record.Status},
+		{"name", formatName(record.Name)},
+		{"title", record.Title},
+		{"organization", record.Organization},
+		{"department", record.Department},
+		{"cost_center", record.CostCenter},
+		{"division", record.Division},
+		{"employee_number", record.EmployeeNumber},
+		{"phone", record.Phone},
+		{"manager", managerLabel(record)},
+	}
+}
+
+// detectUserDeltas returns the tracked attributes that differ between old and
+// new, in display order.
+func detectUserDeltas(old, new models.UserRecord) []userDelta {
+	oldFields, newFields := userFields(old), userFields(new)
+	var deltas []userDelta
+	for i := range oldFields {
+		changed := oldFields[i].Value != newFields[i].Value
+		// Two names can render alike (e.g. formatted vs. given+family), so
+		// compare the parts.
+		if oldFields[i].Name == "name" {
+			changed = old.Name != new.Name
+		}
+		// A manager that has since been resolved to an ePPN is not a change.
+		if oldFields[i].Name == "manager" {
+			changed = old.ManagerSCIMID != new.ManagerSCIMID
+		}
+		if changed {
+			deltas = append(deltas, userDelta{Field: oldFields[i].Name, From: oldFields[i].Value, To: newFields[i].Value})
+		}
+	}
+	return deltas
+}
+
+// formatEmails renders every address, tagged with its type if it has one.
+func formatEmails(emails []models.EmailRecord) string {
+	parts := make([]string, len(emails))
+	for i, e := range emails {
+		parts[i] = e.Value
+		if e.Type != "" {
+			parts[i] += " (" + e.Type + ")"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// managerLabel renders the user's manager as their ePPN, or by SCIM id while
+// the manager is not in the local store.
+func managerLabel(record models.UserRecord) string {
+	if record.Manager == "" && record.ManagerSCIMID != "" {
+		return record.ManagerSCIMID + " (not in store)"
+	}
+	return record.Manager
+}
+
+// formatName renders a SCIM name as its formatted value, falling back to the
+// given and family names.
+func formatName(name models.SCIMName) string {
+	if name.Formatted != "" {
+		return name.Formatted
+	}
+	return strings.TrimSpace(name.GivenName + " " + name.FamilyName)
+}
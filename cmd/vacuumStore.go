@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/cobra"
+)
+
+var vacuumStoreCmd = &cobra.Command{
+	Use:   "vacuum-store",
+	Short: "Repairs and normalizes the local store in a single pass.",
+	Long: `Runs a suite of safe normalizations over users.json and groups.json:
+  - trims surrounding whitespace from keys and lower-cases status values
+  - removes records with an empty SCIM ID
+  - resolves userNames that share a SCIM ID, keeping the active record
+    (or the alphabetically first userName when both have the same status)
+  - backfills a deactivation timestamp on inactive users that lack one
+  - rewrites both files in a stable, sorted order
+
+Without --confirm the command only reports what it would change.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		confirm, _ := cmd.Flags().GetBool("confirm")
+		slog.Info("Starting store vacuum", "confirm", confirm)
+
+		dataDir := resolveDataDir()
+
+		// Duplicate SCIM IDs are one of the things being repaired, so load without rejecting them.
+		s, err := store.NewStore(dataDir, storeOptions()...)
+		if err != nil {
+			slog.Error("Failed to create store", "error", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+		userStore, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load user store", "error", err)
+			os.Exit(1)
+		}
+		groupStore, err := s.LoadGroups()
+		if err != nil {
+			slog.Error("Failed to load group store", "error", err)
+			os.Exit(1)
+		}
+
+		users, userChanges := vacuumUsers(userStore, time.Now())
+		groups, groupChanges := vacuumGroups(groupStore)
+		changes := append(userChanges, groupChanges...)
+
+		out := cmd.OutOrStdout()
+		for _, c := range changes {
+			fmt.Fprintf(out, "%s %s: %s\n", c.Kind, c.Key, c.Description)
+		}
+
+		if len(changes) == 0 {
+			slog.Info("Store is already normalized. Nothing to do.")
+			return
+		}
+		if !confirm {
+			slog.Info("Dry run only. Re-run with --confirm to apply these changes.", "changes", len(changes))
+			return
+		}
+
+		if err := s.SaveUsers(users); err != nil {
+			slog.Error("Failed to save normalized users", "error", err)
+			os.Exit(1)
+		}
+		if err := s.SaveGroups(groups); err != nil {
+			slog.Error("Failed to save normalized groups", "error", err)
+			os.Exit(1)
+		}
+		for _, c := range changes {
+			logAndAudit(ctx, s, "VacuumStore", c.Key, "info", c.Description, "kind", c.Kind)
+		}
+		slog.Info("Store vacuum completed successfully.", "changes", len(changes))
+	},
+}
+
+// vacuumChange records one normalization applied to a store record.
+type vacuumChange struct {
+	Kind        string // "user" or "group"
+	Key         string
+	Description string
+}
+
+// vacuumUsers returns a normalized copy of users along with every change made.
+// The input map is not modified.
+func vacuumUsers(users map[string]models.UserRecord, now time.Time) (map[string]models.UserRecord, []vacuumChange) {
+	var changes []vacuumChange
+	record := func(key, format string, args ...interface{}) {
+		changes = append(changes, vacuumChange{Kind: "user", Key: key, Description: fmt.Sprintf(format, args...)})
+	}
+
+	keys := make([]string, 0, len(users))
+	for k := range users {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]models.UserRecord, len(users))
+	for _, key := range keys {
+		u := users[key]
+
+		if strings.TrimSpace(u.SCIMID) == "" {
+			record(key, "removed record with empty SCIM ID")
+			continue
+		}
+
+		normalizedKey := strings.TrimSpace(key)
+		if normalizedKey == "" {
+			record(key, "removed record with empty userName (scim_id %s)", u.SCIMID)
+			continue
+		}
+		if normalizedKey != key {
+			if _, exists := users[normalizedKey]; exists {
+				record(key, "removed record whose trimmed key collides with existing '%s'", normalizedKey)
+				continue
+			}
+			record(key, "renamed key to '%s'", normalizedKey)
+		}
+
+		if status := strings.ToLower(strings.TrimSpace(u.Status)); status != u.Status {
+			record(normalizedKey, "normalized status '%s' to '%s'", u.Status, status)
+			u.Status = status
+		}
+		if u.Status == "inactive" && u.DeactivationTimestamp == nil {
+			ts := now
+			u.DeactivationTimestamp = &ts
+			record(normalizedKey, "backfilled missing deactivation timestamp")
+		}
+
+		result[normalizedKey] = u
+	}
+
+	for scimID, eppns := range store.FindDuplicateSCIMIDs(result) {
+		winner := eppns[0]
+		for _, eppn := range eppns {
+			if result[eppn].Status == "active" {
+				winner = eppn
+				break
+			}
+		}
+		for _, eppn := range eppns {
+			if eppn != winner {
+				delete(result, eppn)
+				record(eppn, "removed duplicate of scim_id %s (kept '%s')", scimID, winner)
+			}
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return result, changes
+}
+
+// vacuumGroups returns a normalized copy of groups along with every change made.
+func vacuumGroups(groups map[string]models.GroupRecord) (map[string]models.GroupRecord, []vacuumChange) {
+	var changes []vacuumChange
+	record := func(key, format string, args ...interface{}) {
+		changes = append(changes, vacuumChange{Kind: "group", Key: key, Description: fmt.Sprintf(format, args...)})
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]models.GroupRecord, len(groups))
+	for _, key := range keys {
+		g := groups[key]
+		if strings.TrimSpace(g.SCIMID) == "" {
+			record(key, "removed record with empty SCIM ID")
+			continue
+		}
+		normalizedKey := strings.TrimSpace(key)
+		if normalizedKey == "" {
+			record(key, "removed record with empty display name (scim_id %s)", g.SCIMID)
+			continue
+		}
+		if normalizedKey != key {
+			if _, exists := groups[normalizedKey]; exists {
+				record(key, "removed record whose trimmed key collides with existing '%s'", normalizedKey)
+				continue
+			}
+			record(key, "renamed key to '%s'", normalizedKey)
+		}
+		result[normalizedKey] = g
+	}
+	return result, changes
+}
+
+func init() {
+	vacuumStoreCmd.Flags().Bool("confirm", false, "Apply the changes. Without it the command only reports them.")
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+func TestVacuumUsersNormalizations(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	deactivated := now.Add(-48 * time.Hour)
+
+	tests := []struct {
+		name       string
+		users      map[string]models.UserRecord
+		want       map[string]models.UserRecord
+		wantChange string
+	}{
+		{
+			name:       "empty SCIM ID",
+			users:      map[string]models.UserRecord{"alice@example.edu": {SCIMID: " ", Status: "active"}},
+			want:       map[string]models.UserRecord{},
+			wantChange: "removed record with empty SCIM ID",
+		},
+		{
+			name:       "blank userName",
+			users:      map[string]models.UserRecord{"  ": {SCIMID: "a1", Status: "active"}},
+			want:       map[string]models.UserRecord{},
+			wantChange: "removed record with empty userName (scim_id a1)",
+		},
+		{
+			name:       "untrimmed key",
+			users:      map[string]models.UserRecord{" alice@example.edu ": {SCIMID: "a1", Status: "active"}},
+			want:       map[string]models.UserRecord{"alice@example.edu": {SCIMID: "a1", Status: "active"}},
+			wantChange: "renamed key to 'alice@example.edu'",
+		},
+		{
+			name: "trimmed key collides",
+			users: map[string]models.UserRecord{
+				"alice@example.edu ": {SCIMID: "a2", Status: "active"},
+				"alice@example.edu":  {SCIMID: "a1", Status: "active"},
+			},
+			want:       map[string]models.UserRecord{"alice@example.edu": {SCIMID: "a1", Status: "active"}},
+			wantChange: "removed record whose trimmed key collides with existing 'alice@example.edu'",
+		},
+		{
+			name:       "status case",
+			users:      map[string]models.UserRecord{"alice@example.edu": {SCIMID: "a1", Status: " Active"}},
+			want:       map[string]models.UserRecord{"alice@example.edu": {SCIMID: "a1", Status: "active"}},
+			wantChange: "normalized status ' Active' to 'active'",
+		},
+		{
+			name:       "missing deactivation timestamp",
+			users:      map[string]models.UserRecord{"bob@example.edu": {SCIMID: "b2", Status: "inactive"}},
+			want:       map[string]models.UserRecord{"bob@example.edu": {SCIMID: "b2", Status: "inactive", DeactivationTimestamp: &now}},
+			wantChange: "backfilled missing deactivation timestamp",
+		},
+		{
+			name: "duplicate SCIM ID keeps the active record",
+			users: map[string]models.UserRecord{
+				"alice.old@example.edu": {SCIMID: "a1", Status: "inactive", DeactivationTimestamp: &deactivated},
+				"alice@example.edu":     {SCIMID: "a1", Status: "active"},
+			},
+			want:       map[string]models.UserRecord{"alice@example.edu": {SCIMID: "a1", Status: "active"}},
+			wantChange: "removed duplicate of scim_id a1 (kept 'alice@example.edu')",
+		},
+		{
+			name: "duplicate SCIM ID with equal status keeps the first userName",
+			users: map[string]models.UserRecord{
+				"alice@example.edu":     {SCIMID: "a1", Status: "active"},
+				"alice.new@example.edu": {SCIMID: "a1", Status: "active"},
+			},
+			want:       map[string]models.UserRecord{"alice.new@example.edu": {SCIMID: "a1", Status: "active"}},
+			wantChange: "removed duplicate of scim_id a1 (kept 'alice.new@example.edu')",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := vacuumUsers(tt.users, now)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("vacuumUsers kept %v, want %v", got, tt.want)
+			}
+			for key, want := range tt.want {
+				g, ok := got[key]
+				if !ok {
+					t.Errorf("vacuumUsers dropped %q", key)
+					continue
+				}
+				if g.SCIMID != want.SCIMID || g.Status != want.Status {
+					t.Errorf("%s = %+v, want %+v", key, g, want)
+				}
+				if (g.DeactivationTimestamp == nil) != (want.DeactivationTimestamp == nil) ||
+					g.DeactivationTimestamp != nil && !g.DeactivationTimestamp.Equal(*want.DeactivationTimestamp) {
+					t.Errorf("%s deactivated at %v, want %v", key, g.DeactivationTimestamp, want.DeactivationTimestamp)
+				}
+			}
+			if !hasVacuumChange(changes, tt.wantChange) {
+				t.Errorf("changes = %+v, want one that says %q", changes, tt.wantChange)
+			}
+		})
+	}
+}
+
+func TestVacuumUsersLeavesNormalizedStoreAlone(t *testing.T) {
+	deactivated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := map[string]models.UserRecord{
+		"alice@example.edu": {SCIMID: "a1", Status: "active"},
+		"bob@example.edu":   {SCIMID: "b2", Status: "inactive", DeactivationTimestamp: &deactivated},
+	}
+	if _, changes := vacuumUsers(users, time.Now()); len(changes) != 0 {
+		t.Errorf("changes = %+v, want none", changes)
+	}
+}
+
+func TestVacuumGroupsNormalizations(t *testing.T) {
+	groups := map[string]models.GroupRecord{
+		"Faculty":  {SCIMID: ""},
+		"   ":      {SCIMID: "g2"},
+		" Staff ":  {SCIMID: "g3"},
+		"Alumni ":  {SCIMID: "g4"},
+		"Alumni":   {SCIMID: "g5"},
+		"Students": {SCIMID: "g6"},
+	}
+
+	got, changes := vacuumGroups(groups)
+
+	for _, want := range []string{"Alumni", "Staff", "Students"} {
+		if _, ok := got[want]; !ok {
+			t.Errorf("vacuumGroups dropped %q", want)
+		}
+	}
+	if len(got) != 3 || got["Alumni"].SCIMID != "g5" {
+		t.Errorf("vacuumGroups = %v, want Alumni (g5), Staff and Students", got)
+	}
+	for _, want := range []string{
+		"removed record with empty SCIM ID",
+		"removed record with empty display name (scim_id g2)",
+		"renamed key to 'Staff'",
+		"removed record whose trimmed key collides with existing 'Alumni'",
+	} {
+		if !hasVacuumChange(changes, want) {
+			t.Errorf("changes = %+v, want one that says %q", changes, want)
+		}
+	}
+}
+
+func hasVacuumChange(changes []vacuumChange, description string) bool {
+	for _, c := range changes {
+		if strings.Contains(c.Description, description) {
+			return true
+		}
+	}
+	return false
+}
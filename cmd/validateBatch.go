@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"github.com/spf13/cobra"
+)
+
+var validateBatchCmd = &cobra.Command{
+	Use:   "validate-batch",
+	Short: "Checks a batch file for problems without running it.",
+	Long: `Parses a process-batch source file and checks every task: that its type is known,
+that its target is set and exists in the local store, and that its data has the
+shape the task type expects. Every problem is reported at once, by task index.
+No API calls are made and nothing is written. Exits non-zero if any task is invalid.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fromFile, _ := cmd.Flags().GetString("from-file")
+		slog.Info("Starting batch validation", "from_file", fromFile)
+
+		dataDir := resolveDataDir()
+
+		sourceData, err := os.ReadFile(fromFile)
+		if err != nil {
+			slog.Error("Failed to read source file", "file", fromFile, "error", err)
+			os.Exit(1)
+		}
+		var tasks []models.JobTask
+		if err := json.Unmarshal(sourceData, &tasks); err != nil {
+			slog.Error("Failed to unmarshal batch tasks from source file", "error", err)
+			os.Exit(1)
+		}
+
+		s, err := newReadOnlyStore(dataDir)
+		if err != nil {
+			slog.Error("Failed to create store", "error", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		userStore, err := s.LoadUsers()
+		if err != nil {
+			slog.Error("Failed to load user store", "error", err)
+			os.Exit(1)
+		}
+		groupStore, err := s.LoadGroups()
+		if err != nil {
+			slog.Error("Failed to load group store", "error", err)
+			os.Exit(1)
+		}
+
+		problems := validateTasks(tasks, userStore, groupStore)
+		writeProblems(cmd.OutOrStdout(), problems)
+		if len(problems) > 0 {
+			slog.Error("Batch file is invalid.", "tasks", len(tasks), "problems", len(problems))
+			os.Exit(1)
+		}
+		slog.Info("Batch file is valid.", "tasks", len(tasks))
+	},
+}
+
+// batchProblem is one reason a task in a batch file would fail.
+type batchProblem struct {
+	Index   int
+	Task    models.JobTask
+	Problem string
+}
+
+// validateTasks checks tasks in file order against the local store and
+// returns every problem found. A userName change in an earlier update task
+// makes the new name a valid target for the tasks after it.
+func validateTasks(tasks []models.JobTask, userStore map[string]models.UserRecord, groupStore map[string]models.GroupRecord) []batchProblem {
+	var problems []batchProblem
+	report := func(i int, format string, args ...interface{}) {
+		problems = append(problems, batchProblem{Index: i, Task: tasks[i], Problem: fmt.Sprintf(format, args...)})
+	}
+
+	renamed := make(map[string]bool)
+	for i, task := range tasks {
+		if _, ok := taskTypePriority[task.Type]; !ok {
+			report(i, "unknown task type '%s'", task.Type)
+		}
+		if task.Target == "" {
+			report(i, "target is empty")
+		} else if _, ok := userStore[task.Target]; !ok && !renamed[task.Target] {
+			report(i, "user '%s' not found in local store", task.Target)
+		}
+
+		switch task.Type {
+		case "update":
+			dataMap, ok := task.Data.(map[string]interface{})
+			if !ok || len(dataMap) == 0 {
+				report(i, "data for update must be a non-empty map of attributes")
+				continue
+			}
+			if _, err := updateOperations(dataMap); err != nil {
+				report(i, "%s", err)
+			}
+			if userName := newUserName(dataMap); userName != "" && userName != task.Target {
+				renamed[userName] = true
+			}
+		case "add-to-group", "remove-from-group":
+			groupName, ok := task.Data.(string)
+			if !ok || groupName == "" {
+				report(i, "data for %s must be the group name (string)", task.Type)
+				continue
+			}
+			if _, ok := groupStore[groupName]; !ok {
+				report(i, "group '%s' not found in local store", groupName)
+			}
+		}
+	}
+	return problems
+}
+
+// writeProblems writes one line per problem to out.
+func writeProblems(out io.Writer, problems []batchProblem) {
+	for _, p := range problems {
+		fmt.Fprintf(out, "[%d] %s %s: %s\n", p.Index, p.Task.Type, p.Task.Target, p.Problem)
+	}
+}
+
+func init() {
+	validateBatchCmd.Flags().String("from-file", "", "Path to the JSON file containing batch tasks.")
+	validateBatchCmd.MarkFlagRequired("from-file")
+}
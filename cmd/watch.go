@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite"
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/store"
+
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Runs refresh on a fixed interval until stopped.",
+	Long: `Runs the mediator as a long-lived service that performs a refresh immediately
+and then once every --interval, logging a summary of each cycle. The local store
+is opened for each cycle and closed after it, so other commands can use the data
+directory between cycles. A cycle that would start while the previous one is
+still running is skipped with a warning. A failed cycle is logged and the next
+one runs as scheduled. On Ctrl+C or SIGTERM the running cycle is stopped and
+the command exits once it has wound down.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			slog.Error("--interval must be greater than zero.", "interval", interval)
+			os.Exit(1)
+		}
+
+		remediate, err := parseRemediate(configList("remediate"))
+		if err != nil {
+			slog.Error("Invalid SMARTSUITE_REMEDIATE", "error", err)
+			os.Exit(1)
+		}
+
+		client, err := commandClient(cmd)
+		if err != nil {
+			slog.Error("Failed to set up command", "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info("Starting watch", "interval", interval)
+
+		var (
+			wg      sync.WaitGroup
+			running atomic.Bool
+			cycle   int
+		)
+		startCycle := func() {
+			if !running.CompareAndSwap(false, true) {
+				slog.Warn("Previous refresh is still running; skipping this cycle.", "interval", interval)
+				return
+			}
+			cycle++
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				defer running.Store(false)
+				// Each cycle is its own audit transaction.
+				refreshCycle(withTransaction(ctx), client, remediate, n)
+			}(cycle)
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		startCycle()
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("Shutdown signal received, waiting for the running refresh to stop...")
+				wg.Wait()
+				slog.Info("Watch stopped.", "cycles", cycle)
+				return
+			case <-ticker.C:
+				startCycle()
+			}
+		}
+	},
+}
+
+// refreshCycle runs one refresh for watch and logs its outcome. Errors are
+// logged rather than returned, so a failed cycle does not stop the service.
+func refreshCycle(ctx context.Context, client *smartsuite.Client, remediate map[string]bool, n int) {
+	started := time.Now()
+	slog.Info("Starting refresh cycle", "cycle", n)
+
+	s, err := newStore(resolveDataDir())
+	if errors.Is(err, store.ErrLocked) {
+		slog.Warn("Data directory is in use by another command; skipping this cycle.", "cycle", n, "error", err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create store; skipping this cycle.", "cycle", n, "error", err)
+		return
+	}
+	defer s.Close()
+
+	report := newReconcileReport()
+	if err := runRefresh(ctx, s, client, remediate, false, report); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			slog.Warn("Refresh cycle halted by shutdown signal.", "cycle", n, "reason", err)
+			return
+		}
+		slog.Error("Refresh cycle failed", "cycle", n, "duration", time.Since(started), "error", err)
+		return
+	}
+
+	slog.Info("Refresh cycle complete", "cycle", n, "duration", time.Since(started),
+		"users_created", len(report.Users.Created), "users_deleted", len(report.Users.Deleted), "users_changed", len(report.Users.Changed),
+		"groups_created", len(report.Groups.Created), "groups_deleted", len(report.Groups.Deleted), "groups_changed", len(report.Groups.Changed))
+}
+
+func init() {
+	watchCmd.Flags().Duration("interval", 15*time.Minute, "How often to run refresh (e.g. 15m, 1h).")
+}
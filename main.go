@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/cmd"
@@ -12,18 +13,32 @@ import (
 )
 
 func main() {
-	// We need to parse flags before initializing the logger to check for --debug.
-	// We do a pre-parse here. Cobra will parse them again, which is fine.
+	// We need to parse flags before initializing the logger to check for --debug
+	// and --log-level. We do a pre-parse here. Cobra will parse them again, and
+	// reports an invalid level, which is fine.
 	var debug bool
-	for _, arg := range os.Args[1:] {
-		if arg == "--debug" {
+	levelName := os.Getenv("SMARTSUITE_LOG_LEVEL")
+	args := os.Args[1:]
+	for i, arg := range args {
+		switch {
+		case arg == "--debug":
 			debug = true
-			break
+		case strings.HasPrefix(arg, "--log-level="):
+			levelName = strings.TrimPrefix(arg, "--log-level=")
+		case arg == "--log-level" && i+1 < len(args):
+			levelName = args[i+1]
 		}
 	}
+	level, err := logger.ParseLevel(levelName)
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	if debug {
+		level = slog.LevelDebug
+	}
 
 	// Initialize the structured logger for the entire application.
-	logger.Init(debug)
+	logger.Init(level)
 	slog.Info("Application starting", "debug_mode", debug)
 
 	// Set up a context that is cancelled on an interrupt signal (Ctrl+C).
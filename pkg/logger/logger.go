@@ -1,23 +1,91 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Log destinations accepted by OpenOutput. Any other value is a file path.
+const (
+	OutputStderr = "stderr"
+	OutputStdout = "stdout"
+)
+
+// Log formats accepted by Configure. FormatAuto picks text when logging to a
+// terminal and JSON otherwise.
+const (
+	FormatAuto = "auto"
+	FormatJSON = "json"
+	FormatText = "text"
 )
 
-// Init sets up a global structured JSON logger for the application.
-// It sets the log level based on the debug flag.
-func Init(debug bool) {
-	var logLevel slog.Level
-	if debug {
-		logLevel = slog.LevelDebug
-	} else {
-		logLevel = slog.LevelInfo
+// Init sets up a global structured logger for the application at the given
+// level. Logs go to stderr so that command output written to stdout can be
+// piped on its own, as text when stderr is a terminal and JSON otherwise.
+func Init(level slog.Level) {
+	Configure(level, os.Stderr, FormatAuto)
+}
+
+// ParseLevel returns the level named by debug, info, warn or error, matched
+// case-insensitively.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q: must be debug, info, warn or error", name)
+}
+
+// Configure replaces the global logger with one that writes to w in the given
+// format, logging records at level and above.
+func Configure(level slog.Level, w io.Writer, format string) error {
+	if format == FormatAuto {
+		format = FormatJSON
+		if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			format = FormatText
+		}
 	}
 
 	opts := &slog.HandlerOptions{
-		Level: logLevel,
+		Level: level,
+	}
+	var handler slog.Handler
+	switch format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q: must be auto, json or text", format)
 	}
-	handler := slog.NewJSONHandler(os.Stdout, opts)
 	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// OpenOutput returns the writer for a log destination: stderr (also used
+// when dest is empty), stdout, or the path of a file that log lines are
+// appended to.
+func OpenOutput(dest string) (io.Writer, error) {
+	switch dest {
+	case "", OutputStderr:
+		return os.Stderr, nil
+	case OutputStdout:
+		return os.Stdout, nil
+	}
+	f, err := os.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file %s: %w", dest, err)
+	}
+	return f, nil
 }
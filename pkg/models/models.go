@@ -1,31 +1,87 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
 
 // UserRecord represents the structure of a user's record in the local store.
 // It's expanded to hold more useful data for reference.
 type UserRecord struct {
 	SCIMID                string     `json:"scim_id"`
+	ExternalID            string     `json:"external_id,omitempty"` // the upstream identity source's id for the user
 	Email                 string     `json:"email"`
 	Status                string     `json:"status"` // e.g., "active" or "inactive"
 	Name                  SCIMName   `json:"name"`
 	Title                 string     `json:"title,omitempty"`
 	Organization          string     `json:"organization,omitempty"`
+	Department            string     `json:"department,omitempty"`
+	CostCenter            string     `json:"cost_center,omitempty"`
+	Division              string     `json:"division,omitempty"`
+	EmployeeNumber        string     `json:"employee_number,omitempty"`
+	Phone                 string     `json:"phone,omitempty"` // the user's primary phone number
 	DeactivationTimestamp *time.Time `json:"deactivation_timestamp,omitempty"`
+	// ETag is the user's version as of the last read from SmartSuite. Updates
+	// send it as If-Match so concurrent edits are not silently overwritten.
+	ETag string `json:"etag,omitempty"`
+	// ManagerSCIMID is the SCIM id of the user's manager, and Manager their
+	// ePPN. Manager is empty while the manager is not in the local store.
+	ManagerSCIMID string `json:"manager_scim_id,omitempty"`
+	Manager       string `json:"manager,omitempty"`
+	// LastModified is meta.lastModified as of the last read from SmartSuite.
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	// Emails holds every address the user has, and Email the primary one.
+	// Records written before Emails was added only carry Email; the store
+	// promotes it into Emails on load.
+	Emails []EmailRecord `json:"emails,omitempty"`
+}
+
+// EmailRecord is one of a user's email addresses as kept in the local store.
+type EmailRecord struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
 }
 
 // GroupRecord represents the structure of a group's record in the local store.
 type GroupRecord struct {
-	SCIMID string `json:"scim_id"`
+	SCIMID     string   `json:"scim_id"`
+	ExternalID string   `json:"external_id,omitempty"` // the upstream identity source's id for the group
+	Members    []string `json:"members"`               // SCIM ids of the group's members
+	// LastModified is meta.lastModified as of the last read from SmartSuite.
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+// SetMember adds or removes scimID from the group's members, keeping them
+// sorted, and reports whether anything changed. Members is replaced rather
+// than modified in place, so copies of the record are unaffected.
+func (g *GroupRecord) SetMember(scimID string, member bool) bool {
+	i := sort.SearchStrings(g.Members, scimID)
+	found := i < len(g.Members) && g.Members[i] == scimID
+	if found == member {
+		return false
+	}
+	members := make([]string, 0, len(g.Members)+1)
+	members = append(members, g.Members[:i]...)
+	if member {
+		members = append(members, scimID)
+		members = append(members, g.Members[i:]...)
+	} else {
+		members = append(members, g.Members[i+1:]...)
+	}
+	g.Members = members
+	return true
 }
 
 // AuditEvent represents a single entry in the audit log.
 type AuditEvent struct {
-	Timestamp time.Time `json:"timestamp"`
-	UseCase   string    `json:"use_case"`
-	Target    string    `json:"target"`
-	Status    string    `json:"status"`
-	Details   string    `json:"details,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	TransactionID string    `json:"transaction_id,omitempty"` // Groups the events of one logical operation
+	UseCase       string    `json:"use_case"`
+	Target        string    `json:"target"`
+	Status        string    `json:"status"`
+	Details       string    `json:"details,omitempty"`
 }
 
 // JobTask represents a single task in a bulk processing queue.
@@ -34,6 +90,28 @@ type JobTask struct {
 	Target string      `json:"target"` // The user's ePPN
 	Data   interface{} `json:"data"`   // For "update", a map[string]interface{}. For group ops, the group name.
 	Status string      `json:"status"` // "pending", "completed", "failed"
+	// LastError is the reason the most recent attempt failed, and FailedAt when
+	// it failed. Both are cleared on success.
+	LastError string     `json:"last_error,omitempty"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"`
+	// Before is the target's state just before the task completed, kept so
+	// undo-batch can reverse it. It is nil for tasks that have not completed.
+	Before *TaskBefore `json:"before,omitempty"`
+}
+
+// TaskBefore is the state a task changed, as the local store knew it before
+// the task ran.
+type TaskBefore struct {
+	// Attributes holds, for an update, the previous value of each attribute
+	// the local store tracks. Untracked attributes are absent and cannot be
+	// restored.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// Status and DeactivationTimestamp are the user's state before a deactivate.
+	Status                string     `json:"status,omitempty"`
+	DeactivationTimestamp *time.Time `json:"deactivation_timestamp,omitempty"`
+	// WasMember records, for a membership task, whether the user was already
+	// in the group.
+	WasMember *bool `json:"was_member,omitempty"`
 }
 
 // --- SCIM API Models ---
@@ -41,13 +119,95 @@ type JobTask struct {
 // SCIMUser represents a user object as defined by the SCIM protocol.
 type SCIMUser struct {
 	ID             string            `json:"id,omitempty"`
+	ExternalID     string            `json:"externalId,omitempty"`
 	Schemas        []string          `json:"schemas"`
 	UserName       string            `json:"userName"`
 	Name           SCIMName          `json:"name"`
 	Emails         []SCIMEmail       `json:"emails"`
+	PhoneNumbers   []SCIMPhoneNumber `json:"phoneNumbers,omitempty"`
 	Active         bool              `json:"active"`
 	Title          string            `json:"title,omitempty"`
 	EnterpriseData EnterpriseUserExt `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta           *SCIMMeta         `json:"meta,omitempty"`
+}
+
+// LastActivity returns the most recent activity time SmartSuite reports for
+// the user, or nil if none is known. SmartSuite does not expose a last-login
+// attribute over SCIM, so meta.lastModified is used as the activity signal.
+func (u SCIMUser) LastActivity() *time.Time {
+	if u.Meta == nil {
+		return nil
+	}
+	return u.Meta.LastModified
+}
+
+// Version returns the resource version SmartSuite reported for the user, or
+// "" if none was sent. It is the value to send back in If-Match.
+func (u SCIMUser) Version() string {
+	if u.Meta == nil {
+		return ""
+	}
+	return u.Meta.Version
+}
+
+// PrimaryEmail returns the address marked primary, falling back to the first
+// one listed. SCIM does not require the primary address to come first. Some
+// service accounts have no emails at all, for which it returns "".
+func (u SCIMUser) PrimaryEmail() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// EmailRecords returns the user's addresses in the form the local store keeps.
+func (u SCIMUser) EmailRecords() []EmailRecord {
+	if len(u.Emails) == 0 {
+		return nil
+	}
+	records := make([]EmailRecord, len(u.Emails))
+	for i, e := range u.Emails {
+		records[i] = EmailRecord{Value: e.Value, Type: e.Type, Primary: e.Primary}
+	}
+	return records
+}
+
+// PrimaryPhone returns the number marked primary, falling back to the first
+// number listed, or "" if the user has none.
+func (u SCIMUser) PrimaryPhone() string {
+	for _, p := range u.PhoneNumbers {
+		if p.Primary {
+			return p.Value
+		}
+	}
+	if len(u.PhoneNumbers) > 0 {
+		return u.PhoneNumbers[0].Value
+	}
+	return ""
+}
+
+// SCIMMeta holds the server-maintained metadata of a SCIM resource. Clients
+// never send it; the client clears it from request bodies.
+type SCIMMeta struct {
+	ResourceType string     `json:"resourceType,omitempty"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+	Version      string     `json:"version,omitempty"`
+}
+
+// Modified returns meta.lastModified, or nil if there is no meta or the
+// server did not send it.
+func (m *SCIMMeta) Modified() *time.Time {
+	if m == nil {
+		return nil
+	}
+	return m.LastModified
 }
 
 type SCIMName struct {
@@ -62,9 +222,36 @@ type SCIMEmail struct {
 	Primary bool   `json:"primary"`
 }
 
+type SCIMPhoneNumber struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
 // EnterpriseUserExt holds the enterprise user extension data.
 type EnterpriseUserExt struct {
-	Organization string `json:"organization,omitempty"`
+	EmployeeNumber string       `json:"employeeNumber,omitempty"`
+	CostCenter     string       `json:"costCenter,omitempty"`
+	Organization   string       `json:"organization,omitempty"`
+	Division       string       `json:"division,omitempty"`
+	Department     string       `json:"department,omitempty"`
+	Manager        *SCIMManager `json:"manager,omitempty"`
+}
+
+// SCIMManager is the enterprise manager sub-attribute. Value is the SCIM id
+// of the manager's own user resource.
+type SCIMManager struct {
+	Value       string `json:"value,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// ManagerID returns the SCIM id of the user's manager, or "" if none is set.
+func (e EnterpriseUserExt) ManagerID() string {
+	if e.Manager == nil {
+		return ""
+	}
+	return e.Manager.Value
 }
 
 // SCIMPatchOp represents a single PATCH operation.
@@ -76,8 +263,31 @@ type SCIMPatchOp struct {
 
 // SCIMGroup represents a group object from the SCIM API.
 type SCIMGroup struct {
-	ID          string `json:"id,omitempty"`
-	DisplayName string `json:"displayName"`
+	ID          string            `json:"id,omitempty"`
+	ExternalID  string            `json:"externalId,omitempty"`
+	DisplayName string            `json:"displayName"`
+	Members     []SCIMGroupMember `json:"members,omitempty"`
+	Meta        *SCIMMeta         `json:"meta,omitempty"`
+}
+
+// SCIMGroupMember is a single entry of a group's members attribute.
+type SCIMGroupMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// MemberIDs returns the sorted SCIM ids of the group's members. It never
+// returns nil, so a group without members is stored as an empty list.
+func (g SCIMGroup) MemberIDs() []string {
+	ids := make([]string, 0, len(g.Members))
+	for _, m := range g.Members {
+		if m.Value != "" {
+			ids = append(ids, m.Value)
+		}
+	}
+	sort.Strings(ids)
+	return ids
 }
 
 // ListResponse is a generic structure for SCIM list responses (for users, groups, etc.).
@@ -87,3 +297,68 @@ type ListResponse struct {
 	StartIndex   int           `json:"startIndex"`
 	Resources    []interface{} `json:"Resources"`
 }
+
+// ServiceProviderConfig is the subset of a SCIM service provider's
+// /ServiceProviderConfig resource (RFC 7643 section 5) that tells clients
+// which optional features it implements.
+type ServiceProviderConfig struct {
+	Patch          SupportedFeature `json:"patch"`
+	Bulk           BulkFeature      `json:"bulk"`
+	Filter         FilterFeature    `json:"filter"`
+	ChangePassword SupportedFeature `json:"changePassword"`
+	Sort           SupportedFeature `json:"sort"`
+	ETag           SupportedFeature `json:"etag"`
+}
+
+// SupportedFeature is a feature the service provider either implements or not.
+type SupportedFeature struct {
+	Supported bool `json:"supported"`
+}
+
+// BulkFeature describes bulk support and its limits. MaxPayloadSize is in bytes.
+type BulkFeature struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+// FilterFeature describes filter support and the most results a filtered
+// query returns.
+type FilterFeature struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+// BulkOperation is a single operation within a SCIM bulk request. Path is
+// relative to the API root (e.g. "/Groups/123"), and Data is the body the
+// operation would carry if sent on its own.
+type BulkOperation struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	BulkID string      `json:"bulkId,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// BulkResponse is the server's answer to a bulk request, with one result per
+// operation it processed.
+type BulkResponse struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []BulkOperationResult `json:"Operations"`
+}
+
+// BulkOperationResult is the outcome of a single bulk operation. Status is
+// the HTTP status code the operation would have returned on its own; RFC 7644
+// sends it as a string, but some servers send a bare number.
+type BulkOperationResult struct {
+	Method   string      `json:"method"`
+	BulkID   string      `json:"bulkId,omitempty"`
+	Location string      `json:"location,omitempty"`
+	Status   json.Number `json:"status"`
+	Response interface{} `json:"response,omitempty"`
+}
+
+// Succeeded reports whether the operation returned a 2xx status.
+func (r BulkOperationResult) Succeeded() bool {
+	code, err := r.Status.Int64()
+	return err == nil && code >= 200 && code < 300
+}
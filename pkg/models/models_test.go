@@ -0,0 +1,60 @@
+package models
+
+import "testing"
+
+func TestPrimaryPhone(t *testing.T) {
+	tests := []struct {
+		name   string
+		phones []SCIMPhoneNumber
+		want   string
+	}{
+		{"none", nil, ""},
+		{"one primary among several", []SCIMPhoneNumber{
+			{Value: "555-0100", Type: "work"},
+			{Value: "555-0101", Type: "mobile", Primary: true},
+			{Value: "555-0102", Type: "home"},
+		}, "555-0101"},
+		{"no primary", []SCIMPhoneNumber{
+			{Value: "555-0100", Type: "work"},
+			{Value: "555-0101", Type: "mobile"},
+		}, "555-0100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := SCIMUser{PhoneNumbers: tt.phones}
+			if got := u.PrimaryPhone(); got != tt.want {
+				t.Errorf("PrimaryPhone() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrimaryEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		emails []SCIMEmail
+		want   string
+	}{
+		{"none", nil, ""},
+		{"primary listed last", []SCIMEmail{
+			{Value: "alice@alumni.example.edu", Type: "home"},
+			{Value: "alice@example.edu", Type: "work", Primary: true},
+		}, "alice@example.edu"},
+		{"primary listed first", []SCIMEmail{
+			{Value: "alice@example.edu", Type: "work", Primary: true},
+			{Value: "alice@alumni.example.edu", Type: "home"},
+		}, "alice@example.edu"},
+		{"no primary", []SCIMEmail{
+			{Value: "alice@alumni.example.edu", Type: "home"},
+			{Value: "alice@example.edu", Type: "work"},
+		}, "alice@alumni.example.edu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := SCIMUser{Emails: tt.emails}
+			if got := u.PrimaryEmail(); got != tt.want {
+				t.Errorf("PrimaryEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package smartsuite
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// DefaultBodyLogMaxBytes is how much of each body is logged when WithBodyLogging
+// is given no limit.
+const DefaultBodyLogMaxBytes = 4096
+
+// redacted replaces the value of anything that must not reach the logs.
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are always redacted when request headers are logged.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// sensitiveFields are JSON attributes redacted whatever the caller configures.
+var sensitiveFields = []string{"password"}
+
+// bodyLogger logs request and response bodies at debug level, with sensitive
+// JSON fields redacted and each body capped at maxBytes.
+type bodyLogger struct {
+	maxBytes int
+	fields   map[string]bool // lower-cased JSON attribute names to redact
+}
+
+// WithBodyLogging logs every request and response body at debug level. The
+// value of any JSON attribute named in redactFields (matched case-insensitively,
+// at any depth) is replaced with "[REDACTED]", as are passwords and
+// credentials in headers.
+// Bodies longer than maxBytes are truncated; zero or less means
+// DefaultBodyLogMaxBytes.
+func WithBodyLogging(maxBytes int, redactFields []string) ClientOption {
+	return func(c *Client) {
+		if maxBytes <= 0 {
+			maxBytes = DefaultBodyLogMaxBytes
+		}
+		fields := make(map[string]bool)
+		for _, f := range append(redactFields, sensitiveFields...) {
+			if f = strings.TrimSpace(f); f != "" {
+				fields[strings.ToLower(f)] = true
+			}
+		}
+		c.bodyLog = &bodyLogger{maxBytes: maxBytes, fields: fields}
+	}
+}
+
+// logRequest logs req's headers and body.
+func (l *bodyLogger) logRequest(req *http.Request, body []byte) {
+	if l == nil {
+		return
+	}
+	slog.Debug("API request body", "method", req.Method, "url", req.URL.String(), "headers", redactHeaders(req.Header), "body", l.render(body))
+}
+
+// logResponse logs the body of the response to req.
+func (l *bodyLogger) logResponse(req *http.Request, statusCode int, body []byte) {
+	if l == nil {
+		return
+	}
+	slog.Debug("API response body", "method", req.Method, "url", req.URL.String(), "status_code", statusCode, "body", l.render(body))
+}
+
+// render returns body as a loggable string: redacted if it is JSON, then
+// truncated to maxBytes.
+func (l *bodyLogger) render(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	text := string(body)
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		if out, err := json.Marshal(l.redact(v)); err == nil {
+			text = string(out)
+		}
+	}
+	if len(text) > l.maxBytes {
+		return text[:l.maxBytes] + "...(truncated)"
+	}
+	return text
+}
+
+// redact walks a decoded JSON value and replaces the values of sensitive
+// attributes.
+func (l *bodyLogger) redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if l.fields[strings.ToLower(k)] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = l.redact(child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = l.redact(child)
+		}
+	}
+	return v
+}
+
+// redactHeaders returns a copy of h, flattened for logging, with credentials removed.
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k := range h {
+		out[k] = h.Get(k)
+	}
+	for _, k := range sensitiveHeaders {
+		if _, ok := out[k]; ok {
+			out[k] = redacted
+		}
+	}
+	return out
+}
@@ -3,18 +3,35 @@ package smartsuite
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"math"
-	"math/rand"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	"golang.org/x/time/rate"
+)
+
+// Default retry policy applied by NewClient.
+const (
+	DefaultMaxRetries  = 3
+	DefaultBaseBackoff = 1 * time.Second
+	DefaultMaxBackoff  = 30 * time.Second
+	DefaultPageWorkers = 4
+	DefaultPageSize    = 100
 )
 
 // Client is a client for interacting with the SmartSuite SCIM API.
@@ -22,20 +39,236 @@ type Client struct {
 	BaseURL    string
 	APIKey     string
 	HTTPClient *http.Client
+
+	// MaxRetries is the number of times a failed request is retried; zero
+	// means a single attempt. BaseBackoff is the ceiling of the wait before
+	// the first retry, doubling on each subsequent one up to MaxBackoff; the
+	// actual wait is drawn at random below the ceiling.
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// MaxElapsed bounds the total time spent on one request across all of
+	// its attempts: a retry whose wait would overrun it is not made. Zero
+	// means only MaxRetries limits retrying.
+	MaxElapsed time.Duration
+	// RequestTimeout bounds each individual attempt. A timed-out attempt is
+	// retried like a transport error. Zero means attempts are bounded only by
+	// HTTPClient.Timeout and the caller's context.
+	RequestTimeout time.Duration
+
+	tlsConfig  *tls.Config
+	proxyURL   *url.URL // nil means the proxy comes from the environment
+	pathPrefix string
+	limiter    *rate.Limiter // nil means requests are not throttled
+	// maintenanceWait is the longest Retry-After the client will sit out when
+	// the tenant is in maintenance. Zero means fail fast.
+	maintenanceWait time.Duration
+	// pageWorkers bounds how many list pages GetUsers fetches concurrently.
+	pageWorkers int
+	// pageSize is the count requested for each page of a listing.
+	pageSize int
+	bodyLog  *bodyLogger // nil means bodies are not logged
+	// tokens supplies OAuth2 access tokens in place of APIKey when set.
+	tokens *tokenSource
+	// membershipNoops makes PatchGroup treat a rejected add of an existing
+	// member, or remove of a non-member, as success. See WithIdempotentMembership.
+	membershipNoops bool
+	membershipMatch *regexp.Regexp
+
+	// spc caches the ServiceProviderConfig once it has been fetched.
+	spcMu sync.Mutex
+	spc   *models.ServiceProviderConfig
+
+	// rng picks retry waits. It is not safe for concurrent use, so every
+	// draw holds rngMu.
+	rngMu sync.Mutex
+	rng   *rand.Rand
+}
+
+// ClientOption configures optional behaviour of a Client at construction time.
+type ClientOption func(*Client)
+
+// WithMinTLSVersion sets the lowest TLS version the client will negotiate
+// (e.g. tls.VersionTLS12). The default is TLS 1.2.
+func WithMinTLSVersion(version uint16) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig.MinVersion = version
+	}
+}
+
+// WithCipherSuites restricts the cipher suites offered during the handshake.
+// Go does not allow the TLS 1.3 suites to be configured, so this only
+// narrows what is accepted for TLS 1.2 connections.
+func WithCipherSuites(ids []uint16) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig.CipherSuites = ids
+	}
+}
+
+// WithRootCAs sets the certificate authorities trusted when verifying the
+// server, in place of the system pool.
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig.RootCAs = pool
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the server's certificate
+// chain and host name. It leaves API calls open to interception and is only
+// meant for diagnosing certificate problems.
+func WithInsecureSkipVerify() ClientOption {
+	return func(c *Client) {
+		c.tlsConfig.InsecureSkipVerify = true
+	}
+}
+
+// WithMaxRetries sets how many times a failed request is retried. Zero
+// disables retries entirely.
+func WithMaxRetries(n int) ClientOption {
+	return func(c *Client) {
+		c.MaxRetries = n
+	}
+}
+
+// WithBaseBackoff sets the wait before the first retry. It doubles on each
+// subsequent retry.
+func WithBaseBackoff(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.BaseBackoff = d
+	}
+}
+
+// WithMaxBackoff caps the wait between retries, however many have been made.
+// Values of zero or below keep DefaultMaxBackoff.
+func WithMaxBackoff(d time.Duration) ClientOption {
+	return func(c *Client) {
+		if d > 0 {
+			c.MaxBackoff = d
+		}
+	}
+}
+
+// WithMaxElapsed sets the total time budget for one request across all of its
+// attempts and the waits between them.
+func WithMaxElapsed(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.MaxElapsed = d
+	}
+}
+
+// WithRand sets the random source used to pick retry waits, so tests can pin
+// retry timing with a fixed seed. By default each client seeds its own; a nil
+// r keeps that default.
+func WithRand(r *rand.Rand) ClientOption {
+	return func(c *Client) {
+		if r != nil {
+			c.rng = r
+		}
+	}
+}
+
+// WithRequestTimeout sets a per-attempt timeout, distinct from the caller's
+// context, so one hung connection is cut and retried without aborting the
+// whole operation.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.RequestTimeout = d
+	}
+}
+
+// WithRateLimit throttles the client to requestsPerSecond, allowing bursts of
+// up to burst requests. Every attempt, including retries, consumes a token.
+func WithRateLimit(requestsPerSecond float64, burst int) ClientOption {
+	return func(c *Client) {
+		if burst < 1 {
+			burst = 1
+		}
+		c.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+	}
+}
+
+// WithPathPrefix sets the path segment(s) between BaseURL and the SCIM resource
+// names, e.g. "/scim/v2", for deployments where BaseURL is just the host.
+// Leading and trailing slashes are optional.
+func WithPathPrefix(prefix string) ClientOption {
+	return func(c *Client) {
+		c.pathPrefix = prefix
+	}
+}
+
+// WithPageWorkers sets how many pages GetUsers fetches in parallel after the
+// first. Values of one or less fetch pages sequentially.
+func WithPageWorkers(n int) ClientOption {
+	return func(c *Client) {
+		c.pageWorkers = n
+	}
+}
+
+// WithIdempotentMembership makes PatchGroup succeed when every operation is
+// an add that the server rejects because the user is already a member, or a
+// remove rejected because the user is not one. Such rejections are recognised
+// by scimType "uniqueness" (on a 409) and "noTarget" respectively, or by the
+// error body matching match, which may be nil.
+func WithIdempotentMembership(match *regexp.Regexp) ClientOption {
+	return func(c *Client) {
+		c.membershipNoops = true
+		c.membershipMatch = match
+	}
+}
+
+// WithPageSize sets how many resources GetUsers and GetGroups request per
+// page. Servers may return fewer; the listing then continues at the size the
+// server actually uses. Values below one keep DefaultPageSize.
+func WithPageSize(n int) ClientOption {
+	return func(c *Client) {
+		if n > 0 {
+			c.pageSize = n
+		}
+	}
 }
 
-// NewClient creates a new SmartSuite API client.
-func NewClient(baseURL, apiKey string) (*Client, error) {
-	if baseURL == "" || apiKey == "" {
-		return nil, fmt.Errorf("BaseURL and APIKey must be provided")
+// WithMaintenanceWait lets the client wait out a maintenance window instead
+// of failing, provided the server's Retry-After does not exceed max.
+func WithMaintenanceWait(max time.Duration) ClientOption {
+	return func(c *Client) {
+		c.maintenanceWait = max
 	}
-	return &Client{
-		BaseURL: baseURL,
-		APIKey:  apiKey,
-		HTTPClient: &http.Client{
-			Timeout: time.Minute,
-		},
-	}, nil
+}
+
+// NewClient creates a new SmartSuite API client. apiKey may be empty when
+// WithClientCredentials is given.
+func NewClient(baseURL, apiKey string, opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		BaseURL:     baseURL,
+		APIKey:      apiKey,
+		MaxRetries:  DefaultMaxRetries,
+		BaseBackoff: DefaultBaseBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		pageWorkers: DefaultPageWorkers,
+		pageSize:    DefaultPageSize,
+		tlsConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+		rng:         rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if baseURL == "" || (apiKey == "" && c.tokens == nil) {
+		return nil, fmt.Errorf("BaseURL and either APIKey or client credentials must be provided")
+	}
+	if c.tokens != nil && (c.tokens.tokenURL == "" || c.tokens.clientID == "" || c.tokens.clientSecret == "") {
+		return nil, fmt.Errorf("client credentials need a token URL, client ID and client secret")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = c.tlsConfig
+	if c.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(c.proxyURL)
+	}
+	c.HTTPClient = &http.Client{
+		Timeout:   time.Minute,
+		Transport: transport,
+	}
+	return c, nil
 }
 
 // --- Public Methods for Users and Groups ---
@@ -43,10 +276,13 @@ func NewClient(baseURL, apiKey string) (*Client, error) {
 // GetUserByUsername fetches a single user by their exact userName using a filter.
 // It returns (nil, nil) if the user is not found.
 func (c *Client) GetUserByUsername(ctx context.Context, username string) (*models.SCIMUser, error) {
-	endpointURL, _ := url.Parse(fmt.Sprintf("%s/Users", c.BaseURL))
+	endpointURL, err := c.endpoint("Users")
+	if err != nil {
+		return nil, err
+	}
 	queryParams := url.Values{}
 	// Note: URL encoding for the filter value is handled by RawQuery
-	queryParams.Set("filter", fmt.Sprintf(`userName eq "%s"`, username))
+	queryParams.Set("filter", "userName eq "+filterString(username))
 	endpointURL.RawQuery = queryParams.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", endpointURL.String(), nil)
@@ -54,7 +290,7 @@ func (c *Client) GetUserByUsername(ctx context.Context, username string) (*model
 		return nil, err
 	}
 
-	body, err := c.doRequestWithRetry(ctx, req)
+	body, err := c.doRequestWithRetry(ctx, "GetUserByUsername", req)
 	if err != nil {
 		return nil, err
 	}
@@ -77,114 +313,313 @@ func (c *Client) GetUserByUsername(ctx context.Context, username string) (*model
 	return &user, nil
 }
 
-// GetUsers fetches all users from the SCIM API, handling pagination.
-func (c *Client) GetUsers(ctx context.Context) ([]models.SCIMUser, error) {
-	var allUsers []models.SCIMUser
-	startIndex := 1
-	itemsPerPage := 100
-
-	for {
-		endpointURL, _ := url.Parse(fmt.Sprintf("%s/Users", c.BaseURL))
-		queryParams := url.Values{}
-		queryParams.Set("startIndex", strconv.Itoa(startIndex))
-		queryParams.Set("count", strconv.Itoa(itemsPerPage))
-		endpointURL.RawQuery = queryParams.Encode()
+// GetUserByID fetches a single user by their SCIM id.
+// It returns (nil, nil) if the user is not found.
+func (c *Client) GetUserByID(ctx context.Context, scimID string) (*models.SCIMUser, error) {
+	endpointURL, err := c.endpoint("Users", scimID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpointURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
 
-		req, err := http.NewRequestWithContext(ctx, "GET", endpointURL.String(), nil)
-		if err != nil {
-			return nil, err
+	res, err := c.doRequest(ctx, "GetUserByID", req)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil // User not found
 		}
+		return nil, err
+	}
 
-		body, err := c.doRequestWithRetry(ctx, req)
-		if err != nil {
-			return nil, err
+	var user models.SCIMUser
+	if err := json.Unmarshal(res.Body, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	// The ETag header is authoritative for a single resource; meta.version is
+	// optional in SCIM responses.
+	if etag := res.Header.Get("ETag"); etag != "" {
+		if user.Meta == nil {
+			user.Meta = &models.SCIMMeta{}
 		}
+		user.Meta.Version = etag
+	}
+	return &user, nil
+}
 
-		var listResponse models.ListResponse
-		if err := json.Unmarshal(body, &listResponse); err != nil {
-			return nil, fmt.Errorf("error unmarshaling user list response: %w", err)
-		}
+// GetGroupByDisplayName fetches a single group by its exact displayName using a filter.
+// It returns (nil, nil) if the group is not found.
+func (c *Client) GetGroupByDisplayName(ctx context.Context, displayName string) (*models.SCIMGroup, error) {
+	endpointURL, err := c.endpoint("Groups")
+	if err != nil {
+		return nil, err
+	}
+	queryParams := url.Values{}
+	queryParams.Set("filter", "displayName eq "+filterString(displayName))
+	endpointURL.RawQuery = queryParams.Encode()
 
-		if len(listResponse.Resources) == 0 {
-			break
-		}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpointURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.doRequestWithRetry(ctx, "GetGroupByDisplayName", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var listResponse models.ListResponse
+	if err := json.Unmarshal(body, &listResponse); err != nil {
+		return nil, fmt.Errorf("error unmarshaling group filter response: %w", err)
+	}
+
+	if listResponse.TotalResults == 0 || len(listResponse.Resources) == 0 {
+		return nil, nil // Group not found
+	}
+
+	var group models.SCIMGroup
+	resourceBytes, _ := json.Marshal(listResponse.Resources[0])
+	if err := json.Unmarshal(resourceBytes, &group); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal found group: %w", err)
+	}
+
+	return &group, nil
+}
+
+// GetUsers fetches all users from the SCIM API, handling pagination. The
+// first page is fetched on its own to learn totalResults; the remaining pages
+// are then fetched concurrently by up to pageWorkers goroutines and merged
+// back in page order. The first failing page cancels the rest. opts sets the
+// order; when the server cannot sort, the users are sorted locally instead.
+func (c *Client) GetUsers(ctx context.Context, opts ListOptions) ([]models.SCIMUser, error) {
+	params, serverSorted := c.sortParams(ctx, opts)
+	users, err := c.getAllUsers(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if !serverSorted {
+		sortUsersLocally(users, opts)
+	}
+	return users, nil
+}
+
+// GetUsersFiltered fetches every user matching a SCIM filter expression such
+// as `active eq false` or `emails.value co "@contractor.com"`, paging through
+// the results like GetUsers. The filter is sent as written, URL-encoded; use
+// it only with trusted or properly quoted values. A filter that matches
+// nobody returns an empty slice.
+func (c *Client) GetUsersFiltered(ctx context.Context, filter string) ([]models.SCIMUser, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, errors.New("filter must not be empty")
+	}
+	params := url.Values{}
+	params.Set("filter", filter)
+	return c.getAllUsers(ctx, params)
+}
+
+// getAllUsers fetches every page of users, adding params to each request.
+// When the first page shows that more pages follow and the server reports a
+// usable totalResults, the remaining pages are fetched concurrently;
+// otherwise the listing continues one page at a time.
+func (c *Client) getAllUsers(ctx context.Context, params url.Values) ([]models.SCIMUser, error) {
+	firstPage, first, err := c.getUserPage(ctx, params, 1, c.pageSize)
+	if err != nil {
+		return nil, err
+	}
+	// Servers may cap count below what was asked for; step by what the first
+	// page actually returned so no users are skipped.
+	pageSize := pageStep(c.pageSize, first)
+
+	if c.pageWorkers <= 1 || first.returned == 0 || first.total <= first.returned {
+		return paginate(firstPage, first, pageSize, func(startIndex, count int) ([]models.SCIMUser, pageInfo, error) {
+			return c.getUserPage(ctx, params, startIndex, count)
+		})
+	}
+
+	total := first.total
+	numPages := (total + pageSize - 1) / pageSize
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make([][]models.SCIMUser, numPages)
+	pages[0] = firstPage
 
-		for _, resource := range listResponse.Resources {
-			var user models.SCIMUser
-			resourceBytes, _ := json.Marshal(resource)
-			if err := json.Unmarshal(resourceBytes, &user); err == nil {
-				allUsers = append(allUsers, user)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	jobs := make(chan int)
+	workers := min(c.pageWorkers, numPages-1)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range jobs {
+				users, _, err := c.getUserPage(ctx, params, 1+page*pageSize, pageSize)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("failed to fetch user page %d: %w", page+1, err)
+						cancel()
+					})
+					continue
+				}
+				pages[page] = users
 			}
-		}
+		}()
+	}
 
-		if len(allUsers) >= listResponse.TotalResults {
-			break
+dispatch:
+	for page := 1; page < numPages; page++ {
+		select {
+		case jobs <- page:
+		case <-ctx.Done():
+			break dispatch
 		}
-		startIndex += len(listResponse.Resources)
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	allUsers := make([]models.SCIMUser, 0, total)
+	for _, users := range pages {
+		allUsers = append(allUsers, users...)
 	}
 	return allUsers, nil
 }
 
-// GetGroups fetches all groups from the SCIM API, handling pagination.
-func (c *Client) GetGroups(ctx context.Context) ([]models.SCIMGroup, error) {
-	var allGroups []models.SCIMGroup
-	startIndex := 1
-	itemsPerPage := 100
+// CountUsers returns the number of users in the tenant by fetching a single
+// one-user page, which makes it the cheapest authenticated request available.
+func (c *Client) CountUsers(ctx context.Context) (int, error) {
+	_, info, err := c.getUserPage(ctx, nil, 1, 1)
+	return info.total, err
+}
 
-	for {
-		endpointURL, _ := url.Parse(fmt.Sprintf("%s/Groups", c.BaseURL))
-		queryParams := url.Values{}
-		queryParams.Set("startIndex", strconv.Itoa(startIndex))
-		queryParams.Set("count", strconv.Itoa(itemsPerPage))
-		endpointURL.RawQuery = queryParams.Encode()
+// getUserPage fetches a single page of users and returns them together with
+// the page's paging metadata. params, which may be nil, are added to the query.
+func (c *Client) getUserPage(ctx context.Context, params url.Values, startIndex, count int) ([]models.SCIMUser, pageInfo, error) {
+	listResponse, err := c.getListPage(ctx, "GetUsers", "Users", params, startIndex, count)
+	if err != nil {
+		return nil, pageInfo{}, fmt.Errorf("error fetching user list page: %w", err)
+	}
 
-		req, err := http.NewRequestWithContext(ctx, "GET", endpointURL.String(), nil)
-		if err != nil {
-			return nil, err
+	users := make([]models.SCIMUser, 0, len(listResponse.Resources))
+	for _, resource := range listResponse.Resources {
+		var user models.SCIMUser
+		resourceBytes, _ := json.Marshal(resource)
+		if err := json.Unmarshal(resourceBytes, &user); err == nil {
+			users = append(users, user)
 		}
+	}
+	return users, newPageInfo(listResponse), nil
+}
 
-		body, err := c.doRequestWithRetry(ctx, req)
-		if err != nil {
-			return nil, err
-		}
+// GetGroups fetches all groups from the SCIM API, handling pagination. opts
+// sets the order; when the server cannot sort, the groups are sorted locally.
+func (c *Client) GetGroups(ctx context.Context, opts ListOptions) ([]models.SCIMGroup, error) {
+	params, serverSorted := c.sortParams(ctx, opts)
+	fetch := func(startIndex, count int) ([]models.SCIMGroup, pageInfo, error) {
+		return c.getGroupPage(ctx, params, startIndex, count)
+	}
 
-		var listResponse models.ListResponse
-		if err := json.Unmarshal(body, &listResponse); err != nil {
-			return nil, fmt.Errorf("error unmarshaling group list response: %w", err)
-		}
+	firstPage, first, err := fetch(1, c.pageSize)
+	if err != nil {
+		return nil, err
+	}
+	allGroups, err := paginate(firstPage, first, pageStep(c.pageSize, first), fetch)
+	if err != nil {
+		return nil, err
+	}
+	if !serverSorted {
+		sortGroupsLocally(allGroups, opts)
+	}
+	return allGroups, nil
+}
 
-		if len(listResponse.Resources) == 0 {
-			break
-		}
+// getGroupPage fetches a single page of groups and returns them together with
+// the page's paging metadata.
+func (c *Client) getGroupPage(ctx context.Context, params url.Values, startIndex, count int) ([]models.SCIMGroup, pageInfo, error) {
+	listResponse, err := c.getListPage(ctx, "GetGroups", "Groups", params, startIndex, count)
+	if err != nil {
+		return nil, pageInfo{}, fmt.Errorf("error fetching group list page: %w", err)
+	}
 
-		for _, resource := range listResponse.Resources {
-			var group models.SCIMGroup
-			resourceBytes, _ := json.Marshal(resource)
-			if err := json.Unmarshal(resourceBytes, &group); err == nil {
-				allGroups = append(allGroups, group)
-			}
+	groups := make([]models.SCIMGroup, 0, len(listResponse.Resources))
+	for _, resource := range listResponse.Resources {
+		var group models.SCIMGroup
+		resourceBytes, _ := json.Marshal(resource)
+		if err := json.Unmarshal(resourceBytes, &group); err == nil {
+			groups = append(groups, group)
 		}
+	}
+	return groups, newPageInfo(listResponse), nil
+}
 
-		if len(allGroups) >= listResponse.TotalResults {
-			break
-		}
-		startIndex += len(listResponse.Resources)
+// getListPage fetches one page of a resource listing.
+func (c *Client) getListPage(ctx context.Context, op, resource string, params url.Values, startIndex, count int) (*models.ListResponse, error) {
+	endpointURL, err := c.endpoint(resource)
+	if err != nil {
+		return nil, err
 	}
-	return allGroups, nil
+	queryParams := cloneValues(params)
+	queryParams.Set("startIndex", strconv.Itoa(startIndex))
+	queryParams.Set("count", strconv.Itoa(count))
+	endpointURL.RawQuery = queryParams.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpointURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.doRequestWithRetry(ctx, op, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var listResponse models.ListResponse
+	if err := json.Unmarshal(body, &listResponse); err != nil {
+		return nil, fmt.Errorf("error unmarshaling list response: %w", err)
+	}
+	return &listResponse, nil
+}
+
+// cloneValues returns a copy of v that can be added to, even when v is nil.
+func cloneValues(v url.Values) url.Values {
+	out := url.Values{}
+	for k, vs := range v {
+		out[k] = append([]string(nil), vs...)
+	}
+	return out
 }
 
+// userSchemas are the schema URNs sent with every full user representation.
+var userSchemas = []string{"urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"}
+
 // CreateUser sends a POST request to create a new user.
 func (c *Client) CreateUser(ctx context.Context, user models.SCIMUser) (*models.SCIMUser, error) {
-	user.Schemas = []string{"urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"}
+	user.Schemas = userSchemas
+	user.Meta = nil // server-maintained
 	payload, err := json.Marshal(user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal create user payload: %w", err)
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/Users", c.BaseURL), bytes.NewBuffer(payload))
+	endpointURL, err := c.endpoint("Users")
 	if err != nil {
 		return nil, err
 	}
-	body, err := c.doRequestWithRetry(ctx, req)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpointURL.String(), bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.doRequestWithRetry(ctx, "CreateUser", req)
 	if err != nil {
 		return nil, err
 	}
@@ -195,18 +630,73 @@ func (c *Client) CreateUser(ctx context.Context, user models.SCIMUser) (*models.
 	return &createdUser, nil
 }
 
-// DeleteUser sends a DELETE request to permanently remove a user.
+// UpdateUser sends a PUT request that replaces the user's full representation.
+// Attributes left empty in user are cleared on the server, so callers should
+// start from a freshly fetched user. It returns the server's representation.
+func (c *Client) UpdateUser(ctx context.Context, scimID string, user models.SCIMUser) (*models.SCIMUser, error) {
+	user.ID = scimID
+	user.Schemas = userSchemas
+	user.Meta = nil // server-maintained
+	payload, err := json.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal update user payload: %w", err)
+	}
+	endpointURL, err := c.endpoint("Users", scimID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpointURL.String(), bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.doRequestWithRetry(ctx, "UpdateUser", req)
+	if err != nil {
+		return nil, err
+	}
+	var updatedUser models.SCIMUser
+	if err := json.Unmarshal(body, &updatedUser); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal updated user response: %w", err)
+	}
+	return &updatedUser, nil
+}
+
+// DeleteUser sends a DELETE request to permanently remove a user. A user
+// that no longer exists is already deleted, so a 404 is not an error.
 func (c *Client) DeleteUser(ctx context.Context, scimID string) error {
-	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/Users/%s", c.BaseURL, scimID), nil)
+	return c.deleteResource(ctx, "DeleteUser", "Users", scimID)
+}
+
+// DeleteGroup sends a DELETE request to permanently remove a group. As with
+// DeleteUser, a 404 is not an error.
+func (c *Client) DeleteGroup(ctx context.Context, scimID string) error {
+	return c.deleteResource(ctx, "DeleteGroup", "Groups", scimID)
+}
+
+func (c *Client) deleteResource(ctx context.Context, op, resource, scimID string) error {
+	endpointURL, err := c.endpoint(resource, scimID)
 	if err != nil {
 		return err
 	}
-	_, err = c.doRequestWithRetry(ctx, req)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", endpointURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.doRequestWithRetry(ctx, op, req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
 	return err
 }
 
 // PatchUser sends a PATCH request to update a user's attributes.
 func (c *Client) PatchUser(ctx context.Context, scimID string, operations []models.SCIMPatchOp) error {
+	return c.PatchUserIfMatch(ctx, scimID, "", operations)
+}
+
+// PatchUserIfMatch is PatchUser with optimistic concurrency: when ifMatch is
+// non-empty it is sent as the If-Match header, and the update is rejected with
+// ErrPreconditionFailed if the user has changed since that version was read.
+func (c *Client) PatchUserIfMatch(ctx context.Context, scimID, ifMatch string, operations []models.SCIMPatchOp) error {
 	payload := map[string]interface{}{
 		"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
 		"Operations": operations,
@@ -215,11 +705,18 @@ func (c *Client) PatchUser(ctx context.Context, scimID string, operations []mode
 	if err != nil {
 		return fmt.Errorf("failed to marshal patch payload: %w", err)
 	}
-	req, err := http.NewRequestWithContext(ctx, "PATCH", fmt.Sprintf("%s/Users/%s", c.BaseURL, scimID), bytes.NewBuffer(payloadBytes))
+	endpointURL, err := c.endpoint("Users", scimID)
 	if err != nil {
 		return err
 	}
-	_, err = c.doRequestWithRetry(ctx, req)
+	req, err := http.NewRequestWithContext(ctx, "PATCH", endpointURL.String(), bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	_, err = c.doRequestWithRetry(ctx, "PatchUser", req)
 	return err
 }
 
@@ -229,15 +726,22 @@ func (c *Client) CreateGroup(ctx context.Context, group models.SCIMGroup) (*mode
 		"schemas":     []string{"urn:ietf:params:scim:schemas:core:2.0:Group"},
 		"displayName": group.DisplayName,
 	}
+	if group.ExternalID != "" {
+		payload["externalId"] = group.ExternalID
+	}
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal create group payload: %w", err)
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/Groups", c.BaseURL), bytes.NewBuffer(payloadBytes))
+	endpointURL, err := c.endpoint("Groups")
 	if err != nil {
 		return nil, err
 	}
-	body, err := c.doRequestWithRetry(ctx, req)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpointURL.String(), bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.doRequestWithRetry(ctx, "CreateGroup", req)
 	if err != nil {
 		return nil, err
 	}
@@ -258,79 +762,425 @@ func (c *Client) PatchGroup(ctx context.Context, scimID string, operations []mod
 	if err != nil {
 		return fmt.Errorf("failed to marshal patch group payload: %w", err)
 	}
-	req, err := http.NewRequestWithContext(ctx, "PATCH", fmt.Sprintf("%s/Groups/%s", c.BaseURL, scimID), bytes.NewBuffer(payloadBytes))
+	endpointURL, err := c.endpoint("Groups", scimID)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PATCH", endpointURL.String(), bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return err
 	}
-	_, err = c.doRequestWithRetry(ctx, req)
+	_, err = c.doRequestWithRetry(ctx, "PatchGroup", req)
+	if err != nil && c.membershipNoops && c.isMembershipNoop(err, operations) {
+		slog.Info("Group membership is already as requested; treating the rejected PATCH as success.", "group_scim_id", scimID, "error", err)
+		return nil
+	}
 	return err
 }
 
-// --- Private Helper for HTTP Requests with Retry Logic ---
+// isMembershipNoop reports whether err rejects a membership PATCH only
+// because it would change nothing: every operation is an add of an existing
+// member, or every operation is a remove of a non-member. A mix of adds and
+// removes is never treated as a no-op, since PATCH is applied atomically and
+// the other operations were not applied either.
+func (c *Client) isMembershipNoop(err error, operations []models.SCIMPatchOp) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || len(operations) == 0 {
+		return false
+	}
+	op := strings.ToLower(operations[0].Op)
+	for _, o := range operations[1:] {
+		if strings.ToLower(o.Op) != op {
+			return false
+		}
+	}
+	matched := c.membershipMatch != nil && c.membershipMatch.Match(statusErr.Body)
+	switch op {
+	case "add":
+		return statusErr.StatusCode == http.StatusConflict && (statusErr.ScimType == "uniqueness" || matched)
+	case "remove":
+		return statusErr.ScimType == "noTarget" || matched
+	}
+	return false
+}
+
+// Bulk sends the operations as a single SCIM bulk request. A successful
+// response can still carry failed operations; callers should check each
+// result, matching them to operations by BulkID.
+func (c *Client) Bulk(ctx context.Context, ops []models.BulkOperation) (*models.BulkResponse, error) {
+	payload := map[string]interface{}{
+		"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:BulkRequest"},
+		"Operations": ops,
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bulk payload: %w", err)
+	}
+	endpointURL, err := c.endpoint("Bulk")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpointURL.String(), bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.doRequestWithRetry(ctx, "Bulk", req)
+	if err != nil {
+		return nil, err
+	}
+	var bulkResponse models.BulkResponse
+	if err := json.Unmarshal(body, &bulkResponse); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bulk response: %w", err)
+	}
+	return &bulkResponse, nil
+}
+
+// GetServiceProviderConfig returns the features SmartSuite advertises at
+// /ServiceProviderConfig. The first successful response is cached for the
+// lifetime of the client; failures are not cached.
+func (c *Client) GetServiceProviderConfig(ctx context.Context) (*models.ServiceProviderConfig, error) {
+	c.spcMu.Lock()
+	defer c.spcMu.Unlock()
+	if c.spc != nil {
+		return c.spc, nil
+	}
+
+	endpointURL, err := c.endpoint("ServiceProviderConfig")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpointURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.doRequestWithRetry(ctx, "GetServiceProviderConfig", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.ServiceProviderConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal service provider config: %w", err)
+	}
+	c.spc = &config
+	return c.spc, nil
+}
+
+// --- Private Helpers for HTTP Requests ---
+
+// filterString renders value as a quoted SCIM filter string literal. SCIM uses
+// JSON string syntax, so embedded quotes and backslashes are escaped and a
+// value like `R&D "core"` cannot break out of the comparison.
+func filterString(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+// endpoint builds the URL of a SCIM resource from BaseURL, the configured path
+// prefix, and the given path elements, normalizing any duplicate slashes.
+func (c *Client) endpoint(elem ...string) (*url.URL, error) {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BaseURL '%s': %w", c.BaseURL, err)
+	}
+	return base.JoinPath(append([]string{c.pathPrefix}, elem...)...), nil
+}
+
+// doRequestWithRetry sends req, retrying where it is safe to, and returns the
+// body of the successful response. The whole exchange, retries included, is
+// traced as one span named after op, the public method making the request.
+func (c *Client) doRequestWithRetry(ctx context.Context, op string, req *http.Request) ([]byte, error) {
+	res, err := c.doRequest(ctx, op, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// doRequest is doRequestWithRetry for callers that also need the response
+// headers of the successful attempt.
+func (c *Client) doRequest(ctx context.Context, op string, req *http.Request) (_ *attemptResult, err error) {
+	ctx, span := startRequestSpan(ctx, op, req)
+	defer func() { endRequestSpan(span, err) }()
 
-func (c *Client) doRequestWithRetry(ctx context.Context, req *http.Request) ([]byte, error) {
 	var lastErr error
-	maxRetries := 4
-	baseBackoff := 1 * time.Second
+	maxAttempts := c.MaxRetries + 1
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	idempotent := isIdempotent(req)
+	reauthenticated := false
+	start := time.Now()
+
+	var reqBodyBytes []byte
+	if req.Body != nil {
+		reqBodyBytes, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
 		if ctx.Err() != nil {
 			return nil, ctx.Err()
 		}
-
-		var reqBodyBytes []byte
-		if req.Body != nil {
-			reqBodyBytes, _ = io.ReadAll(req.Body)
-			req.Body = io.NopCloser(bytes.NewBuffer(reqBodyBytes))
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
 		}
 
-		cloneReq := req.Clone(ctx)
-		if req.Body != nil {
-			cloneReq.Body = io.NopCloser(bytes.NewBuffer(reqBodyBytes))
+		token, err := c.bearerToken(ctx)
+		if err != nil {
+			return nil, err
 		}
-
-		cloneReq.Header.Set("Authorization", "Bearer "+c.APIKey)
-		cloneReq.Header.Set("Content-Type", "application/scim+json")
-		cloneReq.Header.Set("Accept", "application/scim+json")
-
-		slog.Debug("Making API request", "method", cloneReq.Method, "url", cloneReq.URL.String())
-
-		res, httpErr := c.HTTPClient.Do(cloneReq)
+		res, httpErr := c.doAttempt(ctx, req, reqBodyBytes, token)
+		recordAttempt(span, attempt+1, res)
 		if httpErr != nil {
 			lastErr = httpErr
-			slog.Warn("HTTP transport error, will retry...", "attempt", attempt+1, "max_attempts", maxRetries, "error", lastErr)
-			time.Sleep(500 * time.Millisecond)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !idempotent {
+				// The request may have reached the server, so re-sending it could apply it twice.
+				return nil, fmt.Errorf("%s request failed and is not safe to retry: %w", req.Method, httpErr)
+			}
+			if err := c.checkRetryBudget(start, attempt+1, 500*time.Millisecond, lastErr); err != nil {
+				return nil, err
+			}
+			slog.Warn("HTTP transport error, will retry...", "attempt", attempt+1, "max_attempts", maxAttempts, "error", lastErr)
+			recordRetry(span, attempt+1, 500*time.Millisecond, lastErr)
+			if err := sleep(ctx, 500*time.Millisecond); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
-			backoff := float64(baseBackoff) * math.Pow(2, float64(attempt))
-			jitter := time.Duration(rand.Intn(1000)) * time.Millisecond
-			sleepDuration := time.Duration(backoff) + jitter
+		if res.StatusCode == http.StatusServiceUnavailable && isMaintenanceResponse(res) {
+			retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+			if retryAfter <= 0 || retryAfter > c.maintenanceWait {
+				return nil, &MaintenanceError{RetryAfter: retryAfter}
+			}
+			lastErr = &MaintenanceError{RetryAfter: retryAfter}
+			if err := c.checkRetryBudget(start, attempt+1, retryAfter, lastErr); err != nil {
+				return nil, err
+			}
+			slog.Warn("Tenant is in maintenance, waiting before retrying...", "attempt", attempt+1, "max_attempts", maxAttempts, "sleep_duration", retryAfter)
+			recordRetry(span, attempt+1, retryAfter, lastErr)
+			if err := sleep(ctx, retryAfter); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// A 429 means the request was rejected before processing, so it is always
+		// safe to retry. A 5xx may follow a server-side success, so only retry
+		// requests that cannot be applied twice.
+		if res.StatusCode == http.StatusTooManyRequests || (res.StatusCode >= 500 && idempotent) {
+			sleepDuration := c.retryBackoff(attempt)
+
+			// When rate limited, the server knows better than our backoff how long to wait.
+			if res.StatusCode == http.StatusTooManyRequests {
+				if retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); retryAfter > 0 {
+					sleepDuration = min(retryAfter, maxRetryAfter)
+				}
+			}
 
-			slog.Warn("API returned retryable error, backing off...", "status_code", res.StatusCode, "attempt", attempt+1, "max_attempts", maxRetries, "sleep_duration", sleepDuration)
-			res.Body.Close()
-			time.Sleep(sleepDuration)
 			lastErr = fmt.Errorf("API returned status %d", res.StatusCode)
+			if err := c.checkRetryBudget(start, attempt+1, sleepDuration, lastErr); err != nil {
+				return nil, err
+			}
+			slog.Warn("API returned retryable error, backing off...", "status_code", res.StatusCode, "attempt", attempt+1, "max_attempts", maxAttempts, "sleep_duration", sleepDuration)
+			recordRetry(span, attempt+1, sleepDuration, lastErr)
+			if err := sleep(ctx, sleepDuration); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		body, err := io.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
+		// An OAuth2 token can be revoked or expire early; fetch a fresh one once.
+		// The API rejected the request unprocessed, so re-sending is always safe.
+		if res.StatusCode == http.StatusUnauthorized && c.tokens != nil && !reauthenticated {
+			reauthenticated = true
+			c.tokens.invalidate()
+			slog.Warn("API rejected the access token, fetching a new one and retrying...")
+			attempt-- // the rejected attempt does not count against MaxRetries
+			continue
 		}
 
 		if res.StatusCode == http.StatusNoContent {
-			return nil, nil
+			res.Body = nil
+			return res, nil
 		}
 
+		if res.StatusCode == http.StatusNotFound {
+			return nil, newStatusError(res.StatusCode, res.Body, ErrNotFound)
+		}
+		if res.StatusCode == http.StatusPreconditionFailed {
+			return nil, newStatusError(res.StatusCode, res.Body, ErrPreconditionFailed)
+		}
+		if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+			return nil, newStatusError(res.StatusCode, res.Body, ErrUnauthorized)
+		}
 		if res.StatusCode < 200 || res.StatusCode >= 300 {
-			return nil, fmt.Errorf("api request failed with non-retryable status %d: %s", res.StatusCode, string(body))
+			return nil, newStatusError(res.StatusCode, res.Body, nil)
 		}
 
-		return body, nil
+		return res, nil
 	}
 
-	return nil, fmt.Errorf("request failed after %d attempts: %w", maxRetries, lastErr)
+	return nil, fmt.Errorf("request failed after %d attempts: %w (%w)", maxAttempts, lastErr, ErrTransient)
+}
+
+// retryBackoff returns the wait before retrying after attempt failed. It is
+// drawn uniformly from zero to BaseBackoff doubled attempt times, capped at
+// MaxBackoff ("full jitter"), so clients that failed together spread out
+// instead of retrying in step.
+func (c *Client) retryBackoff(attempt int) time.Duration {
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	ceiling := min(float64(c.BaseBackoff)*math.Pow(2, float64(attempt)), float64(maxBackoff))
+	if ceiling <= 0 {
+		return 0
+	}
+	c.rngMu.Lock()
+	defer c.rngMu.Unlock()
+	return time.Duration(c.rng.Int64N(int64(ceiling) + 1))
+}
+
+// checkRetryBudget fails a request started at start, after attempts attempts,
+// if waiting another wait before retrying would take it past MaxElapsed.
+// lastErr is the failure that would have been retried.
+func (c *Client) checkRetryBudget(start time.Time, attempts int, wait time.Duration, lastErr error) error {
+	if c.MaxElapsed <= 0 {
+		return nil
+	}
+	if elapsed := time.Since(start); elapsed+wait > c.MaxElapsed {
+		return fmt.Errorf("retry budget exhausted after %d attempts in %s: %w (%w)", attempts, elapsed.Round(time.Millisecond), lastErr, ErrTransient)
+	}
+	return nil
+}
+
+// sleep waits for d between attempts, returning ctx's error early if it is
+// cancelled so an interrupt does not wait out a long backoff.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// attemptResult is the fully-read outcome of a single HTTP round trip.
+type attemptResult struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// doAttempt sends one copy of req, authenticated with token, and reads the
+// whole response. When a RequestTimeout is configured the attempt runs under
+// its own deadline, so a hung connection fails just this attempt (and is
+// retried) while ctx remains in charge of cancelling the overall operation.
+func (c *Client) doAttempt(ctx context.Context, req *http.Request, reqBody []byte, token string) (*attemptResult, error) {
+	if c.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.RequestTimeout)
+		defer cancel()
+	}
+
+	cloneReq := req.Clone(ctx)
+	if reqBody != nil {
+		cloneReq.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	cloneReq.Header.Set("Authorization", "Bearer "+token)
+	cloneReq.Header.Set("Content-Type", "application/scim+json")
+	cloneReq.Header.Set("Accept", "application/scim+json")
+
+	slog.Debug("Making API request", "method", cloneReq.Method, "url", cloneReq.URL.String())
+	c.bodyLog.logRequest(cloneReq, reqBody)
+
+	res, err := c.HTTPClient.Do(cloneReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	c.bodyLog.logResponse(cloneReq, res.StatusCode, body)
+	return &attemptResult{StatusCode: res.StatusCode, Header: res.Header, Body: body}, nil
+}
+
+// bearerToken returns the credential sent in the Authorization header: an
+// OAuth2 access token when client credentials are configured, else APIKey.
+func (c *Client) bearerToken(ctx context.Context) (string, error) {
+	if c.tokens == nil {
+		return c.APIKey, nil
+	}
+	return c.tokens.token(ctx, c.HTTPClient)
+}
+
+// maxRetryAfter caps how long the client honors a 429 Retry-After header, so a
+// misbehaving server cannot stall a run indefinitely.
+const maxRetryAfter = 5 * time.Minute
+
+// IdempotencyKeyHeader marks an otherwise non-idempotent request (a POST) as
+// safe to retry, because the server deduplicates requests carrying the same key.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// isIdempotent reports whether req can be re-sent after a failure that may
+// have reached the server without risk of applying it twice.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// maintenanceSCIMType is the scimType of the SCIM error SmartSuite returns
+// with a 503 during a maintenance window.
+const maintenanceSCIMType = "maintenance"
+
+// isMaintenanceResponse reports whether a 503 response indicates a planned
+// maintenance window rather than a transient outage. SmartSuite marks those
+// with an X-Maintenance-Mode header or a SCIM error body whose scimType is
+// "maintenance"; any other 503 is an outage and is retried, whatever its body
+// says.
+func isMaintenanceResponse(res *attemptResult) bool {
+	if res.Header.Get("X-Maintenance-Mode") != "" {
+		return true
+	}
+	var scimErr struct {
+		SCIMType string `json:"scimType"`
+	}
+	return json.Unmarshal(res.Body, &scimErr) == nil && scimErr.SCIMType == maintenanceSCIMType
+}
+
+// parseRetryAfter interprets a Retry-After header value, which may be either a
+// number of seconds or an HTTP date. It returns zero if the value is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
 }
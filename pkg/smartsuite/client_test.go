@@ -0,0 +1,577 @@
+package smartsuite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// newTestClient returns a client for baseURL whose retries back off from a
+// millisecond rather than a second, with jitter from a fixed seed so retry
+// waits are the same on every run.
+func newTestClient(t *testing.T, baseURL string, opts ...ClientOption) *Client {
+	t.Helper()
+	defaults := []ClientOption{
+		WithBaseBackoff(time.Millisecond),
+		WithMaxBackoff(time.Millisecond),
+		WithRand(rand.New(rand.NewPCG(1, 2))),
+	}
+	c, err := NewClient(baseURL, "test-key", append(defaults, opts...)...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return c
+}
+
+// countedHandler handles the nth request (counting from 1) to a countingServer.
+type countedHandler func(w http.ResponseWriter, r *http.Request, n int32)
+
+// countingServer serves every request with handler and counts them.
+func countingServer(t *testing.T, handler countedHandler) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var count atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, count.Add(1))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &count
+}
+
+func statusHandler(status int) countedHandler {
+	return func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(status)
+	}
+}
+
+// userList is a list response holding alice.
+const userList = `{"totalResults":1,"Resources":[{"id":"1","userName":"alice@example.edu"}]}`
+
+func TestMaintenanceFailsFast(t *testing.T) {
+	srv, count := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"503","scimType":"maintenance","detail":"Tenant is undergoing scheduled maintenance"}`))
+	})
+	c := newTestClient(t, srv.URL)
+
+	_, err := c.GetUserByUsername(context.Background(), "alice@example.edu")
+	var maintenance *MaintenanceError
+	if !errors.As(err, &maintenance) {
+		t.Fatalf("GetUserByUsername error = %v, want a *MaintenanceError", err)
+	}
+	if maintenance.RetryAfter != time.Hour {
+		t.Errorf("RetryAfter = %s, want 1h", maintenance.RetryAfter)
+	}
+	if got := count.Load(); got != 1 {
+		t.Errorf("sent %d requests, want 1", got)
+	}
+}
+
+func TestMaintenanceWaitRetriesAfterWindow(t *testing.T) {
+	srv, count := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if n == 1 {
+			w.Header().Set("X-Maintenance-Mode", "true")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(userList))
+	})
+	c := newTestClient(t, srv.URL, WithMaintenanceWait(time.Minute))
+
+	if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got := count.Load(); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+}
+
+func TestPlain503MentioningMaintenanceIsRetried(t *testing.T) {
+	// Only the header or the SCIM error type mark maintenance; an outage page
+	// that happens to use the word is retried like any other 503.
+	srv, count := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Upstream unavailable during load balancer maintenance"))
+			return
+		}
+		w.Write([]byte(userList))
+	})
+	c := newTestClient(t, srv.URL)
+
+	if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got := count.Load(); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		wantPath string
+	}{
+		{prefix: "", wantPath: "/Users"},
+		{prefix: "scim/v2", wantPath: "/scim/v2/Users"},
+		{prefix: "/scim/v2", wantPath: "/scim/v2/Users"},
+		{prefix: "scim/v2/", wantPath: "/scim/v2/Users"},
+		{prefix: "/scim/v2/", wantPath: "/scim/v2/Users"},
+	}
+	for _, tt := range tests {
+		for _, trailingSlash := range []string{"", "/"} {
+			t.Run(tt.prefix+" base"+trailingSlash, func(t *testing.T) {
+				var gotPath string
+				srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+					gotPath = r.URL.Path
+					w.Write([]byte(userList))
+				})
+				c := newTestClient(t, srv.URL+trailingSlash, WithPathPrefix(tt.prefix))
+
+				if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err != nil {
+					t.Fatalf("GetUserByUsername: %v", err)
+				}
+				if gotPath != tt.wantPath {
+					t.Errorf("request path = %q, want %q", gotPath, tt.wantPath)
+				}
+			})
+		}
+	}
+}
+
+// failOnceHandler answers the first request with status and every later one
+// with body.
+func failOnceHandler(status int, body string) countedHandler {
+	return func(w http.ResponseWriter, r *http.Request, n int32) {
+		if n == 1 {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(body))
+	}
+}
+
+func TestPostWithoutIdempotencyKeyIsNotRetriedOn500(t *testing.T) {
+	srv, count := countingServer(t, statusHandler(http.StatusInternalServerError))
+	c := newTestClient(t, srv.URL)
+
+	if _, err := c.CreateUser(context.Background(), models.SCIMUser{UserName: "alice@example.edu"}); err == nil {
+		t.Fatal("CreateUser succeeded against a failing server")
+	}
+	if got := count.Load(); got != 1 {
+		t.Errorf("POST sent %d times, want 1", got)
+	}
+}
+
+func TestGetIsRetriedOn500(t *testing.T) {
+	srv, count := countingServer(t, failOnceHandler(http.StatusInternalServerError, userList))
+	c := newTestClient(t, srv.URL)
+
+	if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got := count.Load(); got != 2 {
+		t.Errorf("GET sent %d times, want 2", got)
+	}
+}
+
+func TestPostWithIdempotencyKeyIsRetriedOn500(t *testing.T) {
+	srv, count := countingServer(t, failOnceHandler(http.StatusInternalServerError, `{"id":"1"}`))
+	c := newTestClient(t, srv.URL)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/Users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	if _, err := c.doRequestWithRetry(context.Background(), "CreateUser", req); err != nil {
+		t.Fatalf("doRequestWithRetry: %v", err)
+	}
+	if got := count.Load(); got != 2 {
+		t.Errorf("POST sent %d times, want 2", got)
+	}
+}
+
+func TestMaxRetries(t *testing.T) {
+	tests := []struct {
+		retries      int
+		wantRequests int32
+	}{
+		{retries: 0, wantRequests: 1},
+		{retries: 2, wantRequests: 3},
+		{retries: -1, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		srv, count := countingServer(t, statusHandler(http.StatusInternalServerError))
+		c := newTestClient(t, srv.URL, WithMaxRetries(tt.retries))
+
+		if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err == nil {
+			t.Fatalf("WithMaxRetries(%d): GetUserByUsername succeeded against a failing server", tt.retries)
+		}
+		if got := count.Load(); got != tt.wantRequests {
+			t.Errorf("WithMaxRetries(%d) sent %d requests, want %d", tt.retries, got, tt.wantRequests)
+		}
+	}
+}
+
+func TestNewClientRetryDefaults(t *testing.T) {
+	c, err := NewClient("http://scim.invalid", "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxRetries != DefaultMaxRetries || c.BaseBackoff != DefaultBaseBackoff {
+		t.Errorf("MaxRetries, BaseBackoff = %d, %s, want %d, %s", c.MaxRetries, c.BaseBackoff, DefaultMaxRetries, DefaultBaseBackoff)
+	}
+}
+
+func TestRetryAfterIsHonoredOn429(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter func() string
+	}{
+		{"seconds", func() string { return "1" }},
+		{"http date", func() string { return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, count := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+				if n == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter())
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.Write([]byte(userList))
+			})
+			c := newTestClient(t, srv.URL)
+
+			start := time.Now()
+			if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err != nil {
+				t.Fatalf("GetUserByUsername: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+				t.Errorf("retried after %s, want Retry-After to be waited out", elapsed)
+			}
+			if got := count.Load(); got != 2 {
+				t.Errorf("sent %d requests, want 2", got)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGetUserByID(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if r.URL.Path != "/Users/1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id":"1","userName":"alice@example.edu","active":true}`))
+	})
+	c := newTestClient(t, srv.URL)
+
+	user, err := c.GetUserByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user == nil || user.ID != "1" || user.UserName != "alice@example.edu" || !user.Active {
+		t.Errorf("GetUserByID = %+v, want alice@example.edu with id 1", user)
+	}
+
+	user, err = c.GetUserByID(context.Background(), "2")
+	if err != nil || user != nil {
+		t.Errorf("GetUserByID of a missing user = %+v, %v, want nil, nil", user, err)
+	}
+}
+
+func TestUpdateUserPutsFullUser(t *testing.T) {
+	var method, path string
+	var body map[string]interface{}
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		method, path = r.Method, r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"id":"1","userName":"alice@example.edu","title":"Professor"}`))
+	})
+	c := newTestClient(t, srv.URL)
+
+	user := models.SCIMUser{
+		UserName: "alice@example.edu",
+		Title:    "Professor",
+		Active:   true,
+		Emails:   []models.SCIMEmail{{Value: "alice@example.edu", Primary: true}},
+	}
+	updated, err := c.UpdateUser(context.Background(), "1", user)
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if updated.Title != "Professor" {
+		t.Errorf("UpdateUser returned title %q, want the server's %q", updated.Title, "Professor")
+	}
+
+	if method != http.MethodPut || path != "/Users/1" {
+		t.Errorf("request = %s %s, want PUT /Users/1", method, path)
+	}
+	if _, ok := body["Operations"]; ok {
+		t.Errorf("body is a PatchOp, want the full user: %v", body)
+	}
+	for attr, want := range map[string]interface{}{"id": "1", "userName": "alice@example.edu", "title": "Professor", "active": true} {
+		if body[attr] != want {
+			t.Errorf("body[%q] = %v, want %v", attr, body[attr], want)
+		}
+	}
+	if emails, _ := body["emails"].([]interface{}); len(emails) != 1 {
+		t.Errorf("body emails = %v, want the user's one email", body["emails"])
+	}
+	schemas, _ := body["schemas"].([]interface{})
+	if len(schemas) == 0 || schemas[0] != "urn:ietf:params:scim:schemas:core:2.0:User" {
+		t.Errorf("body schemas = %v, want the core User schema", body["schemas"])
+	}
+}
+
+func TestRateLimitSpacesRequests(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Time
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		w.Write([]byte(userList))
+	})
+	c := newTestClient(t, srv.URL, WithRateLimit(20, 1))
+
+	for range 4 {
+		if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err != nil {
+			t.Fatalf("GetUserByUsername: %v", err)
+		}
+	}
+
+	// At 20 requests per second with no burst, requests are 50ms apart.
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i < len(arrivals); i++ {
+		if gap := arrivals[i].Sub(arrivals[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("request %d came %s after the one before, want about 50ms", i+1, gap)
+		}
+	}
+}
+
+func TestRateLimitWaitStopsOnCancel(t *testing.T) {
+	srv, count := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Write([]byte(userList))
+	})
+	c := newTestClient(t, srv.URL, WithRateLimit(0.01, 1))
+	if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetUserByUsername(ctx, "alice@example.edu"); err == nil {
+		t.Fatal("GetUserByUsername succeeded without waiting for the limiter")
+	}
+	if got := count.Load(); got != 1 {
+		t.Errorf("sent %d requests, want 1", got)
+	}
+}
+
+func TestPatchUserIfMatchPreconditionFailed(t *testing.T) {
+	var ifMatch atomic.Value
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		ifMatch.Store(r.Header.Get("If-Match"))
+		w.WriteHeader(http.StatusPreconditionFailed)
+	})
+	c := newTestClient(t, srv.URL)
+
+	err := c.PatchUserIfMatch(context.Background(), "1", `W/"3"`, []models.SCIMPatchOp{{Op: "replace", Path: "title", Value: "Dean"}})
+	if !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("PatchUserIfMatch error = %v, want ErrPreconditionFailed", err)
+	}
+	if got := ifMatch.Load(); got != `W/"3"` {
+		t.Errorf("If-Match = %v, want W/\"3\"", got)
+	}
+}
+
+func TestGetUserByIDTakesETagFromHeader(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("ETag", `W/"7"`)
+		w.Write([]byte(`{"id":"1","userName":"alice@example.edu","meta":{"version":"W/\"6\""}}`))
+	})
+	c := newTestClient(t, srv.URL)
+
+	user, err := c.GetUserByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if got := user.Version(); got != `W/"7"` {
+		t.Errorf("Version() = %q, want the ETag header W/\"7\"", got)
+	}
+}
+
+func TestRetryBackoffNeverExceedsCap(t *testing.T) {
+	limit := 250 * time.Millisecond
+	c := newTestClient(t, "http://scim.invalid", WithBaseBackoff(100*time.Millisecond), WithMaxBackoff(limit))
+
+	for attempt := range 40 {
+		for range 50 {
+			if wait := c.retryBackoff(attempt); wait < 0 || wait > limit {
+				t.Fatalf("retryBackoff(%d) = %s, want within [0, %s]", attempt, wait, limit)
+			}
+		}
+	}
+}
+
+func TestCancelDuringRetryWaitReturnsPromptly(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler countedHandler
+	}{
+		// With the fixed seed the first retry waits far longer than the test runs.
+		{"backoff", statusHandler(http.StatusServiceUnavailable)},
+		{"Retry-After", func(w http.ResponseWriter, r *http.Request, n int32) {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, count := countingServer(t, tt.handler)
+			c := newTestClient(t, srv.URL, WithBaseBackoff(time.Hour), WithMaxBackoff(time.Hour))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			start := time.Now()
+			_, err := c.GetUserByID(ctx, "1")
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("GetUserByID error = %v, want context.Canceled", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("returned %s after the request started, want promptly after cancellation", elapsed)
+			}
+			if got := count.Load(); got != 1 {
+				t.Errorf("sent %d requests, want 1 before the cancelled wait", got)
+			}
+		})
+	}
+}
+
+func TestMaxElapsedStopsRetrying(t *testing.T) {
+	srv, count := countingServer(t, statusHandler(http.StatusServiceUnavailable))
+	c := newTestClient(t, srv.URL,
+		WithMaxRetries(1000),
+		WithBaseBackoff(20*time.Millisecond),
+		WithMaxBackoff(20*time.Millisecond),
+		WithMaxElapsed(200*time.Millisecond),
+	)
+
+	start := time.Now()
+	_, err := c.GetUserByID(context.Background(), "1")
+	if err == nil || !strings.Contains(err.Error(), "retry budget exhausted") {
+		t.Fatalf("GetUserByID error = %v, want retry budget exhausted", err)
+	}
+	if !errors.Is(err, ErrTransient) {
+		t.Errorf("error = %v, want it to wrap ErrTransient", err)
+	}
+	// Only the last attempt itself can run past the budget.
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("gave up after %s, want about MaxElapsed", elapsed)
+	}
+	if got := count.Load(); got < 2 {
+		t.Errorf("sent %d requests, want the request retried until the budget ran out", got)
+	}
+}
+
+func TestStatusErrorCarriesStatusAndScimType(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"400","scimType":"invalidValue","detail":"bad title"}`))
+	})
+	c := newTestClient(t, srv.URL)
+
+	err := c.PatchUser(context.Background(), "1", []models.SCIMPatchOp{{Op: "replace", Path: "title", Value: ""}})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("PatchUser error = %v, want a *StatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusBadRequest || statusErr.ScimType != "invalidValue" {
+		t.Errorf("StatusError = %d %q, want 400 invalidValue", statusErr.StatusCode, statusErr.ScimType)
+	}
+	if !strings.Contains(string(statusErr.Body), "bad title") {
+		t.Errorf("StatusError.Body = %s, want the response body", statusErr.Body)
+	}
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrTransient) {
+		t.Errorf("a 400 error = %v, want neither ErrNotFound nor ErrTransient", err)
+	}
+}
+
+func TestNotFoundStatusError(t *testing.T) {
+	srv, _ := countingServer(t, statusHandler(http.StatusNotFound))
+	c := newTestClient(t, srv.URL)
+
+	err := c.PatchUser(context.Background(), "1", []models.SCIMPatchOp{{Op: "replace", Path: "active", Value: false}})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("PatchUser error = %v, want a 404 *StatusError", err)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("error = %v, want it to wrap ErrNotFound", err)
+	}
+}
+
+func TestDeleteTreatsNotFoundAsSuccess(t *testing.T) {
+	srv, count := countingServer(t, statusHandler(http.StatusNotFound))
+	c := newTestClient(t, srv.URL)
+
+	if err := c.DeleteUser(context.Background(), "1"); err != nil {
+		t.Errorf("DeleteUser of a missing user: %v", err)
+	}
+	if err := c.DeleteGroup(context.Background(), "1"); err != nil {
+		t.Errorf("DeleteGroup of a missing group: %v", err)
+	}
+	if got := count.Load(); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+}
+
+func TestDeleteReportsOtherErrors(t *testing.T) {
+	srv, _ := countingServer(t, statusHandler(http.StatusForbidden))
+	c := newTestClient(t, srv.URL)
+
+	err := c.DeleteUser(context.Background(), "1")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("DeleteUser error = %v, want a 403 *StatusError", err)
+	}
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("error = %v, want it to wrap ErrUnauthorized", err)
+	}
+}
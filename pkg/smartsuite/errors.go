@@ -0,0 +1,67 @@
+package smartsuite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is wrapped by errors for requests the API answered with 404 Not Found.
+var ErrNotFound = errors.New("resource not found")
+
+// ErrPreconditionFailed is wrapped by errors for conditional requests the API
+// answered with 412 Precondition Failed: the resource changed since its ETag
+// was read, and the caller should re-fetch it before trying again.
+var ErrPreconditionFailed = errors.New("resource was modified since it was last read")
+
+// ErrUnauthorized is wrapped by errors for requests the API answered with 401
+// Unauthorized or 403 Forbidden, which usually means a wrong or revoked API key.
+var ErrUnauthorized = errors.New("authentication rejected")
+
+// ErrTransient is wrapped by errors for requests that were still failing when
+// retries ran out, for reasons expected to clear up on their own: transport
+// errors, and 429 or 5xx responses. Trying the same request later may succeed.
+var ErrTransient = errors.New("transient API failure")
+
+// MaintenanceError is returned when SmartSuite reports that the tenant is in
+// a maintenance window. Retrying during maintenance only burns the caller's
+// time budget, so the client fails fast with this error instead.
+type MaintenanceError struct {
+	// RetryAfter is the wait advertised by the server, or zero if none was sent.
+	RetryAfter time.Duration
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("tenant in maintenance, try later (retry after %s)", e.RetryAfter)
+	}
+	return "tenant in maintenance, try later"
+}
+
+// StatusError is returned for a response with a non-retryable error status.
+// It unwraps to ErrNotFound, ErrPreconditionFailed or ErrUnauthorized where
+// one applies; callers that need the exact status use errors.As.
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+	// ScimType is the scimType of a SCIM error body (RFC 7644 §3.12), if any.
+	ScimType string
+	sentinel error
+}
+
+func newStatusError(statusCode int, body []byte, sentinel error) *StatusError {
+	var scimErr struct {
+		ScimType string `json:"scimType"`
+	}
+	json.Unmarshal(body, &scimErr)
+	return &StatusError{StatusCode: statusCode, Body: body, ScimType: scimErr.ScimType, sentinel: sentinel}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("api request failed with non-retryable status %d: %s", e.StatusCode, string(e.Body))
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.sentinel
+}
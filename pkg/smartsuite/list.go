@@ -0,0 +1,193 @@
+package smartsuite
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// Sort orders accepted by ListOptions.SortOrder.
+const (
+	SortAscending  = "ascending"
+	SortDescending = "descending"
+)
+
+// ListOptions controls how GetUsers and GetGroups ask the server to order
+// results. The zero value requests the server's default order.
+type ListOptions struct {
+	// SortBy is the attribute to sort on, e.g. "userName" or "displayName".
+	SortBy string
+	// SortOrder is SortAscending (the default when empty) or SortDescending.
+	SortOrder string
+}
+
+// sortParams returns the query parameters that ask the server to sort by
+// opts, or nil if opts requests no sorting or the server does not advertise
+// sort support in its ServiceProviderConfig. In the latter case the caller
+// sorts the fetched results itself.
+func (c *Client) sortParams(ctx context.Context, opts ListOptions) (url.Values, bool) {
+	if opts.SortBy == "" {
+		return nil, true
+	}
+	config, err := c.GetServiceProviderConfig(ctx)
+	if err != nil || !config.Sort.Supported {
+		slog.Debug("Server does not advertise sort support; sorting results locally.", "sort_by", opts.SortBy, "error", err)
+		return nil, false
+	}
+	params := url.Values{}
+	params.Set("sortBy", opts.SortBy)
+	if opts.SortOrder != "" {
+		params.Set("sortOrder", opts.SortOrder)
+	}
+	return params, true
+}
+
+// sortUsersLocally orders users by opts for servers that cannot sort. Only
+// userName and id are supported; any other attribute leaves the order as
+// returned.
+func sortUsersLocally(users []models.SCIMUser, opts ListOptions) {
+	var key func(models.SCIMUser) string
+	switch strings.ToLower(opts.SortBy) {
+	case "username":
+		key = func(u models.SCIMUser) string { return u.UserName }
+	case "id":
+		key = func(u models.SCIMUser) string { return u.ID }
+	default:
+		return
+	}
+	desc := opts.SortOrder == SortDescending
+	sort.SliceStable(users, func(i, j int) bool {
+		if desc {
+			return key(users[i]) > key(users[j])
+		}
+		return key(users[i]) < key(users[j])
+	})
+}
+
+// sortGroupsLocally is sortUsersLocally for groups, supporting displayName and id.
+func sortGroupsLocally(groups []models.SCIMGroup, opts ListOptions) {
+	var key func(models.SCIMGroup) string
+	switch strings.ToLower(opts.SortBy) {
+	case "displayname":
+		key = func(g models.SCIMGroup) string { return g.DisplayName }
+	case "id":
+		key = func(g models.SCIMGroup) string { return g.ID }
+	default:
+		return
+	}
+	desc := opts.SortOrder == SortDescending
+	sort.SliceStable(groups, func(i, j int) bool {
+		if desc {
+			return key(groups[i]) > key(groups[j])
+		}
+		return key(groups[i]) < key(groups[j])
+	})
+}
+
+// UserPages lists users one page at a time from startIndex (1-based), calling
+// fn with each page and the startIndex the page after it begins at, so the
+// caller can persist progress and resume the listing later. Pages are fetched
+// sequentially in opts order when the server can sort, and in its default
+// order otherwise; a resumed listing only lines up with the pages fetched
+// before if that order has not changed in between. An error from fn stops the
+// listing and is returned.
+func (c *Client) UserPages(ctx context.Context, opts ListOptions, startIndex int, fn func(users []models.SCIMUser, next int) error) error {
+	params, _ := c.sortParams(ctx, opts)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	pageSize := c.pageSize
+	fetched := startIndex - 1
+	for first := true; ; first = false {
+		users, info, err := c.getUserPage(ctx, params, startIndex, pageSize)
+		if err != nil {
+			return err
+		}
+		if !first && info.startIndex > 0 && info.startIndex != startIndex {
+			return fmt.Errorf("server returned a page at startIndex %d when asked for %d; it does not support paging", info.startIndex, startIndex)
+		}
+		fetched += info.returned
+		next := startIndex + info.returned
+		if err := fn(users, next); err != nil {
+			return err
+		}
+		if first {
+			// As in getAllUsers, continue at the size the server actually uses.
+			pageSize = pageStep(pageSize, info)
+		}
+		if lastPage(info, fetched, pageSize) {
+			return nil
+		}
+		startIndex = next
+	}
+}
+
+// pageInfo is the paging metadata of one list response.
+type pageInfo struct {
+	total        int // totalResults as reported, which some servers leave at zero
+	itemsPerPage int // itemsPerPage as echoed by the server, or zero
+	startIndex   int // startIndex as echoed by the server, or zero
+	returned     int // resources in the page, including any that failed to decode
+}
+
+func newPageInfo(r *models.ListResponse) pageInfo {
+	return pageInfo{total: r.TotalResults, itemsPerPage: r.ItemsPerPage, startIndex: r.StartIndex, returned: len(r.Resources)}
+}
+
+// pageStep returns the page size to continue a listing with after its first
+// page: the count requested, lowered to the itemsPerPage the server echoed or
+// the number of resources it actually returned, whichever is smaller.
+func pageStep(requested int, first pageInfo) int {
+	step := requested
+	if first.itemsPerPage > 0 && first.itemsPerPage < step {
+		step = first.itemsPerPage
+	}
+	if first.returned > 0 && first.returned < step {
+		step = first.returned
+	}
+	return step
+}
+
+// paginate continues a listing one page at a time after its first page,
+// requesting pageSize resources per page and advancing startIndex by what each
+// page returned. It stops at an empty page and, when the server reports a
+// totalResults that covers what has been fetched, once that many resources
+// have been returned. Servers that report totalResults as zero or too low
+// are instead paged until a page comes back shorter than pageSize. A page
+// whose echoed startIndex is not the one requested is an error, since the
+// server is not paging and the listing would never end.
+func paginate[T any](all []T, first pageInfo, pageSize int, fetch func(startIndex, count int) ([]T, pageInfo, error)) ([]T, error) {
+	info := first
+	startIndex, fetched := 1, first.returned
+	for !lastPage(info, fetched, pageSize) {
+		startIndex += info.returned
+		items, next, err := fetch(startIndex, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		if next.startIndex > 0 && next.startIndex != startIndex {
+			return nil, fmt.Errorf("server returned a page at startIndex %d when asked for %d; it does not support paging", next.startIndex, startIndex)
+		}
+		all = append(all, items...)
+		info = next
+		fetched += next.returned
+	}
+	return all, nil
+}
+
+// lastPage reports whether the page described by info ends a listing of which
+// fetched resources have been returned so far.
+func lastPage(info pageInfo, fetched, pageSize int) bool {
+	if info.returned == 0 {
+		return true
+	}
+	if info.total > 0 && info.total >= fetched {
+		return fetched >= info.total
+	}
+	return info.returned < pageSize
+}
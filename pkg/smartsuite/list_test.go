@@ -0,0 +1,258 @@
+package smartsuite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// listServer serves users, two per page in the order given, and a
+// ServiceProviderConfig that advertises sort support if sortable. It returns
+// the query of every /Users request.
+func listServer(t *testing.T, sortable bool, users ...models.SCIMUser) (*httptest.Server, func() []url.Values) {
+	t.Helper()
+	var mu sync.Mutex
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ServiceProviderConfig" {
+			json.NewEncoder(w).Encode(models.ServiceProviderConfig{Sort: models.SupportedFeature{Supported: sortable}})
+			return
+		}
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		from := min(max(start, 1)-1, len(users))
+		to := min(from+2, len(users))
+		resources := make([]interface{}, 0, to-from)
+		for _, u := range users[from:to] {
+			resources = append(resources, u)
+		}
+		json.NewEncoder(w).Encode(models.ListResponse{TotalResults: len(users), ItemsPerPage: to - from, StartIndex: from + 1, Resources: resources})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+var unsortedUsers = []models.SCIMUser{
+	{ID: "2", UserName: "bob@example.edu"},
+	{ID: "3", UserName: "carol@example.edu"},
+	{ID: "1", UserName: "alice@example.edu"},
+}
+
+func userNames(users []models.SCIMUser) []string {
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = u.UserName
+	}
+	return names
+}
+
+func TestGetUsersSendsSortParamsOnEveryPage(t *testing.T) {
+	srv, queries := listServer(t, true, unsortedUsers...)
+	c := newTestClient(t, srv.URL, WithPageWorkers(1))
+
+	users, err := c.GetUsers(context.Background(), ListOptions{SortBy: "userName", SortOrder: SortDescending})
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	if len(users) != len(unsortedUsers) {
+		t.Fatalf("GetUsers returned %d users, want %d", len(users), len(unsortedUsers))
+	}
+	got := queries()
+	if len(got) != 2 {
+		t.Fatalf("sent %d list requests, want 2", len(got))
+	}
+	for i, q := range got {
+		if q.Get("sortBy") != "userName" || q.Get("sortOrder") != SortDescending {
+			t.Errorf("page %d query = %v, want sortBy=userName and sortOrder=descending", i+1, q)
+		}
+	}
+}
+
+func TestGetUsersSortsLocallyWithoutServerSupport(t *testing.T) {
+	srv, queries := listServer(t, false, unsortedUsers...)
+	c := newTestClient(t, srv.URL, WithPageWorkers(1))
+
+	tests := []struct {
+		opts ListOptions
+		want []string
+	}{
+		{ListOptions{SortBy: "userName"}, []string{"alice@example.edu", "bob@example.edu", "carol@example.edu"}},
+		{ListOptions{SortBy: "userName", SortOrder: SortDescending}, []string{"carol@example.edu", "bob@example.edu", "alice@example.edu"}},
+		{ListOptions{}, []string{"bob@example.edu", "carol@example.edu", "alice@example.edu"}},
+	}
+	for _, tt := range tests {
+		users, err := c.GetUsers(context.Background(), tt.opts)
+		if err != nil {
+			t.Fatalf("GetUsers(%+v): %v", tt.opts, err)
+		}
+		if got := userNames(users); !slices.Equal(got, tt.want) {
+			t.Errorf("GetUsers(%+v) order = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+	for _, q := range queries() {
+		if q.Has("sortBy") || q.Has("sortOrder") {
+			t.Errorf("query %v asks an unsortable server to sort", q)
+		}
+	}
+}
+
+func TestGetUsersFilteredPagesThroughMatches(t *testing.T) {
+	const filter = `emails.value co "@contractor.com"`
+	srv, queries := listServer(t, false, unsortedUsers...)
+	c := newTestClient(t, srv.URL, WithPageWorkers(1))
+
+	users, err := c.GetUsersFiltered(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("GetUsersFiltered: %v", err)
+	}
+	want := []string{"bob@example.edu", "carol@example.edu", "alice@example.edu"}
+	if got := userNames(users); !slices.Equal(got, want) {
+		t.Errorf("GetUsersFiltered = %v, want %v", got, want)
+	}
+	got := queries()
+	if len(got) != 2 {
+		t.Fatalf("sent %d list requests, want 2", len(got))
+	}
+	for i, q := range got {
+		if q.Get("filter") != filter {
+			t.Errorf("page %d filter = %q, want %q", i+1, q.Get("filter"), filter)
+		}
+	}
+}
+
+func TestGetUsersFilteredNoMatches(t *testing.T) {
+	srv, _ := listServer(t, false)
+	c := newTestClient(t, srv.URL)
+
+	users, err := c.GetUsersFiltered(context.Background(), "active eq false")
+	if err != nil {
+		t.Fatalf("GetUsersFiltered: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("GetUsersFiltered = %v, want no users", users)
+	}
+	if _, err := c.GetUsersFiltered(context.Background(), "  "); err == nil {
+		t.Error("GetUsersFiltered with a blank filter succeeded")
+	}
+}
+
+func TestPageSizeSetsRequestedCount(t *testing.T) {
+	var mu sync.Mutex
+	var counts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		counts = append(counts, r.URL.Query().Get("count"))
+		mu.Unlock()
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		from := min(start-1, len(unsortedUsers))
+		to := min(from+count, len(unsortedUsers))
+		resources := make([]interface{}, 0, to-from)
+		for _, u := range unsortedUsers[from:to] {
+			resources = append(resources, u)
+		}
+		json.NewEncoder(w).Encode(models.ListResponse{TotalResults: len(unsortedUsers), ItemsPerPage: to - from, StartIndex: start, Resources: resources})
+	}))
+	t.Cleanup(srv.Close)
+	c := newTestClient(t, srv.URL, WithPageSize(2), WithPageWorkers(1))
+
+	users, err := c.GetUsers(context.Background(), ListOptions{})
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	if len(users) != len(unsortedUsers) {
+		t.Errorf("GetUsers returned %d users, want %d", len(users), len(unsortedUsers))
+	}
+	if want := []string{"2", "2"}; !slices.Equal(counts, want) {
+		t.Errorf("requested counts = %v, want %v", counts, want)
+	}
+}
+
+// pagingServer serves n users, returning at most limit per page however many
+// are asked for. With reportTotal false it sends totalResults as 0, as some
+// servers do. It returns the startIndex of every request.
+func pagingServer(t *testing.T, n, limit int, reportTotal bool) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var starts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		starts = append(starts, r.URL.Query().Get("startIndex"))
+		mu.Unlock()
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		from := min(start-1, n)
+		to := min(from+min(count, limit), n)
+		resources := make([]interface{}, 0, to-from)
+		for i := from; i < to; i++ {
+			resources = append(resources, models.SCIMUser{ID: strconv.Itoa(i + 1), UserName: "user" + strconv.Itoa(i+1) + "@example.edu"})
+		}
+		total := 0
+		if reportTotal {
+			total = n
+		}
+		json.NewEncoder(w).Encode(models.ListResponse{TotalResults: total, ItemsPerPage: to - from, StartIndex: start, Resources: resources})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return starts
+	}
+}
+
+func TestGetUsersPaging(t *testing.T) {
+	tests := []struct {
+		name        string
+		users       int
+		pageSize    int
+		limit       int
+		reportTotal bool
+		workers     int
+		wantStarts  []string
+	}{
+		{"no totalResults, short last page", 5, 2, 2, false, 1, []string{"1", "3", "5"}},
+		{"no totalResults, full last page", 4, 2, 2, false, 1, []string{"1", "3", "5"}},
+		{"no totalResults, concurrent workers", 5, 2, 2, false, 4, []string{"1", "3", "5"}},
+		{"count capped, short last page", 5, 100, 2, true, 1, []string{"1", "3", "5"}},
+		{"count capped, concurrent workers", 5, 100, 2, true, 4, nil},
+		{"everything on one page", 3, 100, 100, true, 1, []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, starts := pagingServer(t, tt.users, tt.limit, tt.reportTotal)
+			c := newTestClient(t, srv.URL, WithPageSize(tt.pageSize), WithPageWorkers(tt.workers))
+
+			users, err := c.GetUsers(context.Background(), ListOptions{})
+			if err != nil {
+				t.Fatalf("GetUsers: %v", err)
+			}
+			if len(users) != tt.users {
+				t.Errorf("GetUsers returned %d users, want %d", len(users), tt.users)
+			}
+			for i, u := range users {
+				if want := strconv.Itoa(i + 1); u.ID != want {
+					t.Errorf("users[%d].ID = %q, want %q", i, u.ID, want)
+				}
+			}
+			// Concurrent workers request pages in no fixed order.
+			if got := starts(); tt.wantStarts != nil && !slices.Equal(got, tt.wantStarts) {
+				t.Errorf("requested startIndexes %v, want %v", got, tt.wantStarts)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package smartsuite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryMargin is how long before its advertised expiry a cached access
+// token is replaced, so a token never expires while a request is in flight.
+const tokenExpiryMargin = 30 * time.Second
+
+// tokenSource fetches OAuth2 access tokens with the client-credentials grant
+// and caches them until shortly before they expire.
+type tokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time // zero means the token does not advertise an expiry
+}
+
+// tokenResponse is the successful response of an OAuth2 token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// WithClientCredentials authenticates with OAuth2 client credentials instead
+// of a static API key. An access token is fetched from tokenURL on first use,
+// cached, and replaced shortly before it expires or when the API rejects it
+// with 401 Unauthorized.
+func WithClientCredentials(tokenURL, clientID, clientSecret string, scopes []string) ClientOption {
+	return func(c *Client) {
+		c.tokens = &tokenSource{
+			tokenURL:     tokenURL,
+			clientID:     clientID,
+			clientSecret: clientSecret,
+			scopes:       scopes,
+		}
+	}
+}
+
+// token returns a valid access token, fetching a new one with client if the
+// cached token is missing or about to expire.
+func (s *tokenSource) token(ctx context.Context, client *http.Client) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && (s.expiry.IsZero() || time.Now().Before(s.expiry.Add(-tokenExpiryMargin))) {
+		return s.accessToken, nil
+	}
+
+	tok, err := s.fetch(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	s.accessToken = tok.AccessToken
+	s.expiry = time.Time{}
+	if tok.ExpiresIn > 0 {
+		s.expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+	slog.Debug("Fetched OAuth2 access token", "token_url", s.tokenURL, "expires_in", tok.ExpiresIn)
+	return s.accessToken, nil
+}
+
+// invalidate discards the cached token so the next request fetches a new one.
+func (s *tokenSource) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = ""
+	s.expiry = time.Time{}
+}
+
+// fetch requests a new token from the token endpoint, authenticating with
+// HTTP Basic as RFC 6749 recommends.
+func (s *tokenSource) fetch(ctx context.Context, client *http.Client) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("token endpoint rejected the client credentials with status %d: %s: %w", res.StatusCode, string(body), ErrUnauthorized)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("token request failed with status %d: %s", res.StatusCode, string(body))
+	}
+
+	var tok tokenResponse
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token response: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+	if tok.TokenType != "" && !strings.EqualFold(tok.TokenType, "bearer") {
+		return nil, fmt.Errorf("unsupported token type '%s' (expected Bearer)", tok.TokenType)
+	}
+	return &tok, nil
+}
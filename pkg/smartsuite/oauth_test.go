@@ -0,0 +1,122 @@
+package smartsuite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newTokenServer starts a token endpoint that issues tok-1, tok-2, ... each
+// valid for expiresIn seconds, and returns it with the number issued.
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var issued atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "mediator" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"tok-%d","token_type":"Bearer","expires_in":%d}`, issued.Add(1), expiresIn)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &issued
+}
+
+// newAPIServer starts an API that records the bearer token of each request
+// and rejects those listed in revoked with 401.
+func newAPIServer(t *testing.T, revoked ...string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		mu.Lock()
+		seen = append(seen, token)
+		mu.Unlock()
+		for _, bad := range revoked {
+			if token == "Bearer "+bad {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		w.Write([]byte(`{"id":"1","userName":"alice@example.edu"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func newOAuthClient(t *testing.T, apiURL, tokenURL string) *Client {
+	t.Helper()
+	c, err := NewClient(apiURL, "", WithClientCredentials(tokenURL, "mediator", "s3cret", nil), WithMaxRetries(0))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return c
+}
+
+func TestAccessTokenIsCachedUntilExpiry(t *testing.T) {
+	tokens, issued := newTokenServer(t, 3600)
+	api, seen := newAPIServer(t)
+	c := newOAuthClient(t, api.URL, tokens.URL)
+
+	for range 3 {
+		if _, err := c.GetUserByID(context.Background(), "1"); err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+	}
+	if got := issued.Load(); got != 1 {
+		t.Errorf("fetched %d tokens, want 1 reused for every request", got)
+	}
+	for _, token := range seen() {
+		if token != "Bearer tok-1" {
+			t.Errorf("request sent %q, want Bearer tok-1", token)
+		}
+	}
+}
+
+func TestExpiringAccessTokenIsRefreshed(t *testing.T) {
+	// A token expiring within tokenExpiryMargin is replaced before use.
+	tokens, issued := newTokenServer(t, 1)
+	api, seen := newAPIServer(t)
+	c := newOAuthClient(t, api.URL, tokens.URL)
+
+	for range 2 {
+		if _, err := c.GetUserByID(context.Background(), "1"); err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+	}
+	if got := issued.Load(); got != 2 {
+		t.Errorf("fetched %d tokens, want a new one for each request", got)
+	}
+	if got := seen(); len(got) != 2 || got[0] != "Bearer tok-1" || got[1] != "Bearer tok-2" {
+		t.Errorf("requests sent %v, want [Bearer tok-1 Bearer tok-2]", got)
+	}
+}
+
+func TestRejectedAccessTokenIsReplacedOnce(t *testing.T) {
+	tokens, issued := newTokenServer(t, 3600)
+	api, seen := newAPIServer(t, "tok-1")
+	c := newOAuthClient(t, api.URL, tokens.URL)
+
+	if _, err := c.GetUserByID(context.Background(), "1"); err != nil {
+		t.Fatalf("GetUserByID after a revoked token: %v", err)
+	}
+	if got := issued.Load(); got != 2 {
+		t.Errorf("fetched %d tokens, want 2", got)
+	}
+	if got := seen(); len(got) != 2 || got[1] != "Bearer tok-2" {
+		t.Errorf("requests sent %v, want a retry with Bearer tok-2", got)
+	}
+}
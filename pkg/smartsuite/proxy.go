@@ -0,0 +1,33 @@
+package smartsuite
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseProxyURL parses an explicit proxy URL for WithProxyURL. http, https
+// and socks5 proxies are supported; socks5h resolves hostnames on the proxy.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL '%s': %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy URL '%s' (expected an http, https, socks5 or socks5h URL)", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL '%s' has no host", raw)
+	}
+	return u, nil
+}
+
+// WithProxyURL sends every request through proxy instead of the proxy chosen
+// from HTTP_PROXY, HTTPS_PROXY and NO_PROXY, which the client honours by default.
+func WithProxyURL(proxy *url.URL) ClientOption {
+	return func(c *Client) {
+		c.proxyURL = proxy
+	}
+}
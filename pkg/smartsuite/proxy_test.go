@@ -0,0 +1,50 @@
+package smartsuite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProxyURLIsUsed(t *testing.T) {
+	// A forward proxy receives each plain-HTTP request with the absolute
+	// URL of the origin, so it can answer in the origin's place.
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.String())
+		w.Write([]byte(`{"id":"1","userName":"alice@example.edu"}`))
+	}))
+	t.Cleanup(proxy.Close)
+
+	proxyURL, err := ParseProxyURL(proxy.URL)
+	if err != nil {
+		t.Fatalf("ParseProxyURL: %v", err)
+	}
+	c := newTestClient(t, "http://scim.invalid/scim/v2", WithProxyURL(proxyURL))
+
+	user, err := c.GetUserByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("GetUserByID through the proxy: %v", err)
+	}
+	if user.UserName != "alice@example.edu" {
+		t.Errorf("UserName = %q, want the proxy's answer", user.UserName)
+	}
+	if got := proxied.Load(); got != "http://scim.invalid/scim/v2/Users/1" {
+		t.Errorf("proxy received %v, want http://scim.invalid/scim/v2/Users/1", got)
+	}
+}
+
+func TestParseProxyURL(t *testing.T) {
+	for _, raw := range []string{"http://proxy:3128", "https://proxy", "socks5://proxy:1080", "socks5h://proxy:1080"} {
+		if _, err := ParseProxyURL(raw); err != nil {
+			t.Errorf("ParseProxyURL(%q): %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"ftp://proxy", "http://", "proxy:3128"} {
+		if u, err := ParseProxyURL(raw); err == nil {
+			t.Errorf("ParseProxyURL(%q) = %v, want an error", raw, u)
+		}
+	}
+}
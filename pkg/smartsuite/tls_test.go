@@ -0,0 +1,63 @@
+package smartsuite
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTLSServer starts a TLS test server that only speaks versions min to max,
+// and returns it with a pool trusting its certificate.
+func newTLSServer(t *testing.T, min, max uint16) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"totalResults":1,"Resources":[{"id":"1","userName":"alice@example.edu"}]}`))
+	}))
+	srv.TLS = &tls.Config{MinVersion: min, MaxVersion: max}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return srv, pool
+}
+
+func TestTLSDowngradeIsRefused(t *testing.T) {
+	srv, pool := newTLSServer(t, tls.VersionTLS10, tls.VersionTLS11)
+	c := newTestClient(t, srv.URL, WithRootCAs(pool), WithMaxRetries(0))
+
+	_, err := c.GetUserByUsername(context.Background(), "alice@example.edu")
+	if err == nil || !strings.Contains(err.Error(), "protocol version") {
+		t.Fatalf("GetUserByUsername error = %v, want the TLS 1.1 handshake refused", err)
+	}
+}
+
+func TestTLSMinVersionIsConfigurable(t *testing.T) {
+	srv, pool := newTLSServer(t, tls.VersionTLS12, tls.VersionTLS12)
+
+	c := newTestClient(t, srv.URL, WithRootCAs(pool))
+	if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err != nil {
+		t.Fatalf("GetUserByUsername over TLS 1.2 with the default minimum: %v", err)
+	}
+
+	c = newTestClient(t, srv.URL, WithRootCAs(pool), WithMinTLSVersion(tls.VersionTLS13), WithMaxRetries(0))
+	if _, err := c.GetUserByUsername(context.Background(), "alice@example.edu"); err == nil {
+		t.Fatal("GetUserByUsername succeeded over TLS 1.2 with a TLS 1.3 minimum")
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := map[string]uint16{"1.2": tls.VersionTLS12, "TLS1.3": tls.VersionTLS13, " tls 1.1 ": tls.VersionTLS11}
+	for in, want := range tests {
+		if got, err := ParseTLSVersion(in); err != nil || got != want {
+			t.Errorf("ParseTLSVersion(%q) = %#x, %v, want %#x", in, got, err, want)
+		}
+	}
+	if _, err := ParseTLSVersion("1.4"); err == nil {
+		t.Error("ParseTLSVersion(\"1.4\") succeeded")
+	}
+}
@@ -0,0 +1,57 @@
+package smartsuite
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is resolved through the global provider, which is a no-op unless the
+// application installs one, so an untraced client pays only for the calls.
+var tracer = otel.Tracer("github.com/SmartSuiteFoundry/scim-mediator/pkg/smartsuite")
+
+// startRequestSpan starts the span covering one API request and its retries.
+// The query string is left out of the URL because filters carry userNames.
+func startRequestSpan(ctx context.Context, op string, req *http.Request) (context.Context, trace.Span) {
+	u := *req.URL
+	u.RawQuery = ""
+	return tracer.Start(ctx, "smartsuite."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", u.String()),
+		),
+	)
+}
+
+// recordAttempt notes the latest attempt and, if it got a response, its
+// status code. Later attempts overwrite earlier ones.
+func recordAttempt(span trace.Span, attempt int, res *attemptResult) {
+	span.SetAttributes(attribute.Int("smartsuite.attempt", attempt))
+	if res != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+	}
+}
+
+// recordRetry adds an event for an attempt that will be retried after backoff.
+func recordRetry(span trace.Span, attempt int, backoff time.Duration, reason error) {
+	span.AddEvent("retry", trace.WithAttributes(
+		attribute.Int("smartsuite.attempt", attempt),
+		attribute.Int64("smartsuite.backoff_ms", backoff.Milliseconds()),
+		attribute.String("smartsuite.retry_reason", reason.Error()),
+	))
+}
+
+// endRequestSpan ends span, marking it failed if err is set.
+func endRequestSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
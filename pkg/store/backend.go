@@ -0,0 +1,25 @@
+package store
+
+import "github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+// Names of the storage backends accepted by WithBackend.
+const (
+	BackendFile   = "file"
+	BackendSQLite = "sqlite"
+)
+
+// Backend persists the System of Record. Store serializes every call, so
+// implementations need not be safe for concurrent use.
+type Backend interface {
+	LoadUsers() (map[string]models.UserRecord, error)
+	SaveUsers(users map[string]models.UserRecord) error
+	UpsertUser(eppn string, record models.UserRecord) error
+	DeleteUser(eppn string) error
+	RenameUser(from, to string, record models.UserRecord) error
+	LoadGroups() (map[string]models.GroupRecord, error)
+	SaveGroups(groups map[string]models.GroupRecord) error
+	UpsertGroup(name string, record models.GroupRecord) error
+	AppendToAuditLog(event models.AuditEvent) error
+	ReadAuditLog(filter AuditFilter) ([]models.AuditEvent, error)
+	Close() error
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+const (
+	usersFile  = "users.json"
+	groupsFile = "groups.json"
+	auditFile  = "audit.log"
+)
+
+// fileBackend keeps users and groups as JSON documents and the audit log as
+// NDJSON in the data directory. It is the default backend.
+type fileBackend struct {
+	dataDir string
+	// maxAuditBytes is the size at which audit.log is rotated; zero or less
+	// disables rotation. auditBackups is how many rotated files are kept.
+	maxAuditBytes int64
+	auditBackups  int
+}
+
+// LoadUsers reads the users.json file and returns the data.
+func (b *fileBackend) LoadUsers() (map[string]models.UserRecord, error) {
+	path := filepath.Join(b.dataDir, usersFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]models.UserRecord), nil // Return empty map if file doesn't exist
+		}
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var users map[string]models.UserRecord
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal users data: %w", err)
+	}
+	return users, nil
+}
+
+// SaveUsers writes the provided user map to the users.json file.
+func (b *fileBackend) SaveUsers(users map[string]models.UserRecord) error {
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal users data: %w", err)
+	}
+
+	path := filepath.Join(b.dataDir, usersFile)
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	return nil
+}
+
+// UpsertUser rewrites users.json with one record added or replaced. The
+// rewrite is skipped when the stored record is already identical.
+func (b *fileBackend) UpsertUser(eppn string, record models.UserRecord) error {
+	users, err := b.LoadUsers()
+	if err != nil {
+		return err
+	}
+	if existing, ok := users[eppn]; ok && reflect.DeepEqual(existing, record) {
+		return nil
+	}
+	users[eppn] = record
+	return b.SaveUsers(users)
+}
+
+// DeleteUser rewrites users.json without the given record. Deleting a user
+// that is not stored is a no-op.
+func (b *fileBackend) DeleteUser(eppn string) error {
+	users, err := b.LoadUsers()
+	if err != nil {
+		return err
+	}
+	if _, ok := users[eppn]; !ok {
+		return nil
+	}
+	delete(users, eppn)
+	return b.SaveUsers(users)
+}
+
+// RenameUser rewrites users.json once with the record moved from one key to
+// the other.
+func (b *fileBackend) RenameUser(from, to string, record models.UserRecord) error {
+	users, err := b.LoadUsers()
+	if err != nil {
+		return err
+	}
+	if _, ok := users[to]; ok {
+		return fmt.Errorf("cannot rename user '%s' to '%s': %w", from, to, ErrUserExists)
+	}
+	delete(users, from)
+	users[to] = record
+	return b.SaveUsers(users)
+}
+
+// LoadGroups reads the groups.json file and returns the data.
+func (b *fileBackend) LoadGroups() (map[string]models.GroupRecord, error) {
+	path := filepath.Join(b.dataDir, groupsFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]models.GroupRecord), nil // Return empty map if file doesn't exist
+		}
+		return nil, fmt.Errorf("failed to read groups file: %w", err)
+	}
+
+	var groups map[string]models.GroupRecord
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal groups data: %w", err)
+	}
+	return groups, nil
+}
+
+// SaveGroups writes the provided group map to the groups.json file.
+func (b *fileBackend) SaveGroups(groups map[string]models.GroupRecord) error {
+	data, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal groups data: %w", err)
+	}
+
+	path := filepath.Join(b.dataDir, groupsFile)
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write groups file: %w", err)
+	}
+	return nil
+}
+
+// UpsertGroup rewrites groups.json with one record added or replaced. The
+// rewrite is skipped when the stored record is already identical.
+func (b *fileBackend) UpsertGroup(name string, record models.GroupRecord) error {
+	groups, err := b.LoadGroups()
+	if err != nil {
+		return err
+	}
+	if existing, ok := groups[name]; ok && reflect.DeepEqual(existing, record) {
+		return nil
+	}
+	groups[name] = record
+	return b.SaveGroups(groups)
+}
+
+// AppendToAuditLog appends a new event to the audit log file.
+func (b *fileBackend) AppendToAuditLog(event models.AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	path := filepath.Join(b.dataDir, auditFile)
+	if err := b.rotateAuditLog(path); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log for writing: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(string(data) + "\n"); err != nil {
+		return fmt.Errorf("failed to write to audit log: %w", err)
+	}
+
+	return nil
+}
+
+// ReadAuditLog reads rotated backups still on disk before the live audit.log,
+// so events come back oldest first.
+func (b *fileBackend) ReadAuditLog(filter AuditFilter) ([]models.AuditEvent, error) {
+	path := filepath.Join(b.dataDir, auditFile)
+	var files []string
+	for i := b.auditBackups; i >= 1; i-- {
+		files = append(files, fmt.Sprintf("%s.%d", path, i))
+	}
+	files = append(files, path)
+
+	var events []models.AuditEvent
+	skipped := 0
+	for _, file := range files {
+		n, err := readAuditFile(file, filter, &events)
+		if err != nil {
+			return nil, err
+		}
+		skipped += n
+	}
+	if skipped > 0 {
+		slog.Warn("Skipped malformed audit log lines.", "count", skipped)
+	}
+	return events, nil
+}
+
+// Close is a no-op; the file backend holds no open handles between calls.
+func (b *fileBackend) Close() error {
+	return nil
+}
+
+// rotateAuditLog shifts path to path.1 (and older backups up by one) once it
+// has reached maxAuditBytes, dropping the oldest beyond auditBackups. Store
+// serializes calls, so no event is written mid-rename.
+func (b *fileBackend) rotateAuditLog(path string) error {
+	if b.maxAuditBytes <= 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() < b.maxAuditBytes {
+		return nil
+	}
+
+	if b.auditBackups <= 0 {
+		return os.Remove(path)
+	}
+	if err := os.Remove(fmt.Sprintf("%s.%d", path, b.auditBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := b.auditBackups - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+// writeFileAtomic replaces path with data by writing a sibling .tmp file and
+// renaming it into place. A crash mid-write leaves the previous file intact
+// rather than a truncated one that every later command would fail to load.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	// Flush to disk before the rename so the new name never points at
+	// unwritten data.
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+func TestSaveUsersFailedWriteKeepsOriginal(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available to simulate a failed write")
+	}
+	dataDir := t.TempDir()
+	s, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer s.Close()
+
+	original := map[string]models.UserRecord{"alice@example.edu": {SCIMID: "1", Status: "active"}}
+	if err := s.SaveUsers(original); err != nil {
+		t.Fatalf("SaveUsers: %v", err)
+	}
+	path := filepath.Join(dataDir, usersFile)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every write to /dev/full fails with ENOSPC, as a full disk would part
+	// way through the temp file.
+	if err := os.Symlink("/dev/full", path+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	replacement := map[string]models.UserRecord{"bob@example.edu": {SCIMID: "2", Status: "active"}}
+	if err := s.SaveUsers(replacement); err == nil {
+		t.Fatal("SaveUsers succeeded writing to /dev/full")
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("users.json changed after a failed write:\n%s", after)
+	}
+	if _, err := os.Lstat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind after a failed write: %v", err)
+	}
+	users, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	if _, ok := users["alice@example.edu"]; !ok || len(users) != 1 {
+		t.Errorf("LoadUsers = %v, want only alice@example.edu", users)
+	}
+}
+
+func TestLoadUsersIgnoresTornTempFile(t *testing.T) {
+	dataDir := t.TempDir()
+	s, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.SaveUsers(map[string]models.UserRecord{"alice@example.edu": {SCIMID: "1"}}); err != nil {
+		t.Fatalf("SaveUsers: %v", err)
+	}
+	// What a crash mid-write leaves behind.
+	if err := os.WriteFile(filepath.Join(dataDir, usersFile+".tmp"), []byte(`{"bob@exam`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	if users["alice@example.edu"].SCIMID != "1" {
+		t.Errorf("LoadUsers = %v, want alice@example.edu with SCIM id 1", users)
+	}
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const lockFile = ".lock"
+
+// lockPollInterval is how often a contended lock is retried while waiting.
+const lockPollInterval = 100 * time.Millisecond
+
+// ErrLocked is wrapped by the error NewStore returns when another process
+// holds the store's lock for longer than the lock timeout.
+var ErrLocked = errors.New("store is locked by another process")
+
+// acquireLock opens the lock file at path and takes an exclusive advisory lock
+// on it, retrying until timeout elapses. A zero timeout fails immediately if
+// the lock is held. The lock is released when the returned file is closed or
+// the process exits.
+func acquireLock(path string, timeout time.Duration) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return waitForLock(f, path, true, timeout)
+}
+
+// acquireSharedLock is acquireLock for readers: it takes a shared lock, so it
+// only waits for a writer, and opens the lock file read-only without
+// creating it. It returns nil if no lock file exists, as no writer has ever
+// used the data directory.
+func acquireSharedLock(path string, timeout time.Duration) (*os.File, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return waitForLock(f, path, false, timeout)
+}
+
+// waitForLock retries tryLock on f until it succeeds or timeout elapses,
+// closing f on failure.
+func waitForLock(f *os.File, path string, exclusive bool, timeout time.Duration) (*os.File, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLock(f, exclusive)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if ok {
+			return f, nil
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			if timeout > 0 {
+				return nil, fmt.Errorf("%w (waited %s for %s)", ErrLocked, timeout, path)
+			}
+			return nil, fmt.Errorf("%w (%s)", ErrLocked, path)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package store
+
+import "os"
+
+// tryLock always succeeds on platforms without flock; concurrent mediator
+// processes must be prevented by the scheduler there.
+func tryLock(f *os.File, exclusive bool) (bool, error) {
+	return true, nil
+}
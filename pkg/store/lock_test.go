@@ -0,0 +1,82 @@
+//go:build unix
+
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// holdLock opens the store in dataDir from a goroutine and keeps it open
+// until release is closed, as another mediator process would.
+func holdLock(t *testing.T, dataDir string, release <-chan struct{}) {
+	t.Helper()
+	held := make(chan error)
+	go func() {
+		s, err := NewStore(dataDir)
+		held <- err
+		if err != nil {
+			return
+		}
+		<-release
+		s.Close()
+	}()
+	if err := <-held; err != nil {
+		t.Fatalf("holder failed to open store: %v", err)
+	}
+}
+
+func TestNewStoreFailsFastWhenLocked(t *testing.T) {
+	dataDir := t.TempDir()
+	release := make(chan struct{})
+	defer close(release)
+	holdLock(t, dataDir, release)
+
+	_, err := NewStore(dataDir)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("NewStore error = %v, want ErrLocked", err)
+	}
+}
+
+func TestNewStoreLockTimeoutExpires(t *testing.T) {
+	dataDir := t.TempDir()
+	release := make(chan struct{})
+	defer close(release)
+	holdLock(t, dataDir, release)
+
+	timeout := 3 * lockPollInterval
+	start := time.Now()
+	_, err := NewStore(dataDir, WithLockTimeout(timeout))
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("NewStore error = %v, want ErrLocked", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("NewStore gave up after %s, want at least %s", elapsed, timeout)
+	}
+}
+
+func TestNewStoreWaitsForLock(t *testing.T) {
+	dataDir := t.TempDir()
+	release := make(chan struct{})
+	holdLock(t, dataDir, release)
+	time.AfterFunc(2*lockPollInterval, func() { close(release) })
+
+	s, err := NewStore(dataDir, WithLockTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	s.Close()
+}
+
+func TestReadOnlyStoreLockedByWriter(t *testing.T) {
+	dataDir := t.TempDir()
+	release := make(chan struct{})
+	defer close(release)
+	holdLock(t, dataDir, release)
+
+	_, err := NewStore(dataDir, WithReadOnly())
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("read-only NewStore error = %v, want ErrLocked", err)
+	}
+}
@@ -0,0 +1,313 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const sqliteFile = "store.db"
+
+// sqliteSchema creates the tables on first open. Records are kept whole in a
+// JSON data column so new attributes need no migration; the columns beside it
+// are the ones worth indexing and querying on.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	eppn    TEXT PRIMARY KEY,
+	scim_id TEXT NOT NULL,
+	status  TEXT NOT NULL,
+	data    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS users_scim_id ON users (scim_id);
+CREATE TABLE IF NOT EXISTS groups (
+	display_name TEXT PRIMARY KEY,
+	scim_id      TEXT NOT NULL,
+	data         TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS audit_events (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp      TEXT NOT NULL,
+	timestamp_ns   INTEGER NOT NULL,
+	transaction_id TEXT NOT NULL,
+	use_case       TEXT NOT NULL,
+	target         TEXT NOT NULL,
+	status         TEXT NOT NULL,
+	details        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_target ON audit_events (target);
+CREATE INDEX IF NOT EXISTS audit_events_timestamp ON audit_events (timestamp_ns);
+`
+
+// sqliteBackend keeps the System of Record in a single SQLite database in the
+// data directory.
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+// openSQLiteBackend opens (creating if needed) the database at path and
+// ensures its schema exists. A read-only backend neither creates the file nor
+// touches the schema.
+func openSQLiteBackend(path string, readOnly bool) (*sqliteBackend, error) {
+	dsn := path
+	if readOnly {
+		dsn = "file:" + path + "?mode=ro"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite store: %w", err)
+	}
+	// A single connection keeps transactions and the schema on one handle;
+	// Store serializes access anyway.
+	db.SetMaxOpenConns(1)
+	if readOnly {
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open sqlite store: %w", err)
+		}
+		return &sqliteBackend{db: db}, nil
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema: %w", err)
+	}
+	return &sqliteBackend{db: db}, nil
+}
+
+func (b *sqliteBackend) LoadUsers() (map[string]models.UserRecord, error) {
+	rows, err := b.db.Query(`SELECT eppn, data FROM users`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make(map[string]models.UserRecord)
+	for rows.Next() {
+		var eppn, data string
+		if err := rows.Scan(&eppn, &data); err != nil {
+			return nil, fmt.Errorf("failed to read user row: %w", err)
+		}
+		var record models.UserRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal user '%s': %w", eppn, err)
+		}
+		users[eppn] = record
+	}
+	return users, rows.Err()
+}
+
+// SaveUsers replaces the users table with the given map in one transaction.
+func (b *sqliteBackend) SaveUsers(users map[string]models.UserRecord) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM users`); err != nil {
+		return fmt.Errorf("failed to clear users: %w", err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO users (eppn, scim_id, status, data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for eppn, record := range users {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal user '%s': %w", eppn, err)
+		}
+		if _, err := stmt.Exec(eppn, record.SCIMID, record.Status, string(data)); err != nil {
+			return fmt.Errorf("failed to write user '%s': %w", eppn, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (b *sqliteBackend) UpsertUser(eppn string, record models.UserRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user '%s': %w", eppn, err)
+	}
+	_, err = b.db.Exec(
+		`INSERT INTO users (eppn, scim_id, status, data) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (eppn) DO UPDATE SET scim_id = excluded.scim_id, status = excluded.status, data = excluded.data`,
+		eppn, record.SCIMID, record.Status, string(data),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write user '%s': %w", eppn, err)
+	}
+	return nil
+}
+
+func (b *sqliteBackend) DeleteUser(eppn string) error {
+	if _, err := b.db.Exec(`DELETE FROM users WHERE eppn = ?`, eppn); err != nil {
+		return fmt.Errorf("failed to delete user '%s': %w", eppn, err)
+	}
+	return nil
+}
+
+func (b *sqliteBackend) RenameUser(from, to string, record models.UserRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user '%s': %w", to, err)
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE eppn = ?`, to).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up user '%s': %w", to, err)
+	}
+	if exists > 0 {
+		return fmt.Errorf("cannot rename user '%s' to '%s': %w", from, to, ErrUserExists)
+	}
+	if _, err := tx.Exec(`DELETE FROM users WHERE eppn = ?`, from); err != nil {
+		return fmt.Errorf("failed to delete user '%s': %w", from, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO users (eppn, scim_id, status, data) VALUES (?, ?, ?, ?)`, to, record.SCIMID, record.Status, string(data)); err != nil {
+		return fmt.Errorf("failed to write user '%s': %w", to, err)
+	}
+	return tx.Commit()
+}
+
+func (b *sqliteBackend) LoadGroups() (map[string]models.GroupRecord, error) {
+	rows, err := b.db.Query(`SELECT display_name, data FROM groups`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[string]models.GroupRecord)
+	for rows.Next() {
+		var name, data string
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, fmt.Errorf("failed to read group row: %w", err)
+		}
+		var record models.GroupRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal group '%s': %w", name, err)
+		}
+		groups[name] = record
+	}
+	return groups, rows.Err()
+}
+
+// SaveGroups replaces the groups table with the given map in one transaction.
+func (b *sqliteBackend) SaveGroups(groups map[string]models.GroupRecord) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM groups`); err != nil {
+		return fmt.Errorf("failed to clear groups: %w", err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO groups (display_name, scim_id, data) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for name, record := range groups {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal group '%s': %w", name, err)
+		}
+		if _, err := stmt.Exec(name, record.SCIMID, string(data)); err != nil {
+			return fmt.Errorf("failed to write group '%s': %w", name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (b *sqliteBackend) UpsertGroup(name string, record models.GroupRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal group '%s': %w", name, err)
+	}
+	_, err = b.db.Exec(
+		`INSERT INTO groups (display_name, scim_id, data) VALUES (?, ?, ?)
+		 ON CONFLICT (display_name) DO UPDATE SET scim_id = excluded.scim_id, data = excluded.data`,
+		name, record.SCIMID, string(data),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write group '%s': %w", name, err)
+	}
+	return nil
+}
+
+func (b *sqliteBackend) AppendToAuditLog(event models.AuditEvent) error {
+	_, err := b.db.Exec(
+		`INSERT INTO audit_events (timestamp, timestamp_ns, transaction_id, use_case, target, status, details) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		event.Timestamp.Format(time.RFC3339Nano), event.Timestamp.UnixNano(), event.TransactionID, event.UseCase, event.Target, event.Status, event.Details,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+// ReadAuditLog applies the filter in SQL and returns events in insertion order.
+func (b *sqliteBackend) ReadAuditLog(filter AuditFilter) ([]models.AuditEvent, error) {
+	var where []string
+	var args []interface{}
+	if filter.Target != "" {
+		where = append(where, "target = ?")
+		args = append(args, filter.Target)
+	}
+	if filter.UseCase != "" {
+		where = append(where, "use_case = ?")
+		args = append(args, filter.UseCase)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "timestamp_ns >= ?")
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "timestamp_ns < ?")
+		args = append(args, filter.Until.UnixNano())
+	}
+	query := `SELECT timestamp, transaction_id, use_case, target, status, details FROM audit_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := b.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		var timestamp string
+		if err := rows.Scan(&timestamp, &event.TransactionID, &event.UseCase, &event.Target, &event.Status, &event.Details); err != nil {
+			return nil, fmt.Errorf("failed to read audit event: %w", err)
+		}
+		event.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse audit event timestamp: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
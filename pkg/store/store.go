@@ -1,131 +1,375 @@
 package store
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
 )
 
+// Default audit log rotation applied by NewStore.
 const (
-	usersFile  = "users.json"
-	groupsFile = "groups.json"
-	auditFile  = "audit.log"
+	DefaultMaxAuditBytes = 10 << 20
+	DefaultAuditBackups  = 5
 )
 
-// Store manages the file-based System of Record.
+// ErrReadOnly is returned by writes to a store opened WithReadOnly.
+var ErrReadOnly = errors.New("store is opened read-only")
+
+// ErrUserExists is returned by RenameUser when the new userName is already
+// stored.
+var ErrUserExists = errors.New("a user with that userName is already stored")
+
+// Store manages the System of Record. Persistence is delegated to a Backend;
+// Store adds locking, validation and caching on top.
 type Store struct {
 	dataDir string
 	mu      sync.Mutex
+	backend Backend
+
+	backendName            string
+	rejectDuplicateSCIMIDs bool
+	readOnly               bool
+	lockTimeout            time.Duration
+	maxAuditBytes          int64
+	auditBackups           int
+	// lock holds the exclusive lock on the data directory for the life of the
+	// Store, so concurrent mediator processes cannot interleave their
+	// read-modify-write cycles.
+	lock *os.File
+
+	// byID is a lazily built reverse index from SCIM ID to userName, with the
+	// records it was built from. SaveUsers drops it so it is rebuilt from the
+	// new contents on the next lookup.
+	byID         map[string]string
+	indexedUsers map[string]models.UserRecord
 }
 
-// NewStore creates a new store manager. It ensures the data directory exists.
-func NewStore(dataDir string) (*Store, error) {
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		return nil, fmt.Errorf("could not create data directory %s: %w", dataDir, err)
+// Option configures optional behaviour of a Store at construction time.
+type Option func(*Store)
+
+// WithRejectDuplicateSCIMIDs makes LoadUsers fail when two userNames share a
+// SCIM ID, instead of only logging a warning.
+func WithRejectDuplicateSCIMIDs(reject bool) Option {
+	return func(s *Store) {
+		s.rejectDuplicateSCIMIDs = reject
 	}
-	return &Store{dataDir: dataDir}, nil
 }
 
-// LoadUsers reads the users.json file and returns the data.
-func (s *Store) LoadUsers() (map[string]models.UserRecord, error) {
+// WithLockTimeout sets how long NewStore waits for another process to release
+// the store lock. The default of zero fails immediately with ErrLocked.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(s *Store) {
+		s.lockTimeout = timeout
+	}
+}
+
+// WithAuditRotation rotates audit.log once it reaches maxBytes, keeping up to
+// backups older files as audit.log.1 (newest) through audit.log.N. A maxBytes
+// of zero or less disables rotation. It only applies to the file backend.
+func WithAuditRotation(maxBytes int64, backups int) Option {
+	return func(s *Store) {
+		s.maxAuditBytes = maxBytes
+		s.auditBackups = backups
+	}
+}
+
+// WithReadOnly opens the store for reading only. The data directory and lock
+// file are not created, a shared lock lets other readers run alongside, and
+// every write fails with ErrReadOnly.
+func WithReadOnly() Option {
+	return func(s *Store) {
+		s.readOnly = true
+	}
+}
+
+// WithBackend selects where the store keeps its data: BackendFile (the
+// default) for JSON files, or BackendSQLite for a store.db database, both in
+// the data directory.
+func WithBackend(name string) Option {
+	return func(s *Store) {
+		s.backendName = name
+	}
+}
+
+// NewStore creates a new store manager. It ensures the data directory exists
+// and takes an exclusive lock on it, which is held until Close is called or
+// the process exits.
+func NewStore(dataDir string, opts ...Option) (*Store, error) {
+	s := &Store{
+		dataDir:       dataDir,
+		backendName:   BackendFile,
+		maxAuditBytes: DefaultMaxAuditBytes,
+		auditBackups:  DefaultAuditBackups,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	var lock *os.File
+	var err error
+	if s.readOnly {
+		lock, err = acquireSharedLock(filepath.Join(dataDir, lockFile), s.lockTimeout)
+	} else {
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return nil, fmt.Errorf("could not create data directory %s: %w", dataDir, err)
+		}
+		lock, err = acquireLock(filepath.Join(dataDir, lockFile), s.lockTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.lock = lock
+
+	switch s.backendName {
+	case BackendFile, "":
+		s.backend = &fileBackend{dataDir: dataDir, maxAuditBytes: s.maxAuditBytes, auditBackups: s.auditBackups}
+	case BackendSQLite:
+		s.backend, err = openSQLiteBackend(filepath.Join(dataDir, sqliteFile), s.readOnly)
+	default:
+		err = fmt.Errorf("unknown store backend '%s' (expected %s or %s)", s.backendName, BackendFile, BackendSQLite)
+	}
+	if err != nil {
+		if lock != nil {
+			lock.Close()
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close releases the backend and the store lock. The Store must not be used
+// afterwards.
+func (s *Store) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	path := filepath.Join(s.dataDir, usersFile)
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return make(map[string]models.UserRecord), nil // Return empty map if file doesn't exist
+	if s.backend == nil {
+		return nil
+	}
+	err := s.backend.Close()
+	if s.lock != nil {
+		if lockErr := s.lock.Close(); err == nil {
+			err = lockErr
 		}
-		return nil, fmt.Errorf("failed to read users file: %w", err)
 	}
+	s.backend, s.lock = nil, nil
+	return err
+}
 
-	var users map[string]models.UserRecord
-	if err := json.Unmarshal(data, &users); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal users data: %w", err)
+// FindDuplicateSCIMIDs returns every SCIM ID that is referenced by more than
+// one userName, mapped to the sorted list of conflicting keys. Records without
+// a SCIM ID are ignored.
+func FindDuplicateSCIMIDs(users map[string]models.UserRecord) map[string][]string {
+	byID := make(map[string][]string)
+	for eppn, record := range users {
+		if record.SCIMID != "" {
+			byID[record.SCIMID] = append(byID[record.SCIMID], eppn)
+		}
 	}
-	return users, nil
+	duplicates := make(map[string][]string)
+	for id, eppns := range byID {
+		if len(eppns) > 1 {
+			sort.Strings(eppns)
+			duplicates[id] = eppns
+		}
+	}
+	return duplicates
 }
 
-// SaveUsers writes the provided user map to the users.json file.
-func (s *Store) SaveUsers(users map[string]models.UserRecord) error {
+// LoadUsers returns every user record keyed by userName.
+func (s *Store) LoadUsers() (map[string]models.UserRecord, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.MarshalIndent(users, "", "  ")
+	users, err := s.backend.LoadUsers()
 	if err != nil {
-		return fmt.Errorf("failed to marshal users data: %w", err)
+		return nil, err
 	}
+	migrateEmails(users)
 
-	path := filepath.Join(s.dataDir, usersFile)
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("failed to write users file: %w", err)
+	// Two keys sharing a SCIM ID usually means a rename was mishandled. Acting on
+	// such a store risks double operations, so make it loud.
+	if duplicates := FindDuplicateSCIMIDs(users); len(duplicates) > 0 {
+		var conflicts []string
+		for id, eppns := range duplicates {
+			conflicts = append(conflicts, fmt.Sprintf("%s: %s", id, strings.Join(eppns, ", ")))
+		}
+		sort.Strings(conflicts)
+		if s.rejectDuplicateSCIMIDs {
+			return nil, fmt.Errorf("users file contains duplicate SCIM IDs: %s", strings.Join(conflicts, "; "))
+		}
+		slog.Warn("Users file contains duplicate SCIM IDs. Reverse lookups for these records are unreliable.", "count", len(duplicates), "conflicts", conflicts)
 	}
-	return nil
+	return users, nil
 }
 
-// LoadGroups reads the groups.json file and returns the data.
-func (s *Store) LoadGroups() (map[string]models.GroupRecord, error) {
+// migrateEmails promotes the single email of records written before
+// UserRecord.Emails existed into a one-element Emails list, marked primary.
+// The old field is kept, so nothing is lost if an older mediator reads the
+// file again.
+func migrateEmails(users map[string]models.UserRecord) {
+	for eppn, record := range users {
+		if len(record.Emails) == 0 && record.Email != "" {
+			record.Emails = []models.EmailRecord{{Value: record.Email, Primary: true}}
+			users[eppn] = record
+		}
+	}
+}
+
+// UserBySCIMID returns the record with the given SCIM ID along with its
+// userName key. The reverse index is built on first use and cached until the
+// next SaveUsers. If several userNames share the ID, the alphabetically first
+// one is returned.
+func (s *Store) UserBySCIMID(scimID string) (models.UserRecord, string, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	path := filepath.Join(s.dataDir, groupsFile)
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return make(map[string]models.GroupRecord), nil // Return empty map if file doesn't exist
+	if s.byID == nil {
+		users, err := s.backend.LoadUsers()
+		if err != nil {
+			slog.Warn("Could not build SCIM ID index", "error", err)
+			return models.UserRecord{}, "", false
+		}
+		migrateEmails(users)
+		s.byID = make(map[string]string, len(users))
+		for eppn, record := range users {
+			if record.SCIMID == "" {
+				continue
+			}
+			if existing, ok := s.byID[record.SCIMID]; !ok || eppn < existing {
+				s.byID[record.SCIMID] = eppn
+			}
 		}
-		return nil, fmt.Errorf("failed to read groups file: %w", err)
+		s.indexedUsers = users
 	}
 
-	var groups map[string]models.GroupRecord
-	if err := json.Unmarshal(data, &groups); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal groups data: %w", err)
+	eppn, ok := s.byID[scimID]
+	if !ok {
+		return models.UserRecord{}, "", false
 	}
-	return groups, nil
+	return s.indexedUsers[eppn], eppn, true
 }
 
-// SaveGroups writes the provided group map to the groups.json file.
-func (s *Store) SaveGroups(groups map[string]models.GroupRecord) error {
+// SaveUsers replaces the stored users with the provided map.
+func (s *Store) SaveUsers(users map[string]models.UserRecord) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.MarshalIndent(groups, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal groups data: %w", err)
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := s.backend.SaveUsers(users); err != nil {
+		return err
 	}
+	s.byID, s.indexedUsers = nil, nil
+	return nil
+}
+
+// UpsertUser adds or replaces a single user record, leaving the rest of the
+// store untouched.
+func (s *Store) UpsertUser(eppn string, record models.UserRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	path := filepath.Join(s.dataDir, groupsFile)
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("failed to write groups file: %w", err)
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := s.backend.UpsertUser(eppn, record); err != nil {
+		return err
 	}
+	s.byID, s.indexedUsers = nil, nil
 	return nil
 }
 
-// AppendToAuditLog appends a new event to the audit log file.
-func (s *Store) AppendToAuditLog(event models.AuditEvent) error {
+// DeleteUser removes a single user record. Deleting a user that is not stored
+// is not an error.
+func (s *Store) DeleteUser(eppn string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal audit event: %w", err)
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := s.backend.DeleteUser(eppn); err != nil {
+		return err
 	}
+	s.byID, s.indexedUsers = nil, nil
+	return nil
+}
 
-	path := filepath.Join(s.dataDir, auditFile)
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open audit log for writing: %w", err)
+// RenameUser moves a user record from one userName to another in a single
+// write, so the store never holds both keys or neither. It fails with
+// ErrUserExists rather than overwrite a record already stored under to.
+func (s *Store) RenameUser(from, to string, record models.UserRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := s.backend.RenameUser(from, to, record); err != nil {
+		return err
+	}
+	s.byID, s.indexedUsers = nil, nil
+	return nil
+}
+
+// LoadGroups returns every group record keyed by displayName.
+func (s *Store) LoadGroups() (map[string]models.GroupRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.backend.LoadGroups()
+}
+
+// SaveGroups replaces the stored groups with the provided map.
+func (s *Store) SaveGroups(groups map[string]models.GroupRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
 	}
-	defer f.Close()
+	return s.backend.SaveGroups(groups)
+}
 
-	if _, err := f.WriteString(string(data) + "\n"); err != nil {
-		return fmt.Errorf("failed to write to audit log: %w", err)
+// SetGroupMember records that the user with scimID was added to or removed
+// from the named group. The change is applied to the stored record in one
+// step, so concurrent callers updating the same group do not lose each
+// other's changes. A group that is not stored is left alone.
+func (s *Store) SetGroupMember(name, scimID string, member bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	groups, err := s.backend.LoadGroups()
+	if err != nil {
+		return err
+	}
+	record, ok := groups[name]
+	if !ok || !record.SetMember(scimID, member) {
+		return nil
 	}
+	return s.backend.UpsertGroup(name, record)
+}
 
-	return nil
+// AppendToAuditLog appends a new event to the audit log.
+func (s *Store) AppendToAuditLog(event models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	return s.backend.AppendToAuditLog(event)
 }
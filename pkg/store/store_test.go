@@ -0,0 +1,162 @@
+package store
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SmartSuiteFoundry/scim-mediator/pkg/models"
+)
+
+// captureLogs routes the default logger to a buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// duplicatedUsers has alice and her old userName both pointing at one SCIM ID.
+var duplicatedUsers = map[string]models.UserRecord{
+	"alice@example.edu":     {SCIMID: "a1", Status: "active"},
+	"alice.old@example.edu": {SCIMID: "a1", Status: "active"},
+	"bob@example.edu":       {SCIMID: "b2", Status: "active"},
+}
+
+func TestLoadUsersDuplicateSCIMIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		reject  bool
+		wantErr bool
+	}{
+		{name: "warn", reject: false, wantErr: false},
+		{name: "error", reject: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			s, err := NewStore(t.TempDir(), WithRejectDuplicateSCIMIDs(tt.reject))
+			if err != nil {
+				t.Fatalf("NewStore: %v", err)
+			}
+			defer s.Close()
+			if err := s.SaveUsers(duplicatedUsers); err != nil {
+				t.Fatalf("SaveUsers: %v", err)
+			}
+
+			users, err := s.LoadUsers()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("LoadUsers succeeded, want a duplicate SCIM ID error")
+				}
+				if want := "a1: alice.old@example.edu, alice@example.edu"; !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %q, want it to name %q", err, want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadUsers: %v", err)
+			}
+			if len(users) != len(duplicatedUsers) {
+				t.Errorf("loaded %d users, want %d", len(users), len(duplicatedUsers))
+			}
+			if !strings.Contains(logs.String(), "duplicate SCIM IDs") || !strings.Contains(logs.String(), "a1: alice.old@example.edu, alice@example.edu") {
+				t.Errorf("no duplicate SCIM ID warning logged:\n%s", logs)
+			}
+		})
+	}
+}
+
+func TestFindDuplicateSCIMIDsIgnoresMissingIDs(t *testing.T) {
+	users := map[string]models.UserRecord{
+		"pending1@example.edu": {Status: "pending"},
+		"pending2@example.edu": {Status: "pending"},
+		"bob@example.edu":      {SCIMID: "b2"},
+	}
+	if duplicates := FindDuplicateSCIMIDs(users); len(duplicates) != 0 {
+		t.Errorf("FindDuplicateSCIMIDs = %v, want none", duplicates)
+	}
+}
+
+func TestLoadUsersMigratesLegacyEmail(t *testing.T) {
+	dataDir := t.TempDir()
+	legacy, err := os.ReadFile(filepath.Join("testdata", "users_legacy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, usersFile), legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer s.Close()
+
+	users, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+
+	alice := users["alice@example.edu"]
+	wantEmails := []models.EmailRecord{{Value: "alice@example.edu", Primary: true}}
+	if !reflect.DeepEqual(alice.Emails, wantEmails) {
+		t.Errorf("alice Emails = %+v, want %+v", alice.Emails, wantEmails)
+	}
+	if alice.Email != "alice@example.edu" {
+		t.Errorf("alice Email = %q, want the legacy address kept", alice.Email)
+	}
+	if alice.SCIMID != "a1" || alice.Title != "Professor" || alice.Department != "Physics" || alice.Name.GivenName != "Alice" {
+		t.Errorf("alice lost attributes in migration: %+v", alice)
+	}
+
+	bob := users["bob@example.edu"]
+	if len(bob.Emails) != 0 {
+		t.Errorf("bob Emails = %+v, want none for an empty legacy email", bob.Emails)
+	}
+	if bob.DeactivationTimestamp == nil || bob.Status != "inactive" {
+		t.Errorf("bob lost attributes in migration: %+v", bob)
+	}
+
+	// The migrated records survive a save and reload unchanged.
+	if err := s.SaveUsers(users); err != nil {
+		t.Fatalf("SaveUsers: %v", err)
+	}
+	reloaded, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers after save: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded, users) {
+		t.Errorf("reloaded users = %+v, want %+v", reloaded, users)
+	}
+}
+
+func TestLoadUsersKeepsExistingEmails(t *testing.T) {
+	dataDir := t.TempDir()
+	s, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer s.Close()
+
+	emails := []models.EmailRecord{
+		{Value: "carol@example.edu", Type: "work", Primary: true},
+		{Value: "carol@home.example", Type: "home"},
+	}
+	if err := s.SaveUsers(map[string]models.UserRecord{"carol@example.edu": {SCIMID: "c3", Email: "carol@example.edu", Emails: emails}}); err != nil {
+		t.Fatalf("SaveUsers: %v", err)
+	}
+	users, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	if got := users["carol@example.edu"].Emails; !reflect.DeepEqual(got, emails) {
+		t.Errorf("Emails = %+v, want %+v", got, emails)
+	}
+}